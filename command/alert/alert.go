@@ -14,12 +14,17 @@
 package alert
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"maps"
 	"math/rand"
+	"slices"
+	"sync"
 	"time"
 
 	hclog "github.com/hashicorp/go-hclog"
+	uuid "github.com/hashicorp/go-uuid"
 )
 
 // Field represents a summary of the query results that
@@ -51,6 +56,11 @@ type Record struct {
 	// concatenated
 	Text string `json:"text,omitempty"`
 
+	// Summary is a shortened version of Text for outputs with
+	// limited space (e.g. chat outputs). It is only set when
+	// Text is too long to be sent to such outputs in full
+	Summary string `json:"-"`
+
 	// BodyField is whether this record used the 'body_field'
 	// index (per the rule configuration file) to group the
 	// Elasticsearch response JSON
@@ -74,6 +84,35 @@ type Alert struct {
 	// this alert
 	RuleName string
 
+	// Namespace is the namespace of the rule that generated
+	// this alert (typically the team that owns the rule).
+	// It is empty if the rule does not belong to a namespace
+	Namespace string
+
+	// Description is a human-readable explanation of what
+	// the rule that generated this alert detects
+	Description string
+
+	// Owner is the person or team responsible for
+	// responding to this alert
+	Owner string
+
+	// RunbookURL is a link to instructions on how to
+	// respond to this alert
+	RunbookURL string
+
+	// Severity is how urgent this alert is (e.g. "warning"
+	// or "critical")
+	Severity string
+
+	// Labels are free-form key/value pairs defined by the
+	// rule that generated this alert
+	Labels map[string]string
+
+	// ConditionGroups are the names of the condition groups
+	// of the rule that fired to generate this alert
+	ConditionGroups []string
+
 	// Method is a set of alert.AlertMethod instances
 	// which that the AlertHAndler will use to send
 	// alerts
@@ -82,23 +121,135 @@ type Alert struct {
 	// Records are the processed response data from an
 	// Elasticsearch query
 	Records []*Record
+
+	// Group are the alerts this alert notifies of when it is the
+	// notification of a group of alerts (see Grouping), in which
+	// case Records holds the records of all of them. Outputs
+	// that render the alerts of a group individually should use
+	// Alerts()
+	Group []*Alert
+}
+
+// Alerts returns the alerts of the group this alert notifies of,
+// or the alert itself if it is not the notification of a group.
+func (a *Alert) Alerts() []*Alert {
+	if len(a.Group) > 0 {
+		return a.Group
+	}
+	return []*Alert{a}
+}
+
+// QualifiedName returns the name of the rule that generated this
+// alert prefixed by its namespace, if any (e.g. "team-a/Errors").
+func (a *Alert) QualifiedName() string {
+	if a.Namespace == "" {
+		return a.RuleName
+	}
+	return a.Namespace + "/" + a.RuleName
+}
+
+// HasMetadata returns true if the rule that generated this alert
+// defined any of its description, owner, runbook URL, severity
+// or labels.
+func (a *Alert) HasMetadata() bool {
+	return a.Description != "" || a.Owner != "" || a.RunbookURL != "" ||
+		a.Severity != "" || len(a.Labels) > 0
+}
+
+// SortedLabels returns the labels of this alert formatted as
+// "key=value" and sorted by key.
+func (a *Alert) SortedLabels() []string {
+	labels := make([]string, 0, len(a.Labels))
+	for _, k := range slices.Sorted(maps.Keys(a.Labels)) {
+		labels = append(labels, k+"="+a.Labels[k])
+	}
+	return labels
 }
 
 // Method is used to send alerts to some output.
 type Method interface {
-	Write(context.Context, string, []*Record) error
+	Write(context.Context, *Alert) error
 }
 
 // HandlerConfig is used to provide the logger
 // with which the alert handlers will log messages.
 type HandlerConfig struct {
 	Logger hclog.Logger
+
+	// DeadLetters records the alerts that could not be sent
+	// to one of their outputs. If nil, such alerts are only
+	// logged
+	DeadLetters DeadLetterSink
+
+	// History records what became of every alert once it has
+	// been sent with each of its methods. If nil, it is not
+	// recorded
+	History HistorySink
+
+	// Journal durably records the alerts until they have been
+	// sent so that those still pending when the program stopped
+	// are sent when Run() is called. If nil, alerts are only
+	// kept in memory
+	Journal Journal
+
+	// Resolve returns the Method built from the output so that
+	// pending alerts can be sent after a restart. It is required
+	// if Journal is set
+	Resolve func(*Alert, *Output) (Method, error)
+
+	// Workers is the number of goroutines sending alerts to
+	// each output. It defaults to 1
+	Workers int
+
+	// QueueSize is the number of alerts that may be waiting to
+	// be sent to each output. It defaults to 100
+	QueueSize int
+
+	// QueueTimeout is how long an alert waits for room in the
+	// queue of an output that is full before it is not sent to
+	// that output. It defaults to 5 seconds
+	QueueTimeout time.Duration
+
+	// DrainTimeout is how long Run() waits for the alerts that
+	// are queued or being sent to be sent before it returns. It
+	// defaults to 10 seconds
+	DrainTimeout time.Duration
 }
 
 // Handler is used to send alerts to various outputs.
 type Handler struct {
-	logger hclog.Logger
-	rand   *rand.Rand
+	logger       hclog.Logger
+	rand         *rand.Rand
+	deadLetters  DeadLetterSink
+	history      HistorySink
+	journal      Journal
+	resolve      func(*Alert, *Output) (Method, error)
+	workers      int
+	queueSize    int
+	queueTimeout time.Duration
+	idleTimeout  time.Duration
+	drainTimeout time.Duration
+	active       *inventory
+
+	// stopping is closed when the handler starts draining so that
+	// deliveries waiting for room in a queue stop waiting
+	stopping chan struct{}
+
+	// mutex guards the fields below it
+	mutex    sync.Mutex
+	queues   map[string]*queue
+	retries  map[*delivery]*time.Timer
+	buckets  map[string]*bucket
+	groups   map[string]*group
+	tracked  map[string]*tracked
+	draining bool
+
+	// workerWG and retryWG track the workers and the deliveries
+	// waiting to be retried, for a rate limit or for a group.
+	// enqueueWG tracks the deliveries waiting for room in a queue
+	workerWG  sync.WaitGroup
+	retryWG   sync.WaitGroup
+	enqueueWG sync.WaitGroup
 
 	// StopCh is used to terminate the Run() loop
 	StopCh chan struct{}
@@ -111,81 +262,206 @@ type Handler struct {
 // NewHandler creates a new *Handler instance.
 func NewHandler(config *HandlerConfig) *Handler {
 	return &Handler{
-		logger: config.Logger,
-		rand:   rand.New(rand.NewSource(int64(time.Now().Nanosecond()))), //nolint:gosec
-		StopCh: make(chan struct{}),
-		DoneCh: make(chan struct{}),
+		logger:       config.Logger,
+		rand:         rand.New(rand.NewSource(int64(time.Now().Nanosecond()))), //nolint:gosec
+		deadLetters:  config.DeadLetters,
+		history:      config.History,
+		journal:      config.Journal,
+		resolve:      config.Resolve,
+		workers:      cmp.Or(config.Workers, defaultWorkers),
+		queueSize:    cmp.Or(config.QueueSize, defaultQueueSize),
+		queueTimeout: cmp.Or(config.QueueTimeout, defaultQueueTimeout),
+		idleTimeout:  defaultIdleTimeout,
+		drainTimeout: cmp.Or(config.DrainTimeout, defaultDrainTimeout),
+		active:       newInventory(),
+		stopping:     make(chan struct{}),
+		queues:       make(map[string]*queue),
+		retries:      make(map[*delivery]*time.Timer),
+		buckets:      make(map[string]*bucket),
+		groups:       make(map[string]*group),
+		tracked:      make(map[string]*tracked),
+		StopCh:       make(chan struct{}),
+		DoneCh:       make(chan struct{}),
 	}
 }
 
 // Run starts the *AlertHandler running. Once started, it
 // waits to receive a new *Alert from outputCh. When it
-// receives the alert, it will attempt to send the alert
-// with the AlertMethods included in the alert. If it fails,
-// it will backoff for a few seconds before trying to send
-// the alert twice more. If it fails all three attempts, it
-// will quit trying to send the alert. Run will return if
-// ctx.Done() or StopCh becomes unblocked. Before returning,
-// it will close the DoneCh. Once DoneCh is closed, Run
-// should not be called again.
-func (a *Handler) Run(ctx context.Context, outputCh <-chan *Alert) { //nolint:gocyclo,gocognit
+// receives the alert, it will queue the alert to be sent
+// with each of the AlertMethods included in the alert, skipping
+// any method implementing Router whose route the alert does not
+// match. Alerts to be sent with a method that has a Grouping are
+// held and sent as one alert along with the others of their group.
+// Each output has its own queue and workers so that a slow
+// output does not delay the others. Alerts wait for a while for
+// room in the queue of an output that is full, and workers stop
+// once their output has had nothing to send for some time. If sending fails, the alert
+// is sent again after a backoff per the RetryPolicy of the method
+// (by default, it waits a few seconds and tries twice more). Once
+// every attempt has failed, the deadline of the policy has passed
+// or the method returned an error marked with Permanent(), it
+// will quit trying to send the alert and record it with the
+// DeadLetterSink, if any. Once the outcome of sending an alert
+// with each of its methods is known, it is recorded with the
+// HistorySink, if any. If the Handler has a Journal, each
+// alert is recorded with it before it is sent and the alerts it
+// holds from before Run was called are sent first. Run will
+// return if ctx.Done() or StopCh becomes unblocked, once the
+// alerts left in outputCh, queued or being sent have been sent
+// or the drain timeout has passed. Before returning, it will close the
+// DoneCh. Once DoneCh is closed, Run should not be called again.
+func (a *Handler) Run(ctx context.Context, outputCh <-chan *Alert) {
 	defer func() {
 		close(a.DoneCh)
 	}()
 
 	a.logger.Info("Starting alert handler")
 
-	alertCh := make(chan func() (int, error), 8)
-	active := newInventory()
+	// Alerts are sent with their own context so that those being
+	// sent when ctx is canceled can still be sent while draining
+	sendCtx, cancelSends := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelSends()
 
-	alertFunc := func(ctx context.Context, alertID, rule string, method Method, records []*Record) func() (int, error) {
-		return func() (int, error) {
-			if active.remaining(alertID) < 1 {
-				active.deregister(alertID)
-				return 0, nil
-			}
-			active.decrement(alertID)
-			err := method.Write(ctx, rule, records)
-			return active.remaining(alertID), err
+	if pending := a.pendingDeliveries(sendCtx); len(pending) > 0 {
+		a.logger.Info(fmt.Sprintf("sending %d alerts queued before the last restart", len(pending)))
+		for _, d := range pending {
+			a.enqueue(sendCtx, d, ctx.Done())
 		}
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
+			a.dispatchBuffered(sendCtx, outputCh)
+			a.drain(sendCtx, cancelSends)
 			return
 		case <-a.StopCh:
+			a.dispatchBuffered(sendCtx, outputCh)
+			a.drain(sendCtx, cancelSends)
 			return
 		case alert := <-outputCh:
-			a.logger.Info(fmt.Sprintf("new query results received from rule %q", alert.RuleName))
-			for i, method := range alert.Methods {
-				alertMethodID := fmt.Sprintf("%d|%s", i, alert.ID)
-				active.register(alertMethodID)
-				alertCh <- alertFunc(ctx, alertMethodID, alert.RuleName, method, alert.Records)
-			}
-		case writeAlert := <-alertCh:
-			select {
-			case <-ctx.Done():
+			a.dispatch(sendCtx, alert)
+		}
+	}
+}
+
+// dispatch queues the alert to be sent with each of its methods
+// whose route it matches.
+func (a *Handler) dispatch(ctx context.Context, alert *Alert) {
+	a.logger.Info(fmt.Sprintf("new query results received from rule %q", alert.QualifiedName()))
+	matched := make(map[int]Method, len(alert.Methods))
+	for i, method := range alert.Methods {
+		if r, ok := as[Router](method); ok && !r.Matches(alert) {
+			continue
+		}
+		matched[i] = method
+	}
+	outputs := make(map[int]*Output, len(matched))
+	for i, method := range matched {
+		outputs[i] = OutputOf(method)
+	}
+	a.record(alert, outputs)
+	a.track(ctx, alert, outputs)
+	for _, i := range slices.Sorted(maps.Keys(matched)) {
+		d := a.newDelivery(i, matched[i], alert)
+		if !a.group(ctx, d) {
+			a.enqueue(ctx, d, nil)
+		}
+	}
+}
+
+// dispatchBuffered dispatches the alerts left in outputCh when the
+// handler is shutting down so that they are sent while draining or,
+// if the handler has a journal, after a restart.
+func (a *Handler) dispatchBuffered(ctx context.Context, outputCh <-chan *Alert) {
+	for {
+		select {
+		case alert, ok := <-outputCh:
+			if !ok {
 				return
-			default:
 			}
+			a.dispatch(ctx, alert)
+		default:
+			return
+		}
+	}
+}
+
+// record adds the alert to the journal, if any, along with the
+// outputs of the methods with which it is to be sent. Methods that
+// were not built from an output cannot be recorded.
+func (a *Handler) record(alert *Alert, outputs map[int]*Output) {
+	if a.journal == nil {
+		return
+	}
+
+	outputs = maps.Clone(outputs)
+	maps.DeleteFunc(outputs, func(_ int, output *Output) bool {
+		return output == nil
+	})
+	if err := a.journal.Add(alert, outputs); err != nil {
+		a.logger.Error(fmt.Sprintf("error queueing alert from rule %q", alert.QualifiedName()), "error", err)
+	}
+}
+
+// ack records with the journal, if any, that the alert no longer
+// needs to be sent with the method at the given index.
+func (a *Handler) ack(alert *Alert, index int) {
+	if a.journal == nil {
+		return
+	}
+
+	if err := a.journal.Ack(alert.ID, index); err != nil {
+		a.logger.Error(fmt.Sprintf("error acknowledging alert from rule %q", alert.QualifiedName()), "error", err)
+	}
+}
 
-			n, err := writeAlert()
+// pendingDeliveries returns the deliveries of the alerts the journal,
+// if any, holds from before Run was called.
+func (a *Handler) pendingDeliveries(ctx context.Context) []*delivery {
+	if a.journal == nil || a.resolve == nil {
+		return nil
+	}
+
+	var deliveries []*delivery
+	for _, p := range a.journal.Pending() {
+		a.track(ctx, p.Alert, p.Outputs)
+		for _, i := range slices.Sorted(maps.Keys(p.Outputs)) {
+			method, err := a.resolve(p.Alert, p.Outputs[i])
 			if err != nil {
-				backoff := a.newBackoff()
-				a.logger.Error("error returned by alert function", "error", err,
-					"remaining_retries", n, "backoff", backoff.String())
-				select {
-				case <-ctx.Done():
-					return
-				case <-time.After(backoff):
-					alertCh <- writeAlert
-				}
+				a.deadLetter(ctx, p.Outputs[i], p.Alert, err)
+				a.ack(p.Alert, i)
+				a.complete(ctx, p.Alert, i, DeliveryFailed, 0, err)
+				continue
 			}
+			deliveries = append(deliveries, a.newDelivery(i, WithOutput(method, p.Outputs[i]), p.Alert))
 		}
 	}
+	return deliveries
 }
 
-func (a *Handler) newBackoff() time.Duration {
-	return 2*time.Second + time.Duration(a.rand.Int63()%int64(time.Second*2)-int64(time.Second))
+// deadLetter records that the alert could not be sent to the
+// output.
+func (a *Handler) deadLetter(ctx context.Context, output *Output, alert *Alert, err error) {
+	a.logger.Error(fmt.Sprintf("giving up sending alert from rule %q", alert.QualifiedName()), "error", err)
+	if a.deadLetters == nil {
+		return
+	}
+
+	id, uuidErr := uuid.GenerateUUID()
+	if uuidErr != nil {
+		a.logger.Error("error creating new random UUID", "error", uuidErr)
+		return
+	}
+
+	letter := &DeadLetter{
+		ID:       id,
+		Alert:    alert,
+		Output:   output,
+		Error:    err.Error(),
+		FailedAt: time.Now(),
+	}
+	if err := a.deadLetters.Add(ctx, letter); err != nil {
+		a.logger.Error(fmt.Sprintf("error recording undelivered alert from rule %q", alert.QualifiedName()), "error", err)
+	}
 }
@@ -44,7 +44,7 @@ type fileAlertMethod struct {
 	outputFilepath string
 }
 
-func (f *fileAlertMethod) Write(ctx context.Context, rule string, records []*Record) error {
+func (f *fileAlertMethod) Write(ctx context.Context, a *Alert) error {
 	outfile, err := os.OpenFile(f.outputFilepath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
 	if err != nil {
 		return xerrors.Errorf("error opening new file: %v", err)
@@ -52,9 +52,9 @@ func (f *fileAlertMethod) Write(ctx context.Context, rule string, records []*Rec
 	defer outfile.Close()
 
 	entry := OutputJSON{
-		RuleName:   rule,
+		RuleName:   a.RuleName,
 		ReceivedAt: time.Now(),
-		Records:    records,
+		Records:    a.Records,
 	}
 	return json.NewEncoder(outfile).Encode(&entry)
 }
@@ -63,7 +63,7 @@ func (f *fileAlertMethod) Write(ctx context.Context, rule string, records []*Rec
 // even where AlertMethod.Write() return an error.
 type errorAlertMethod struct{}
 
-func (e *errorAlertMethod) Write(ctx context.Context, rule string, records []*Record) error {
+func (e *errorAlertMethod) Write(ctx context.Context, a *Alert) error {
 	return xerrors.Errorf("test error")
 }
 
@@ -144,8 +144,18 @@ func TestRun(t *testing.T) {
 	}
 }
 
+// chanDeadLetterSink is a mock alert.DeadLetterSink that sends
+// dead letters on a channel.
+type chanDeadLetterSink chan *DeadLetter
+
+func (c chanDeadLetterSink) Add(ctx context.Context, d *DeadLetter) error {
+	c <- d
+	return nil
+}
+
 func TestRunError(t *testing.T) {
 	outputCh := make(chan *Alert, 1)
+	deadLetters := make(chanDeadLetterSink, 1)
 
 	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
 
@@ -154,10 +164,12 @@ func TestRunError(t *testing.T) {
 		Output: buf,
 	})
 	ah := NewHandler(&HandlerConfig{
-		Logger: logger,
+		Logger:      logger,
+		DeadLetters: deadLetters,
 	})
 
-	em := &errorAlertMethod{}
+	output := &Output{Field: "outputs", Index: 0, Type: "error"}
+	em := WithOutput(&errorAlertMethod{}, output)
 
 	a := &Alert{
 		ID:       randomUUID(t),
@@ -201,6 +213,103 @@ func TestRunError(t *testing.T) {
 	if !strings.Contains(buf.String(), expected) {
 		t.Fatalf("Expected errors to contain:\n\t%s\nGot:\n\t%s", expected, buf.String())
 	}
+
+	select {
+	case d := <-deadLetters:
+		if d.Alert.ID != a.ID {
+			t.Errorf("dead letter alert ID mismatch (got %q, expected %q)", d.Alert.ID, a.ID)
+		}
+		if d.Output != output {
+			t.Errorf("dead letter output mismatch (got %+v, expected %+v)", d.Output, output)
+		}
+		if d.Error != "test error" {
+			t.Errorf("dead letter error mismatch (got %q, expected \"test error\")", d.Error)
+		}
+	default:
+		t.Fatal("expected the alert to be dead-lettered")
+	}
+	if len(deadLetters) != 0 {
+		t.Fatal("expected only one dead letter")
+	}
+}
+
+func TestDeadLetterJSON(t *testing.T) {
+	want := &DeadLetter{
+		ID: randomUUID(t),
+		Alert: &Alert{
+			ID:       randomUUID(t),
+			RuleName: "test-rule",
+			Severity: "critical",
+			Labels:   map[string]string{"team": "a"},
+			Records: []*Record{
+				{
+					Filter:    "hits.hits._source",
+					Text:      "test text",
+					Summary:   "test",
+					BodyField: true,
+				},
+				{
+					Filter: "aggregations.hostname.buckets",
+					Fields: []*Field{{Key: "foo", Count: 2}},
+				},
+			},
+		},
+		Output:   &Output{Field: "outputs", Index: 1, Type: "slack"},
+		Error:    "test error",
+		FailedAt: time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	data, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := new(DeadLetter)
+	if err = json.Unmarshal(data, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.ID != want.ID || got.Error != want.Error || !got.FailedAt.Equal(want.FailedAt) {
+		t.Errorf("dead letter mismatch (got %+v, expected %+v)", got, want)
+	}
+	if *got.Output != *want.Output {
+		t.Errorf("output mismatch (got %+v, expected %+v)", got.Output, want.Output)
+	}
+	if got.Alert.ID != want.Alert.ID || got.Alert.RuleName != want.Alert.RuleName ||
+		got.Alert.Severity != want.Alert.Severity || got.Alert.Labels["team"] != "a" {
+		t.Errorf("alert mismatch (got %+v, expected %+v)", got.Alert, want.Alert)
+	}
+	if len(got.Alert.Records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(got.Alert.Records))
+	}
+	body := got.Alert.Records[0]
+	if !body.BodyField || body.Summary != "test" || body.Text != "test text" {
+		t.Errorf("body record mismatch: %+v", body)
+	}
+	if fields := got.Alert.Records[1].Fields; len(fields) != 1 || fields[0].Key != "foo" || fields[0].Count != 2 {
+		t.Errorf("fields mismatch: %+v", fields)
+	}
+}
+
+func TestOutputOf(t *testing.T) {
+	output := &Output{Field: "error_outputs", Index: 0, Type: "file"}
+	route := &Route{Severities: []string{"critical"}}
+
+	method := WithOutput(NewRoutedMethod(&errorAlertMethod{}, route), output)
+	if OutputOf(method) != output {
+		t.Errorf("unexpected output: %+v", OutputOf(method))
+	}
+	if OutputOf(&errorAlertMethod{}) != nil {
+		t.Error("expected no output for an unwrapped method")
+	}
+
+	r, ok := as[Router](method)
+	if !ok {
+		t.Fatal("expected the method to be a Router")
+	}
+	if r.Matches(&Alert{Severity: "warning"}) || !r.Matches(&Alert{Severity: "critical"}) {
+		t.Error("the route of the wrapped method was not applied")
+	}
 }
 
 func randomUUID(t *testing.T) string {
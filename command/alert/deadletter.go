@@ -0,0 +1,131 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Output identifies the output in the configuration files from
+// which a Method was built so that alerts it failed to send can
+// later be replayed through it.
+type Output struct {
+	// Field is the field of the configuration file in which the
+	// output is defined (e.g. "outputs" or "error_outputs")
+	Field string `json:"field"`
+
+	// Index is the position of the output in that field
+	Index int `json:"index"`
+
+	// Type is the type of the output (e.g. "slack")
+	Type string `json:"type"`
+}
+
+// outputMethod wraps a Method with the Output it was built from.
+type outputMethod struct {
+	Method
+	output *Output
+}
+
+// WithOutput returns a Method that writes alerts with the provided
+// method and that OutputOf() reports was built from output.
+func WithOutput(method Method, output *Output) Method {
+	return &outputMethod{
+		Method: method,
+		output: output,
+	}
+}
+
+// OutputOf returns the Output from which method was built, or nil
+// if it was not wrapped with WithOutput().
+func OutputOf(method Method) *Output {
+	if m, ok := as[*outputMethod](method); ok {
+		return m.output
+	}
+	return nil
+}
+
+func (o *outputMethod) Unwrap() Method {
+	return o.Method
+}
+
+func (o *outputMethod) Write(ctx context.Context, a *Alert) error {
+	return o.Method.Write(ctx, a)
+}
+
+// DeadLetter is an alert that could not be sent to one of its
+// outputs after every attempt failed.
+type DeadLetter struct {
+	// ID is a unique UUID string identifying this dead letter
+	ID string
+
+	// Alert is the alert that could not be sent
+	Alert *Alert
+
+	// Output is the output to which the alert could not be sent.
+	// It is nil if the Method was not built from the configuration
+	// files, in which case the dead letter cannot be replayed
+	Output *Output
+
+	// Error is the error returned by the final attempt
+	Error string
+
+	// FailedAt is when the final attempt failed
+	FailedAt time.Time
+}
+
+// DeadLetterSink records alerts that could not be sent so that
+// they are not lost.
+type DeadLetterSink interface {
+	Add(context.Context, *DeadLetter) error
+}
+
+type deadLetterJSON struct {
+	ID string `json:"id"`
+	alertJSON
+	Output   *Output   `json:"output,omitempty"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// MarshalJSON encodes the dead letter along with its alert.
+func (d *DeadLetter) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&deadLetterJSON{
+		ID:        d.ID,
+		alertJSON: newAlertJSON(d.Alert),
+		Output:    d.Output,
+		Error:     d.Error,
+		FailedAt:  d.FailedAt,
+	})
+}
+
+// UnmarshalJSON decodes a dead letter encoded by MarshalJSON. The
+// alert it returns has no methods.
+func (d *DeadLetter) UnmarshalJSON(data []byte) error {
+	var v deadLetterJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*d = DeadLetter{
+		ID:       v.ID,
+		Alert:    v.alert(),
+		Output:   v.Output,
+		Error:    v.Error,
+		FailedAt: v.FailedAt,
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package deadletter provides places in which to keep the alerts
+// that could not be sent to their outputs until they are replayed.
+package deadletter
+
+import (
+	"context"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+)
+
+// Store is an alert.DeadLetterSink from which the dead letters
+// can be loaded and removed once they have been replayed.
+type Store interface {
+	alert.DeadLetterSink
+
+	// Load returns the dead letters in the order in which they
+	// were added
+	Load(context.Context) ([]*alert.DeadLetter, error)
+
+	// Remove removes the dead letters with the given IDs
+	Remove(ctx context.Context, ids []string) error
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/esclient"
+)
+
+const (
+	// maxLoad is the largest number of dead letters loaded from
+	// Elasticsearch at once
+	maxLoad = 10000
+)
+
+// Ensure ElasticsearchStore adheres to the Store interface.
+var _ Store = (*ElasticsearchStore)(nil)
+
+// ElasticsearchStoreConfig configures the Elasticsearch index in
+// which dead letters are kept.
+type ElasticsearchStoreConfig struct {
+	// Client is the *http.Client used to communicate with
+	// Elasticsearch
+	Client *http.Client
+
+	// URL is the URL of the Elasticsearch instance
+	URL string
+
+	// Username and Password are used to authenticate with
+	// Elasticsearch if Username is not empty
+	Username string
+	Password string
+
+	// Index is the index in which the dead letters are kept
+	Index string
+}
+
+// ElasticsearchStore keeps dead letters in an Elasticsearch index
+// with one document per dead letter.
+type ElasticsearchStore struct {
+	es    *esclient.Client
+	index string
+}
+
+// NewElasticsearchStore returns a new *ElasticsearchStore or a
+// non-nil error if there was an error.
+func NewElasticsearchStore(config *ElasticsearchStoreConfig) (*ElasticsearchStore, error) {
+	if config == nil {
+		config = &ElasticsearchStoreConfig{}
+	}
+
+	var allErrors *multierror.Error
+	if config.URL == "" {
+		allErrors = multierror.Append(allErrors, xerrors.New("no Elasticsearch URL provided"))
+	}
+	if config.Index == "" {
+		allErrors = multierror.Append(allErrors, xerrors.New("no Elasticsearch index provided"))
+	}
+	if err := allErrors.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	creds := esclient.Credentials{Username: config.Username, Password: config.Password}
+	return &ElasticsearchStore{
+		es:    esclient.New(config.Client, config.URL, creds),
+		index: config.Index,
+	}, nil
+}
+
+// Add indexes the dead letter as a document whose ID is the ID of
+// the dead letter.
+func (e *ElasticsearchStore) Add(ctx context.Context, d *alert.DeadLetter) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return xerrors.Errorf("error encoding dead letter: %v", err)
+	}
+
+	path := fmt.Sprintf("/%s/_doc/%s", e.index, url.PathEscape(d.ID))
+	if _, err = e.es.Do(ctx, http.MethodPut, path, data); err != nil {
+		return xerrors.Errorf("error indexing dead letter: %v", err)
+	}
+	return nil
+}
+
+// Load searches the index for the dead letters, oldest first. If
+// the index does not exist, there are no dead letters.
+func (e *ElasticsearchStore) Load(ctx context.Context) ([]*alert.DeadLetter, error) {
+	body, err := json.Marshal(map[string]any{
+		"size": maxLoad,
+		"sort": []any{map[string]any{"failed_at": "asc"}},
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("error encoding search: %v", err)
+	}
+
+	data, err := e.es.Do(ctx, http.MethodPost, fmt.Sprintf("/%s/_search", e.index), body)
+	if errors.Is(err, esclient.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("error searching for dead letters: %v", err)
+	}
+
+	var resp struct {
+		Hits struct {
+			Hits []struct {
+				Source *alert.DeadLetter `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return nil, xerrors.Errorf("error decoding dead letters: %v", err)
+	}
+
+	letters := make([]*alert.DeadLetter, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		if hit.Source != nil {
+			letters = append(letters, hit.Source)
+		}
+	}
+	return letters, nil
+}
+
+// Remove deletes the documents of the dead letters with the given
+// IDs.
+func (e *ElasticsearchStore) Remove(ctx context.Context, ids []string) error {
+	for _, id := range ids {
+		path := fmt.Sprintf("/%s/_doc/%s", e.index, url.PathEscape(id))
+		_, err := e.es.Do(ctx, http.MethodDelete, path, nil)
+		if err != nil && !errors.Is(err, esclient.ErrNotFound) {
+			return xerrors.Errorf("error deleting dead letter %s: %v", id, err)
+		}
+	}
+	return nil
+}
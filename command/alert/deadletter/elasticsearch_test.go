@@ -0,0 +1,119 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package deadletter
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestElasticsearchStore(t *testing.T) {
+	var (
+		mutex sync.Mutex
+		docs  = make(map[string]json.RawMessage)
+		order []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if user, pass, _ := r.BasicAuth(); user != "elastic" || pass != "changeme" {
+			t.Errorf("unexpected credentials: %q, %q", user, pass)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/dead-letters/_doc/"):
+			id := strings.TrimPrefix(r.URL.Path, "/dead-letters/_doc/")
+			data, _ := io.ReadAll(r.Body)
+			docs[id] = data
+			order = append(order, id)
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/dead-letters/_doc/"):
+			id := strings.TrimPrefix(r.URL.Path, "/dead-letters/_doc/")
+			if _, ok := docs[id]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(docs, id)
+		case r.Method == http.MethodPost && r.URL.Path == "/dead-letters/_search":
+			if len(order) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			hits := []any{}
+			for _, id := range order {
+				if doc, ok := docs[id]; ok {
+					hits = append(hits, map[string]any{"_id": id, "_source": doc})
+				}
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"hits": map[string]any{"hits": hits}})
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := t.Context()
+
+	store, err := NewElasticsearchStore(&ElasticsearchStoreConfig{
+		Client:   ts.Client(),
+		URL:      ts.URL + "/",
+		Username: "elastic",
+		Password: "changeme",
+		Index:    "dead-letters",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	letters, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 0 {
+		t.Fatalf("expected no dead letters before the index exists, got %d", len(letters))
+	}
+
+	for _, id := range []string{"1", "2"} {
+		if err = store.Add(ctx, newDeadLetter(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = store.Remove(ctx, []string{"1", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	letters, err = store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].ID != "2" || letters[0].Alert.ID != "alert-2" {
+		t.Fatalf("unexpected dead letters: %+v", letters)
+	}
+}
+
+func TestNewElasticsearchStore_Errors(t *testing.T) {
+	if _, err := NewElasticsearchStore(nil); err == nil {
+		t.Fatal("expected an error")
+	}
+}
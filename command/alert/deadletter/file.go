@@ -0,0 +1,156 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+)
+
+// Ensure FileStore adheres to the Store interface.
+var _ Store = (*FileStore)(nil)
+
+// FileStore keeps dead letters in a file with one JSON object
+// per line.
+type FileStore struct {
+	path  string
+	mutex sync.Mutex
+}
+
+// NewFileStore returns a new *FileStore that keeps dead letters
+// in the file at path or a non-nil error if there was an error.
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, xerrors.New("no file path provided")
+	}
+
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return nil, xerrors.Errorf("error expanding file path %q: %v", path, err)
+	}
+	return &FileStore{path: expanded}, nil
+}
+
+// Add appends the dead letter to the file.
+func (f *FileStore) Add(_ context.Context, d *alert.DeadLetter) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return xerrors.Errorf("error encoding dead letter: %v", err)
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return xerrors.Errorf("error opening dead letter file: %v", err)
+	}
+	defer file.Close()
+
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		return xerrors.Errorf("error writing dead letter file: %v", err)
+	}
+	return nil
+}
+
+// Load reads the dead letters from the file. If the file does not
+// exist, there are no dead letters.
+func (f *FileStore) Load(_ context.Context) ([]*alert.DeadLetter, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.load()
+}
+
+func (f *FileStore) load() ([]*alert.DeadLetter, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("error reading dead letter file: %v", err)
+	}
+
+	var letters []*alert.DeadLetter
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		d := new(alert.DeadLetter)
+		if err := json.Unmarshal(scanner.Bytes(), d); err != nil {
+			return nil, xerrors.Errorf("error decoding line %d of dead letter file: %v", line, err)
+		}
+		letters = append(letters, d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, xerrors.Errorf("error reading dead letter file: %v", err)
+	}
+	return letters, nil
+}
+
+// Remove rewrites the file without the dead letters with the
+// given IDs.
+func (f *FileStore) Remove(_ context.Context, ids []string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	letters, err := f.load()
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, d := range letters {
+		if slices.Contains(ids, d.ID) {
+			continue
+		}
+		data, err := json.Marshal(d)
+		if err != nil {
+			return xerrors.Errorf("error encoding dead letter: %v", err)
+		}
+		buf.Write(append(data, '\n'))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return xerrors.Errorf("error creating temporary dead letter file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return xerrors.Errorf("error writing temporary dead letter file: %v", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return xerrors.Errorf("error writing temporary dead letter file: %v", err)
+	}
+	if err = os.Rename(tmp.Name(), f.path); err != nil {
+		return xerrors.Errorf("error replacing dead letter file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package deadletter
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+)
+
+func newDeadLetter(id string) *alert.DeadLetter {
+	return &alert.DeadLetter{
+		ID: id,
+		Alert: &alert.Alert{
+			ID:       "alert-" + id,
+			RuleName: "test-rule",
+			Records:  []*alert.Record{{Filter: "hits.hits._source", Text: "test text", BodyField: true}},
+		},
+		Output:   &alert.Output{Field: "outputs", Index: 0, Type: "slack"},
+		Error:    "test error",
+		FailedAt: time.Now(),
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := t.Context()
+
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "dead-letters.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	letters, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 0 {
+		t.Fatalf("expected no dead letters before any were added, got %d", len(letters))
+	}
+
+	for _, id := range []string{"1", "2", "3"} {
+		if err = store.Add(ctx, newDeadLetter(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = store.Remove(ctx, []string{"2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	letters, err = store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 2 || letters[0].ID != "1" || letters[1].ID != "3" {
+		t.Fatalf("unexpected dead letters after removal: %+v", letters)
+	}
+
+	d := letters[0]
+	if d.Alert.ID != "alert-1" || d.Output.Type != "slack" || d.Error != "test error" {
+		t.Errorf("unexpected dead letter: %+v", d)
+	}
+	if len(d.Alert.Records) != 1 || !d.Alert.Records[0].BodyField {
+		t.Errorf("unexpected records: %+v", d.Alert.Records)
+	}
+}
+
+func TestNewFileStore_NoPath(t *testing.T) {
+	if _, err := NewFileStore(""); err == nil {
+		t.Fatal("expected an error")
+	}
+}
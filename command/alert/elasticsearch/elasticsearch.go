@@ -0,0 +1,267 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/esclient"
+)
+
+const (
+	defaultMaxRetries = 3
+	defaultBackoff    = time.Second
+)
+
+// Ensure AlertMethod adheres to the alert.Method interface.
+var _ alert.Method = (*AlertMethod)(nil)
+
+// document is how an alert is indexed.
+type document struct {
+	Timestamp       time.Time         `json:"@timestamp"`
+	AlertID         string            `json:"alert_id"`
+	RuleName        string            `json:"rule_name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	Owner           string            `json:"owner,omitempty"`
+	RunbookURL      string            `json:"runbook_url,omitempty"`
+	Severity        string            `json:"severity,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	ConditionGroups []string          `json:"condition_groups,omitempty"`
+	Records         []*alert.Record   `json:"results"`
+}
+
+func newDocument(a *alert.Alert, timestamp time.Time) *document {
+	return &document{
+		Timestamp:       timestamp,
+		AlertID:         a.ID,
+		RuleName:        a.RuleName,
+		Namespace:       a.Namespace,
+		Description:     a.Description,
+		Owner:           a.Owner,
+		RunbookURL:      a.RunbookURL,
+		Severity:        a.Severity,
+		Labels:          a.Labels,
+		ConditionGroups: a.ConditionGroups,
+		Records:         a.Records,
+	}
+}
+
+// AlertMethodConfig configures the Elasticsearch index or data
+// stream into which alerts are indexed.
+type AlertMethodConfig struct {
+	// URL is the URL of the Elasticsearch cluster
+	URL string `mapstructure:"url"`
+
+	// Index is the index, alias or data stream into which the
+	// alerts are indexed
+	Index string `mapstructure:"index"`
+
+	// DataStream is whether Index is a data stream, to which
+	// documents can only be added with "create" actions
+	DataStream bool `mapstructure:"data_stream"`
+
+	// Username and Password are used to authenticate with the
+	// cluster if Username is not empty
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+
+	// MaxRetries is the number of times the documents rejected
+	// by Elasticsearch because it was overloaded are indexed
+	// again. It defaults to 3
+	MaxRetries int `mapstructure:"max_retries"`
+
+	Client *http.Client
+}
+
+// AlertMethod implements the alert.AlertMethod interface
+// for indexing new alerts into Elasticsearch.
+type AlertMethod struct {
+	es         *esclient.Client
+	index      string
+	action     string
+	maxRetries int
+	backoff    time.Duration
+}
+
+// NewAlertMethod returns a new *AlertMethod or a non-nil
+// error if there was an error.
+func NewAlertMethod(config *AlertMethodConfig) (alert.Method, error) {
+	if config == nil {
+		return nil, xerrors.New("no config provided")
+	}
+
+	var allErrors *multierror.Error
+	if config.URL == "" {
+		allErrors = multierror.Append(allErrors,
+			xerrors.New("field 'output.config.url' must not be empty when using the Elasticsearch output method"))
+	}
+	if config.Index == "" {
+		allErrors = multierror.Append(allErrors,
+			xerrors.New("field 'output.config.index' must not be empty when using the Elasticsearch output method"))
+	}
+	if config.MaxRetries < 0 {
+		allErrors = multierror.Append(allErrors,
+			xerrors.New("field 'output.config.max_retries' must not be negative"))
+	}
+	if err := allErrors.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	action := "index"
+	if config.DataStream {
+		action = "create"
+	}
+
+	return &AlertMethod{
+		es: esclient.New(config.Client, config.URL, esclient.Credentials{
+			Username: config.Username,
+			Password: config.Password,
+		}),
+		index:      config.Index,
+		action:     action,
+		maxRetries: cmp.Or(config.MaxRetries, defaultMaxRetries),
+		backoff:    defaultBackoff,
+	}, nil
+}
+
+// Write indexes the alert, or each of the alerts of its group, as
+// a document whose ID is the ID of the alert using a bulk request.
+// Documents rejected because Elasticsearch was overloaded are
+// indexed again after a backoff, up to MaxRetries times. Since the
+// IDs of the documents are those of the alerts, sending an alert
+// again does not index it twice. If any document could not be
+// indexed, it returns a non-nil error, which is permanent if
+// indexing it again would not help.
+func (e *AlertMethod) Write(ctx context.Context, a *alert.Alert) error {
+	now := time.Now()
+	pending := make([]*document, 0, len(a.Alerts()))
+	for _, member := range a.Alerts() {
+		pending = append(pending, newDocument(member, now))
+	}
+
+	var rejected []string
+	for attempt := 0; ; attempt++ {
+		retry, errs, err := e.bulk(ctx, pending)
+		if err != nil {
+			return err
+		}
+		rejected = append(rejected, errs...)
+
+		if len(retry) == 0 || attempt == e.maxRetries {
+			if len(retry) > 0 {
+				return xerrors.Errorf("%d of %d documents rejected by Elasticsearch", len(retry), len(a.Alerts()))
+			}
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.backoff << attempt):
+		}
+		pending = retry
+	}
+
+	if len(rejected) > 0 {
+		return alert.Permanent(xerrors.Errorf("error indexing alert: %s", strings.Join(rejected, "; ")))
+	}
+	return nil
+}
+
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// bulk indexes the documents with a bulk request. It returns the
+// documents that should be indexed again and the errors of those
+// that could not be indexed.
+func (e *AlertMethod) bulk(ctx context.Context, docs []*document) ([]*document, []string, error) {
+	body := new(bytes.Buffer)
+	enc := json.NewEncoder(body)
+	for _, doc := range docs {
+		action := map[string]any{
+			e.action: map[string]any{
+				"_index": e.index,
+				"_id":    doc.AlertID,
+			},
+		}
+		if err := enc.Encode(action); err != nil {
+			return nil, nil, xerrors.Errorf("error JSON-encoding bulk action: %v", err)
+		}
+		if err := enc.Encode(doc); err != nil {
+			return nil, nil, xerrors.Errorf("error JSON-encoding document: %v", err)
+		}
+	}
+
+	data, err := e.es.Bulk(ctx, body.Bytes())
+	var statusErr *esclient.StatusError
+	if errors.Is(err, esclient.ErrNotFound) ||
+		(errors.As(err, &statusErr) && statusErr.StatusCode < 500 && statusErr.StatusCode != http.StatusTooManyRequests) {
+		// The URL, the credentials or the request are bad, so
+		// indexing the documents again would not help
+		return nil, nil, alert.Permanent(err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var bulk bulkResponse
+	if err = json.Unmarshal(data, &bulk); err != nil {
+		return nil, nil, xerrors.Errorf("error JSON-decoding response body: %v", err)
+	}
+	if !bulk.Errors {
+		return nil, nil, nil
+	}
+	if len(bulk.Items) != len(docs) {
+		return nil, nil, xerrors.Errorf("expected %d items in bulk response, got %d", len(docs), len(bulk.Items))
+	}
+
+	var (
+		retry []*document
+		errs  []string
+	)
+	for i, item := range bulk.Items {
+		result := item[e.action]
+		switch {
+		case result.Error == nil,
+			// The document was created by an earlier attempt
+			result.Status == http.StatusConflict && e.action == "create":
+		case result.Status == http.StatusTooManyRequests || result.Status >= 500:
+			retry = append(retry, docs[i])
+		default:
+			errs = append(errs, fmt.Sprintf("%s: %s", result.Error.Type, result.Error.Reason))
+		}
+	}
+	return retry, errs, nil
+}
@@ -0,0 +1,277 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+)
+
+func TestNewAlertMethod(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *AlertMethodConfig
+		err    bool
+	}{
+		{
+			"success",
+			&AlertMethodConfig{URL: "http://127.0.0.1:9200", Index: "alerts"},
+			false,
+		},
+		{
+			"no-config",
+			nil,
+			true,
+		},
+		{
+			"no-url",
+			&AlertMethodConfig{Index: "alerts"},
+			true,
+		},
+		{
+			"no-index",
+			&AlertMethodConfig{URL: "http://127.0.0.1:9200"},
+			true,
+		},
+		{
+			"negative-max-retries",
+			&AlertMethodConfig{URL: "http://127.0.0.1:9200", Index: "alerts", MaxRetries: -1},
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAlertMethod(tc.config)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected an error? %t (got %v)", tc.err, err)
+			}
+		})
+	}
+}
+
+// bulkServer is a mock Elasticsearch cluster that responds to
+// each document of a bulk request with the next of the statuses
+// listed for its ID, or 201 once there are none left.
+type bulkServer struct {
+	mutex    sync.Mutex
+	statuses map[string][]int
+	requests int
+	actions  []map[string]map[string]string
+	docs     map[string]map[string]any
+}
+
+func (b *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if r.Method != http.MethodPost || r.URL.Path != "/_bulk" {
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	if user, pass, _ := r.BasicAuth(); user != "elastic" || pass != "changeme" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	b.requests++
+
+	var (
+		items  []any
+		errors bool
+	)
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var action map[string]map[string]string
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil || !scanner.Scan() {
+			http.Error(w, "bad action", http.StatusBadRequest)
+			return
+		}
+		var doc map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			http.Error(w, "bad document", http.StatusBadRequest)
+			return
+		}
+		b.actions = append(b.actions, action)
+
+		for op, meta := range action {
+			status := http.StatusCreated
+			if s := b.statuses[meta["_id"]]; len(s) > 0 {
+				status, b.statuses[meta["_id"]] = s[0], s[1:]
+			}
+			result := map[string]any{"_id": meta["_id"], "status": status}
+			if status > 299 {
+				errors = true
+				result["error"] = map[string]any{"type": "test_exception", "reason": fmt.Sprintf("status %d", status)}
+			} else {
+				b.docs[meta["_id"]] = doc
+			}
+			items = append(items, map[string]any{op: result})
+		}
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]any{"errors": errors, "items": items})
+}
+
+func TestWrite(t *testing.T) {
+	cases := []struct {
+		name       string
+		dataStream bool
+		statuses   map[string][]int
+		requests   int
+		err        bool
+		permanent  bool
+	}{
+		{
+			name:     "indexed",
+			requests: 1,
+		},
+		{
+			name:     "retried",
+			statuses: map[string][]int{"alert-2": {429, 503}},
+			requests: 3,
+		},
+		{
+			name:     "retries-exhausted",
+			statuses: map[string][]int{"alert-2": {429, 429, 429}},
+			requests: 3,
+			err:      true,
+		},
+		{
+			name:      "rejected",
+			statuses:  map[string][]int{"alert-1": {400}},
+			requests:  1,
+			err:       true,
+			permanent: true,
+		},
+		{
+			name:       "already-created",
+			dataStream: true,
+			statuses:   map[string][]int{"alert-1": {409}},
+			requests:   1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			b := &bulkServer{statuses: tc.statuses, docs: make(map[string]map[string]any)}
+			ts := httptest.NewServer(b)
+			defer ts.Close()
+
+			method, err := NewAlertMethod(&AlertMethodConfig{
+				URL:        ts.URL + "/",
+				Index:      "alerts",
+				DataStream: tc.dataStream,
+				Username:   "elastic",
+				Password:   "changeme",
+				MaxRetries: 2,
+				Client:     ts.Client(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			method.(*AlertMethod).backoff = time.Millisecond
+
+			a := &alert.Alert{
+				RuleName: "2 alerts from 2 rules",
+				Group: []*alert.Alert{
+					{ID: "alert-1", RuleName: "rule-a", Labels: map[string]string{"team": "a"}},
+					{ID: "alert-2", RuleName: "rule-b", Records: []*alert.Record{{Filter: "hits.hits._source"}}},
+				},
+			}
+
+			err = method.Write(t.Context(), a)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected an error? %t (got %v)", tc.err, err)
+			}
+			if tc.permanent != alert.IsPermanent(err) {
+				t.Errorf("expected a permanent error? %t (got %v)", tc.permanent, err)
+			}
+			if b.requests != tc.requests {
+				t.Errorf("expected %d bulk requests, got %d", tc.requests, b.requests)
+			}
+
+			op := "index"
+			if tc.dataStream {
+				op = "create"
+			}
+			for _, action := range b.actions {
+				if action[op]["_index"] != "alerts" {
+					t.Errorf("unexpected bulk action: %v", action)
+				}
+			}
+
+			if tc.err {
+				return
+			}
+			// With a data stream, the first alert was indexed by
+			// an earlier attempt
+			if !tc.dataStream {
+				doc := b.docs["alert-1"]
+				if doc == nil || doc["rule_name"] != "rule-a" || doc["@timestamp"] == nil {
+					t.Errorf("unexpected document: %v", doc)
+				}
+				if labels, _ := json.Marshal(doc["labels"]); !strings.Contains(string(labels), `"team":"a"`) {
+					t.Errorf("expected the labels of the alert to be indexed, got %s", labels)
+				}
+			}
+			if _, ok := b.docs["alert-2"]; !ok {
+				t.Error("expected each alert of the group to be indexed")
+			}
+		})
+	}
+}
+
+func TestWrite_HTTPError(t *testing.T) {
+	cases := []struct {
+		name      string
+		status    int
+		permanent bool
+	}{
+		{"unauthorized", http.StatusUnauthorized, true},
+		{"not-found", http.StatusNotFound, true},
+		{"too-many-requests", http.StatusTooManyRequests, false},
+		{"unavailable", http.StatusServiceUnavailable, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tc.status)
+			}))
+			defer ts.Close()
+
+			method, err := NewAlertMethod(&AlertMethodConfig{URL: ts.URL, Index: "alerts", Client: ts.Client()})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = method.Write(t.Context(), &alert.Alert{ID: "alert-1", RuleName: "rule-a"})
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if tc.permanent != alert.IsPermanent(err) {
+				t.Errorf("expected a permanent error? %t (got %v)", tc.permanent, err)
+			}
+		})
+	}
+}
@@ -16,9 +16,12 @@ package email
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
+	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"os"
 	"strings"
 
@@ -114,27 +117,50 @@ func validateConfig(config *AlertMethodConfig) error {
 	return allErrors.ErrorOrNil()
 }
 
-// Write creates an email message from the records and sends
+// Write creates an email message from the alert and sends
 // it to the email address(es) specified at the creation of the
 // AlertMethod. If there was an error sending the email,
 // it returns a non-nil error.
-func (e *AlertMethod) Write(ctx context.Context, rule string, records []*alert.Record) error {
-	body, err := e.buildMessage(rule, records)
+func (e *AlertMethod) Write(ctx context.Context, a *alert.Alert) error {
+	// Sending the alert again would not fix a message that cannot
+	// be built or addresses that are not valid
+	body, err := e.buildMessage(a)
 	if err != nil {
-		return xerrors.Errorf("error creating email message: %v", err)
+		return alert.Permanent(xerrors.Errorf("error creating email message: %v", err))
 	}
-	return smtp.SendMail(fmt.Sprintf("%s:%d", e.host, e.port), e.auth, e.from, e.to, []byte(body))
+	for _, addr := range append([]string{e.from}, e.to...) {
+		if _, err := mail.ParseAddress(addr); err != nil {
+			return alert.Permanent(xerrors.Errorf("invalid email address %q: %v", addr, err))
+		}
+	}
+
+	err = smtp.SendMail(fmt.Sprintf("%s:%d", e.host, e.port), e.auth, e.from, e.to, []byte(body))
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code >= 500 {
+		// The SMTP server rejected the email for good (e.g. bad
+		// credentials or an unknown recipient)
+		return alert.Permanent(err)
+	}
+	return err
 }
 
-// buildMessage creates an email message from the provided
-// records. It will return a non-nil error if an error occurs.
-func (e *AlertMethod) buildMessage(rule string, records []*alert.Record) (string, error) {
+// buildMessage creates an email message from the records of the
+// provided alert, or of each alert of its group under a heading
+// naming its rule. It will return a non-nil error if an error occurs.
+func (e *AlertMethod) buildMessage(a *alert.Alert) (string, error) {
+	subject := "Go Elasticsearch Alerts: " + a.QualifiedName()
+	if a.Severity != "" {
+		subject = fmt.Sprintf("[%s] %s", strings.ToUpper(a.Severity), subject)
+	}
+
 	alert := struct {
-		Name    string
-		Records []*alert.Record
+		Subject string
+		Alerts  []*alert.Alert
+		Group   bool
 	}{
-		rule,
-		records,
+		subject,
+		a.Alerts(),
+		len(a.Group) > 0,
 	}
 
 	funcs := template.FuncMap{
@@ -145,7 +171,7 @@ func (e *AlertMethod) buildMessage(rule string, records []*alert.Record) (string
 	}
 
 	tpl := `Content-Type: text/html
-Subject: Go Elasticsearch Alerts: {{ .Name }}
+Subject: {{ .Subject }}
 
 <!DOCTYPE html>
 <html>
@@ -168,7 +194,31 @@ tr:nth-child(even) {
 </style>
 </head>
 <body>
-{{ range .Records }}<h4>Filter path: {{ .Filter }}</h4>{{ if .Fields }}
+{{ range .Alerts }}{{ if $.Group }}<h3>{{ .QualifiedName }}</h3>
+{{ end }}{{ if .HasMetadata }}<table>{{ if .Description }}
+  <tr>
+    <th>Description</th>
+    <td>{{ .Description }}</td>
+  </tr>{{ end }}{{ if .Severity }}
+  <tr>
+    <th>Severity</th>
+    <td>{{ .Severity }}</td>
+  </tr>{{ end }}{{ if .Owner }}
+  <tr>
+    <th>Owner</th>
+    <td>{{ .Owner }}</td>
+  </tr>{{ end }}{{ if .RunbookURL }}
+  <tr>
+    <th>Runbook</th>
+    <td><a href="{{ .RunbookURL }}">{{ .RunbookURL }}</a></td>
+  </tr>{{ end }}{{ with .SortedLabels }}
+  <tr>
+    <th>Labels</th>
+    <td>{{ range $i, $l := . }}{{ if $i }}, {{ end }}{{ $l }}{{ end }}</td>
+  </tr>{{ end }}
+</table>
+<br>
+{{ end }}{{ range .Records }}<h4>Filter path: {{ .Filter }}</h4>{{ if .Fields }}
 <table>
   <tr>
     <th>Key</th>
@@ -180,7 +230,7 @@ tr:nth-child(even) {
   </tr>{{ end }}
 </table>{{ end }}
 {{ tabsAndLines .Text }}
-<br>{{ end }}
+<br>{{ end }}{{ end }}
 </body>
 </html>`
 	t, err := template.New("email").Funcs(funcs).Parse(tpl)
@@ -15,6 +15,9 @@ package email
 
 import (
 	"fmt"
+	"net"
+	"net/textproto"
+	"strings"
 	"testing"
 
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
@@ -214,7 +217,7 @@ tr:nth-child(even) {
 </html>`
 
 	eh := &AlertMethod{}
-	msg, err := eh.buildMessage("Test Error", records)
+	msg, err := eh.buildMessage(&alert.Alert{RuleName: "Test Error", Records: records})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -223,6 +226,55 @@ tr:nth-child(even) {
 	}
 }
 
+func TestBuildMessage_Severity(t *testing.T) {
+	eh := &AlertMethod{}
+	msg, err := eh.buildMessage(&alert.Alert{
+		RuleName:  "Test Error",
+		Namespace: "team-a",
+		Severity:  "critical",
+		Owner:     "team-a@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Subject: [CRITICAL] Go Elasticsearch Alerts: team-a/Test Error\n"
+	if !strings.Contains(msg, expected) {
+		t.Errorf("Expected message to contain:\n%s\nGot:\n%s", expected, msg)
+	}
+
+	expected = "<th>Owner</th>\n    <td>team-a@example.com</td>"
+	if !strings.Contains(msg, expected) {
+		t.Errorf("Expected message to contain:\n%s\nGot:\n%s", expected, msg)
+	}
+}
+
+func TestBuildMessage_Group(t *testing.T) {
+	eh := &AlertMethod{}
+	msg, err := eh.buildMessage(&alert.Alert{
+		RuleName: "2 alerts from 2 rules",
+		Group: []*alert.Alert{
+			{RuleName: "Rule A", Records: []*alert.Record{{Filter: "a.filter"}}},
+			{RuleName: "Rule B", Owner: "team-b@example.com", Records: []*alert.Record{{Filter: "b.filter"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"Subject: Go Elasticsearch Alerts: 2 alerts from 2 rules\n",
+		"<h3>Rule A</h3>\n<h4>Filter path: a.filter</h4>",
+		"<h3>Rule B</h3>\n<table>",
+		"<td>team-b@example.com</td>",
+		"<h4>Filter path: b.filter</h4>",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("Expected message to contain:\n%s\nGot:\n%s", expected, msg)
+		}
+	}
+}
+
 func ExampleAlertMethod_buildMessage() {
 	records := []*alert.Record{
 		{
@@ -269,7 +321,7 @@ func ExampleAlertMethod_buildMessage() {
 
 	em := &AlertMethod{}
 
-	msg, _ := em.buildMessage("Test Rule", records)
+	msg, _ := em.buildMessage(&alert.Alert{RuleName: "Test Rule", Records: records})
 
 	fmt.Println(msg)
 
@@ -344,3 +396,105 @@ func ExampleAlertMethod_buildMessage() {
 	// </body>
 	// </html>
 }
+
+func TestWrite_Permanent(t *testing.T) {
+	cases := []struct {
+		name      string
+		from      string
+		reply     string
+		permanent bool
+	}{
+		{
+			name:      "unknown-recipient",
+			from:      "alerts@example.com",
+			reply:     "550 5.1.1 no such user",
+			permanent: true,
+		},
+		{
+			name:      "mailbox-busy",
+			from:      "alerts@example.com",
+			reply:     "451 4.3.0 try again later",
+			permanent: false,
+		},
+		{
+			name:      "bad-address",
+			from:      "alerts",
+			reply:     "250 OK",
+			permanent: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			port := newMockSMTPServer(t, tc.reply)
+
+			e, err := NewAlertMethod(&AlertMethodConfig{
+				Host: "127.0.0.1",
+				Port: port,
+				From: tc.from,
+				To:   []string{"test@example.com"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = e.Write(t.Context(), &alert.Alert{
+				RuleName: "test-rule",
+				Records:  []*alert.Record{{Filter: "hits.hits._source", Text: "test"}},
+			})
+			if err == nil {
+				t.Fatal("expected an error but didn't receive one")
+			}
+			if alert.IsPermanent(err) != tc.permanent {
+				t.Errorf("expected permanent? %t (got %v)", tc.permanent, err)
+			}
+		})
+	}
+}
+
+// newMockSMTPServer starts an SMTP server that replies to RCPT
+// commands with rcptReply and returns its port.
+func newMockSMTPServer(t *testing.T, rcptReply string) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				tp := textproto.NewConn(conn)
+				defer tp.Close()
+
+				tp.PrintfLine("220 localhost ESMTP")
+				for {
+					line, err := tp.ReadLine()
+					if err != nil {
+						return
+					}
+					switch cmd, _, _ := strings.Cut(strings.ToUpper(line), " "); cmd {
+					case "RCPT":
+						tp.PrintfLine("%s", rcptReply)
+					case "DATA":
+						tp.PrintfLine("354 go ahead")
+						if _, err := tp.ReadDotLines(); err != nil {
+							return
+						}
+						tp.PrintfLine("250 OK")
+					case "QUIT":
+						tp.PrintfLine("221 bye")
+						return
+					default:
+						tp.PrintfLine("250 OK")
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+// alertJSON is how an alert is encoded when it must be kept so
+// that it can be sent later. The methods of the alert are not
+// encoded.
+type alertJSON struct {
+	RuleName        string            `json:"rule_name"`
+	AlertID         string            `json:"alert_id"`
+	Namespace       string            `json:"namespace,omitempty"`
+	Description     string            `json:"description,omitempty"`
+	Owner           string            `json:"owner,omitempty"`
+	RunbookURL      string            `json:"runbook_url,omitempty"`
+	Severity        string            `json:"severity,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	ConditionGroups []string          `json:"condition_groups,omitempty"`
+	Records         []recordJSON      `json:"results"`
+}
+
+// recordJSON also encodes the fields of a Record that outputs
+// omit since sending the alert later requires them.
+type recordJSON struct {
+	*Record
+	Summary   string `json:"summary,omitempty"`
+	BodyField bool   `json:"body_field,omitempty"`
+}
+
+func newAlertJSON(a *Alert) alertJSON {
+	if a == nil {
+		a = &Alert{}
+	}
+
+	records := make([]recordJSON, 0, len(a.Records))
+	for _, record := range a.Records {
+		records = append(records, recordJSON{
+			Record:    record,
+			Summary:   record.Summary,
+			BodyField: record.BodyField,
+		})
+	}
+
+	return alertJSON{
+		RuleName:        a.RuleName,
+		AlertID:         a.ID,
+		Namespace:       a.Namespace,
+		Description:     a.Description,
+		Owner:           a.Owner,
+		RunbookURL:      a.RunbookURL,
+		Severity:        a.Severity,
+		Labels:          a.Labels,
+		ConditionGroups: a.ConditionGroups,
+		Records:         records,
+	}
+}
+
+func (v alertJSON) alert() *Alert {
+	records := make([]*Record, 0, len(v.Records))
+	for _, r := range v.Records {
+		record := r.Record
+		if record == nil {
+			record = &Record{}
+		}
+		record.Summary = r.Summary
+		record.BodyField = r.BodyField
+		records = append(records, record)
+	}
+
+	return &Alert{
+		ID:              v.AlertID,
+		RuleName:        v.RuleName,
+		Namespace:       v.Namespace,
+		Description:     v.Description,
+		Owner:           v.Owner,
+		RunbookURL:      v.RunbookURL,
+		Severity:        v.Severity,
+		Labels:          v.Labels,
+		ConditionGroups: v.ConditionGroups,
+		Records:         records,
+	}
+}
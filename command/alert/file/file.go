@@ -30,9 +30,34 @@ import (
 var _ alert.Method = (*AlertMethod)(nil)
 
 type outputJSON struct {
-	RuleName   string          `json:"rule_name"`
-	ReceivedAt time.Time       `json:"received_at"`
-	Records    []*alert.Record `json:"results"`
+	RuleName    string            `json:"rule_name"`
+	Namespace   string            `json:"namespace,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	RunbookURL  string            `json:"runbook_url,omitempty"`
+	Severity    string            `json:"severity,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	ReceivedAt  time.Time         `json:"received_at"`
+	Records     []*alert.Record   `json:"results"`
+	Alerts      []*outputJSON     `json:"alerts,omitempty"`
+}
+
+func newOutputJSON(a *alert.Alert, receivedAt time.Time) *outputJSON {
+	entry := &outputJSON{
+		RuleName:    a.RuleName,
+		Namespace:   a.Namespace,
+		Description: a.Description,
+		Owner:       a.Owner,
+		RunbookURL:  a.RunbookURL,
+		Severity:    a.Severity,
+		Labels:      a.Labels,
+		ReceivedAt:  receivedAt,
+		Records:     a.Records,
+	}
+	for _, member := range a.Group {
+		entry.Alerts = append(entry.Alerts, newOutputJSON(member, receivedAt))
+	}
+	return entry
 }
 
 // AlertMethodConfig configures to what file alerts will be written.
@@ -74,21 +99,17 @@ func validateConfig(config *AlertMethodConfig) error {
 	return allErrors.ErrorOrNil()
 }
 
-// Write creates JSON-formatted logs from the records and writes
+// Write creates JSON-formatted logs from the alert and writes
 // them to the file specified at the creation of the AlertMethod.
+// The alerts of a group are included in its "alerts" field.
 // If there was an error writing logs to disk, it returns a
 // non-nil error.
-func (f *AlertMethod) Write(ctx context.Context, rule string, records []*alert.Record) error {
+func (f *AlertMethod) Write(ctx context.Context, a *alert.Alert) error {
 	outfile, err := os.OpenFile(f.outputFilepath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
 	if err != nil {
 		return xerrors.Errorf("error opening new file: %v", err)
 	}
 	defer outfile.Close()
 
-	entry := outputJSON{
-		RuleName:   rule,
-		ReceivedAt: time.Now(),
-		Records:    records,
-	}
-	return json.NewEncoder(outfile).Encode(&entry)
+	return json.NewEncoder(outfile).Encode(newOutputJSON(a, time.Now()))
 }
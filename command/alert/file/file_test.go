@@ -107,7 +107,7 @@ func TestWrite(t *testing.T) {
 				},
 			}
 			ctx := t.Context()
-			err = f.Write(ctx, "test-rule", records)
+			err = f.Write(ctx, &alert.Alert{RuleName: "test-rule", Records: records})
 			if tc.err {
 				if err == nil {
 					t.Fatal("expected an erorr but didn't receive one")
@@ -135,6 +135,43 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+func TestWrite_Group(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "test.log")
+	f, err := NewAlertMethod(&AlertMethodConfig{OutputFilepath: filename})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	members := []*alert.Alert{
+		{RuleName: "rule-a", Records: []*alert.Record{{Filter: "a.filter"}}},
+		{RuleName: "rule-b", Records: []*alert.Record{{Filter: "b.filter"}}},
+	}
+	err = f.Write(t.Context(), &alert.Alert{
+		RuleName: "2 alerts from 2 rules",
+		Group:    members,
+		Records:  append(members[0].Records, members[1].Records...),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := outputJSON{}
+	if err = json.Unmarshal(data, &entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entry.Alerts) != 2 || entry.Alerts[0].RuleName != "rule-a" || entry.Alerts[1].RuleName != "rule-b" {
+		t.Fatalf("unexpected alerts of the group: %s", data)
+	}
+	if !reflect.DeepEqual(entry.Alerts[1].Records, members[1].Records) {
+		t.Fatalf("Got:%+v\n\nExpected:\n%+v", entry.Alerts[1].Records, members[1].Records)
+	}
+}
+
 func ExampleAlertMethod_Write() {
 	records := []*alert.Record{
 		{
@@ -164,7 +201,7 @@ func ExampleAlertMethod_Write() {
 		return
 	}
 
-	err = fm.Write(context.Background(), "Test Rule", records)
+	err = fm.Write(context.Background(), &alert.Alert{RuleName: "Test Rule", Records: records})
 	if err != nil {
 		fmt.Printf("error writing data to file: %v", err)
 		return
@@ -0,0 +1,202 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+)
+
+// Grouping batches the alerts the Handler sends with a Method so
+// that alerts from several rules are sent as one notification.
+// The first alert of a group is held for Wait and every alert
+// received in the meantime with the same values of the By labels
+// is added to it.
+type Grouping struct {
+	// Key identifies the groups of the grouping. Methods whose
+	// Groupings have the same key (e.g. because they send alerts
+	// to the same Slack channel) share groups, which use the By
+	// and Wait of the first of them to be used
+	Key string
+
+	// By are the labels whose values the alerts of a group have
+	// in common. If empty, every alert is added to the same group
+	By []string
+
+	// Wait is how long to wait for more alerts after the first
+	// alert of a group is received
+	Wait time.Duration
+}
+
+// groupKey returns the key of the group to which the alert
+// belongs along with the labels it shares with that group.
+func (g *Grouping) groupKey(a *Alert) (string, map[string]string) {
+	labels := make(map[string]string, len(g.By))
+	values := make([]string, 0, len(g.By)+1)
+	values = append(values, g.Key)
+	for _, label := range g.By {
+		labels[label] = a.Labels[label]
+		values = append(values, label+"="+a.Labels[label])
+	}
+	return strings.Join(values, "|"), labels
+}
+
+// groupMethod wraps a Method with its Grouping.
+type groupMethod struct {
+	Method
+	grouping *Grouping
+}
+
+// WithGrouping returns a Method that writes alerts with the
+// provided method and whose alerts the Handler groups per
+// grouping. If grouping is nil, method is returned unchanged.
+func WithGrouping(method Method, grouping *Grouping) Method {
+	if grouping == nil {
+		return method
+	}
+	return &groupMethod{
+		Method:   method,
+		grouping: grouping,
+	}
+}
+
+func (g *groupMethod) Unwrap() Method {
+	return g.Method
+}
+
+func (g *groupMethod) Write(ctx context.Context, a *Alert) error {
+	return g.Method.Write(ctx, a)
+}
+
+// GroupingOf returns the Grouping of the method, or nil if it
+// does not have one.
+func GroupingOf(method Method) *Grouping {
+	if g, ok := as[*groupMethod](method); ok {
+		return g.grouping
+	}
+	return nil
+}
+
+// group is a batch of deliveries waiting to be sent together.
+type group struct {
+	labels  map[string]string
+	members []*delivery
+	timer   *time.Timer
+}
+
+// alert returns the alert notifying of the alerts of the group.
+// Its records are those of every alert of the group and its
+// severity is theirs if they all have the same one.
+func (g *group) alert() *Alert {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		id = fmt.Sprintf("group-%d", time.Now().UnixNano())
+	}
+
+	a := &Alert{
+		ID:       id,
+		Labels:   g.labels,
+		Severity: g.members[0].alert.Severity,
+	}
+
+	rules := make(map[string]bool)
+	for _, m := range g.members {
+		rules[m.alert.QualifiedName()] = true
+		if m.alert.Severity != a.Severity {
+			a.Severity = ""
+		}
+		a.Group = append(a.Group, m.alert)
+		a.Records = append(a.Records, m.alert.Records...)
+	}
+	a.RuleName = fmt.Sprintf("%d %s from %d %s", len(g.members), Plural(len(g.members), "alert"),
+		len(rules), Plural(len(rules), "rule"))
+	return a
+}
+
+// group returns true if the method of the delivery has a Grouping,
+// in which case the delivery is added to its group to be sent
+// once the Wait of the grouping has passed. Nothing is grouped
+// while draining.
+func (a *Handler) group(ctx context.Context, d *delivery) bool {
+	grouping := GroupingOf(d.method)
+	if grouping == nil {
+		return false
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.draining {
+		return false
+	}
+
+	// The delivery is only sent as part of the group
+	a.active.deregister(d.id)
+
+	key, labels := grouping.groupKey(d.alert)
+	if g, ok := a.groups[key]; ok {
+		g.members = append(g.members, d)
+		return true
+	}
+
+	g := &group{labels: labels, members: []*delivery{d}}
+	a.groups[key] = g
+
+	a.retryWG.Add(1)
+	g.timer = time.AfterFunc(grouping.Wait, func() {
+		defer a.retryWG.Done()
+
+		a.mutex.Lock()
+		delete(a.groups, key)
+		draining := a.draining
+		a.mutex.Unlock()
+
+		// The queues are closed while draining, so the group is
+		// sent right away instead
+		if draining {
+			a.send(ctx, a.newGroupDelivery(g))
+			return
+		}
+		a.enqueue(ctx, a.newGroupDelivery(g), nil)
+	})
+	return true
+}
+
+// pendingGroups stops waiting for more alerts to add to the
+// groups and returns their deliveries. The mutex must be held.
+func (a *Handler) pendingGroups() []*delivery {
+	var deliveries []*delivery
+	for key, g := range a.groups {
+		if !g.timer.Stop() {
+			continue
+		}
+		a.retryWG.Done()
+		deliveries = append(deliveries, a.newGroupDelivery(g))
+		delete(a.groups, key)
+	}
+	return deliveries
+}
+
+// newGroupDelivery returns the delivery of the alert notifying of
+// the alerts of the group. It is sent with the method of the last
+// of them, which sends alerts to the same output as the others.
+func (a *Handler) newGroupDelivery(g *group) *delivery {
+	d := a.newDelivery(-1, g.members[len(g.members)-1].method, g.alert())
+	d.members = g.members
+	return d
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+)
+
+func TestGroupAlert(t *testing.T) {
+	g := &group{
+		labels: map[string]string{"team": "a"},
+		members: []*delivery{
+			{alert: &Alert{RuleName: "rule-a", Severity: "critical", Records: []*Record{{Filter: "a"}}}},
+			{alert: &Alert{RuleName: "rule-a", Severity: "critical", Records: []*Record{{Filter: "b"}}}},
+			{alert: &Alert{RuleName: "rule-b", Namespace: "team-a", Severity: "warning"}},
+		},
+	}
+
+	a := g.alert()
+	if a.RuleName != "3 alerts from 2 rules" {
+		t.Errorf("unexpected rule name %q", a.RuleName)
+	}
+	if a.Severity != "" {
+		t.Errorf("the alerts do not share a severity, got %q", a.Severity)
+	}
+	if a.Labels["team"] != "a" {
+		t.Errorf("unexpected labels %v", a.Labels)
+	}
+	if len(a.Group) != 3 || len(a.Records) != 2 {
+		t.Errorf("expected 3 alerts and 2 records, got %d and %d", len(a.Group), len(a.Records))
+	}
+	if len(a.Alerts()) != 3 || len(a.Group[0].Alerts()) != 1 {
+		t.Error("Alerts() should return the alerts of the group or the alert itself")
+	}
+}
+
+func TestRunGrouping(t *testing.T) {
+	cases := []struct {
+		name   string
+		wait   time.Duration
+		cancel bool
+	}{
+		{
+			name: "sent-after-wait",
+			wait: 200 * time.Millisecond,
+		},
+		{
+			name:   "sent-on-shutdown",
+			wait:   time.Hour,
+			cancel: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sent := make(chanAlertMethod, 10)
+			grouping := &Grouping{Key: "slack", By: []string{"team"}, Wait: tc.wait}
+
+			ah := NewHandler(&HandlerConfig{Logger: hclog.NewNullLogger()})
+
+			outputCh := make(chan *Alert, 4)
+			for _, a := range []*Alert{
+				{RuleName: "rule-a", Labels: map[string]string{"team": "a"}},
+				{RuleName: "rule-b", Labels: map[string]string{"team": "a", "env": "prod"}},
+				{RuleName: "rule-c", Labels: map[string]string{"team": "b"}},
+				{RuleName: "rule-d"},
+			} {
+				a.ID = randomUUID(t)
+				// Methods with the same key share groups even
+				// if they are not the same Method
+				a.Methods = []Method{WithGrouping(sent, grouping)}
+				outputCh <- a
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			go ah.Run(ctx, outputCh)
+
+			if tc.cancel {
+				for len(outputCh) > 0 {
+					time.Sleep(10 * time.Millisecond)
+				}
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+			}
+
+			var rules [][]string
+			for range 3 {
+				select {
+				case a := <-sent:
+					var names []string
+					for _, member := range a.Group {
+						names = append(names, member.RuleName)
+					}
+					slices.Sort(names)
+					rules = append(rules, names)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("expected 3 groups, got %d", len(rules))
+				}
+			}
+			slices.SortFunc(rules, func(a, b []string) int { return slices.Compare(a, b) })
+
+			expected := [][]string{{"rule-a", "rule-b"}, {"rule-c"}, {"rule-d"}}
+			for i := range expected {
+				if !slices.Equal(rules[i], expected[i]) {
+					t.Errorf("expected groups %q, got %q", expected, rules)
+					break
+				}
+			}
+
+			cancel()
+			<-ah.DoneCh
+		})
+	}
+}
+
+func TestRunGroupingError(t *testing.T) {
+	deadLetters := make(chanDeadLetterSink, 2)
+	ah := NewHandler(&HandlerConfig{
+		Logger:      hclog.NewNullLogger(),
+		DeadLetters: deadLetters,
+	})
+
+	method := WithGrouping(
+		WithRetryPolicy(&countingAlertMethod{err: xerrors.New("test error")}, &RetryPolicy{MaxAttempts: 1}),
+		&Grouping{Wait: 10 * time.Millisecond},
+	)
+
+	outputCh := make(chan *Alert, 2)
+	outputCh <- &Alert{ID: randomUUID(t), RuleName: "rule-a", Methods: []Method{method}}
+	outputCh <- &Alert{ID: randomUUID(t), RuleName: "rule-b", Methods: []Method{method}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	go ah.Run(ctx, outputCh)
+	defer func() {
+		cancel()
+		<-ah.DoneCh
+	}()
+
+	// The alerts of the group are given up on individually
+	var rules []string
+	for range 2 {
+		select {
+		case d := <-deadLetters:
+			rules = append(rules, d.Alert.RuleName)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 2 dead letters, got %d", len(rules))
+		}
+	}
+	slices.Sort(rules)
+	if !slices.Equal(rules, []string{"rule-a", "rule-b"}) {
+		t.Errorf("unexpected dead letters %q", rules)
+	}
+}
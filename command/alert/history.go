@@ -0,0 +1,263 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// DeliveryStatus is the outcome of sending an alert to one of its
+// outputs.
+type DeliveryStatus string
+
+const (
+	// DeliverySent is the status of an alert that was sent
+	DeliverySent DeliveryStatus = "sent"
+
+	// DeliveryFailed is the status of an alert that could not be
+	// sent and was given up on
+	DeliveryFailed DeliveryStatus = "failed"
+
+	// DeliveryRateLimited is the status of an alert that was held
+	// back by a RateLimit and counted in its digest instead
+	DeliveryRateLimited DeliveryStatus = "rate_limited"
+
+	// DeliveryPending is the status of an alert that was left in
+	// the journal when the Handler shut down, to be sent after a
+	// restart
+	DeliveryPending DeliveryStatus = "pending"
+
+	// DeliveryUnrouted is the status of an alert whose methods
+	// all had routes it did not match. It is only the status of a
+	// History, never that of a DeliveryRecord
+	DeliveryUnrouted DeliveryStatus = "unrouted"
+)
+
+// DeliveryRecord is the outcome of sending an alert with one of its
+// methods.
+type DeliveryRecord struct {
+	// Index is the position of the method in the methods of the
+	// alert
+	Index int `json:"index"`
+
+	// Output is the output from which the method was built. It
+	// is nil if the method was not wrapped with WithOutput()
+	Output *Output `json:"output,omitempty"`
+
+	// Status is the outcome of sending the alert
+	Status DeliveryStatus `json:"status"`
+
+	// Attempts is the number of times sending the alert was
+	// attempted
+	Attempts int `json:"attempts"`
+
+	// Error is the error returned by the final attempt, if any
+	Error string `json:"error,omitempty"`
+
+	// CompletedAt is when the outcome was known
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// History records what became of an alert once the Handler has
+// finished sending it with each of its methods.
+type History struct {
+	// Alert is the alert that was sent
+	Alert *Alert
+
+	// Deliveries are the outcomes of sending the alert with each
+	// of the methods whose route it matched, by index
+	Deliveries []*DeliveryRecord
+
+	// ReceivedAt is when the Handler received the alert. For the
+	// alerts the journal holds from before a restart, it is when
+	// Run() was called
+	ReceivedAt time.Time
+
+	// CompletedAt is when the outcome of the last delivery was
+	// known
+	CompletedAt time.Time
+}
+
+// Status summarizes the deliveries of the history. An alert that
+// could not be sent to one of its outputs has failed. Otherwise,
+// one still pending for an output is pending and one held back by
+// the rate limit of an output is rate limited.
+func (h *History) Status() DeliveryStatus {
+	if len(h.Deliveries) == 0 {
+		return DeliveryUnrouted
+	}
+
+	for _, order := range []DeliveryStatus{DeliveryFailed, DeliveryPending, DeliveryRateLimited} {
+		for _, d := range h.Deliveries {
+			if d.Status == order {
+				return order
+			}
+		}
+	}
+	return DeliverySent
+}
+
+// HistorySink records the history of every alert the Handler
+// sends.
+type HistorySink interface {
+	Add(context.Context, *History) error
+}
+
+type historyJSON struct {
+	Timestamp time.Time `json:"@timestamp"`
+	alertJSON
+	Status      DeliveryStatus    `json:"status"`
+	Deliveries  []*DeliveryRecord `json:"outputs"`
+	ReceivedAt  time.Time         `json:"received_at"`
+	CompletedAt time.Time         `json:"completed_at"`
+}
+
+// MarshalJSON encodes the history along with its alert. Its
+// timestamp is when the alert was received.
+func (h *History) MarshalJSON() ([]byte, error) {
+	deliveries := h.Deliveries
+	if deliveries == nil {
+		deliveries = []*DeliveryRecord{}
+	}
+	return json.Marshal(&historyJSON{
+		Timestamp:   h.ReceivedAt,
+		alertJSON:   newAlertJSON(h.Alert),
+		Status:      h.Status(),
+		Deliveries:  deliveries,
+		ReceivedAt:  h.ReceivedAt,
+		CompletedAt: h.CompletedAt,
+	})
+}
+
+// tracked is the history of an alert whose deliveries are not
+// all complete.
+type tracked struct {
+	history    *History
+	deliveries map[int]*DeliveryRecord
+	pending    int
+}
+
+// track starts recording the history of the alert, which is to be
+// sent to the given outputs by the index of their methods. The
+// outputs may be nil. If none are given, the history is recorded
+// right away.
+func (a *Handler) track(ctx context.Context, alert *Alert, outputs map[int]*Output) {
+	if a.history == nil {
+		return
+	}
+
+	t := &tracked{
+		history: &History{
+			Alert:      alert,
+			ReceivedAt: time.Now(),
+		},
+		deliveries: make(map[int]*DeliveryRecord, len(outputs)),
+		pending:    len(outputs),
+	}
+	for _, i := range slices.Sorted(maps.Keys(outputs)) {
+		d := &DeliveryRecord{Index: i, Output: outputs[i]}
+		t.deliveries[i] = d
+		t.history.Deliveries = append(t.history.Deliveries, d)
+	}
+
+	if len(outputs) == 0 {
+		t.history.CompletedAt = t.history.ReceivedAt
+		a.addHistory(ctx, t.history)
+		return
+	}
+
+	a.mutex.Lock()
+	a.tracked[alert.ID] = t
+	a.mutex.Unlock()
+}
+
+// settle records the outcome of the delivery in the history of its
+// alert, or in those of the alerts of its group. Digests have no
+// history of their own; the alerts they count are recorded as
+// rate limited once they are sent.
+func (a *Handler) settle(ctx context.Context, d *delivery, status DeliveryStatus, err error) {
+	if a.history == nil {
+		return
+	}
+	// The alerts counted in a digest were not sent themselves
+	if d.digest && status == DeliverySent {
+		status = DeliveryRateLimited
+	}
+	for _, m := range d.members {
+		a.complete(ctx, m.alert, m.index, status, d.attempts, err)
+	}
+	if len(d.members) > 0 {
+		return
+	}
+	a.complete(ctx, d.alert, d.index, status, d.attempts, err)
+}
+
+// complete records the outcome of sending the alert with the
+// method at the given index. Once the outcome of every method of
+// the alert is known, its history is recorded with the
+// HistorySink.
+func (a *Handler) complete(
+	ctx context.Context,
+	alert *Alert,
+	index int,
+	status DeliveryStatus,
+	attempts int,
+	err error,
+) {
+	if a.history == nil {
+		return
+	}
+
+	a.mutex.Lock()
+	t, ok := a.tracked[alert.ID]
+	if !ok {
+		a.mutex.Unlock()
+		return
+	}
+	d, ok := t.deliveries[index]
+	if !ok || d.Status != "" {
+		a.mutex.Unlock()
+		return
+	}
+
+	d.Status = status
+	d.Attempts = attempts
+	d.CompletedAt = time.Now()
+	if err != nil {
+		d.Error = err.Error()
+	}
+
+	t.pending--
+	if t.pending > 0 {
+		a.mutex.Unlock()
+		return
+	}
+	delete(a.tracked, alert.ID)
+	t.history.CompletedAt = d.CompletedAt
+	a.mutex.Unlock()
+
+	a.addHistory(ctx, t.history)
+}
+
+func (a *Handler) addHistory(ctx context.Context, h *History) {
+	if err := a.history.Add(ctx, h); err != nil {
+		a.logger.Error(fmt.Sprintf("error recording history of alert from rule %q", h.Alert.QualifiedName()),
+			"error", err)
+	}
+}
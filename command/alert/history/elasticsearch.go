@@ -0,0 +1,223 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package history keeps the history of the alerts sent by the
+// alert handler so that alerting activity can be analyzed.
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	multierror "github.com/hashicorp/go-multierror"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/esclient"
+)
+
+// Ensure ElasticsearchStore adheres to the alert.HistorySink interface.
+var _ alert.HistorySink = (*ElasticsearchStore)(nil)
+
+// ElasticsearchStoreConfig configures the Elasticsearch indices in
+// which the history is kept.
+type ElasticsearchStoreConfig struct {
+	// Client is the *http.Client used to communicate with
+	// Elasticsearch
+	Client *http.Client
+
+	// URL is the URL of the Elasticsearch instance
+	URL string
+
+	// Username and Password are used to authenticate with
+	// Elasticsearch if Username is not empty
+	Username string
+	Password string
+
+	// Index is the name of the index template and of the alias
+	// of the daily indices in which the history is kept. Each
+	// index is named after it followed by its date
+	Index string
+
+	// ILMPolicyName is the name of an Elasticsearch ILM policy
+	// applied to the indices. It must already exist and is not
+	// created by this application. It is optional
+	ILMPolicyName string
+}
+
+// ElasticsearchStore keeps the history of each alert as a document
+// of a daily Elasticsearch index.
+type ElasticsearchStore struct {
+	es            *esclient.Client
+	index         string
+	ilmPolicyName string
+}
+
+// NewElasticsearchStore returns a new *ElasticsearchStore or a
+// non-nil error if there was an error.
+func NewElasticsearchStore(config *ElasticsearchStoreConfig) (*ElasticsearchStore, error) {
+	if config == nil {
+		config = &ElasticsearchStoreConfig{}
+	}
+
+	var allErrors *multierror.Error
+	if config.URL == "" {
+		allErrors = multierror.Append(allErrors, xerrors.New("no Elasticsearch URL provided"))
+	}
+	if config.Index == "" {
+		allErrors = multierror.Append(allErrors, xerrors.New("no Elasticsearch index provided"))
+	}
+	if err := allErrors.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	creds := esclient.Credentials{Username: config.Username, Password: config.Password}
+	return &ElasticsearchStore{
+		es:            esclient.New(config.Client, config.URL, creds),
+		index:         config.Index,
+		ilmPolicyName: config.ILMPolicyName,
+	}, nil
+}
+
+// Alias returns the alias with which the indices of the history
+// can be searched.
+func (e *ElasticsearchStore) Alias() string {
+	return e.index
+}
+
+// indexPath returns the path of the index of the current day, using
+// date math so that Elasticsearch names it.
+func (e *ElasticsearchStore) indexPath() string {
+	return "/" + url.PathEscape(fmt.Sprintf("<%s-{now/d}>", e.index))
+}
+
+// PutTemplate creates or updates the index template of the indices
+// of the history. It must be called before the history is added
+// for the documents to be mapped as intended.
+func (e *ElasticsearchStore) PutTemplate(ctx context.Context) error {
+	var lifecycle map[string]string
+	if e.ilmPolicyName != "" {
+		lifecycle = map[string]string{
+			"name": e.ilmPolicyName,
+		}
+	}
+
+	keyword := map[string]any{"type": "keyword"}
+	template := map[string]any{
+		"priority":       100,
+		"index_patterns": []string{e.index + "-*"},
+		"template": map[string]any{
+			"aliases": map[string]any{
+				e.index: map[string]any{},
+			},
+			"settings": map[string]any{
+				"index": map[string]any{
+					"number_of_shards":     1,
+					"number_of_replicas":   0,
+					"auto_expand_replicas": "0-1",
+					"codec":                "best_compression",
+					"refresh_interval":     "15s",
+					"lifecycle":            lifecycle,
+				},
+			},
+			"mappings": map[string]any{
+				"dynamic_templates": []map[string]any{
+					{
+						"strings_as_keywords": map[string]any{
+							"match_mapping_type": "string",
+							"mapping":            keyword,
+						},
+					},
+				},
+				"properties": map[string]any{
+					"@timestamp":   map[string]any{"type": "date"},
+					"received_at":  map[string]any{"type": "date"},
+					"completed_at": map[string]any{"type": "date"},
+					"alert_id":     keyword,
+					"rule_name":    keyword,
+					"namespace":    keyword,
+					"severity":     keyword,
+					"status":       keyword,
+					"description":  map[string]any{"type": "text"},
+					"results": map[string]any{
+						"properties": map[string]any{
+							"filter": keyword,
+							"text":   map[string]any{"type": "text", "index": false},
+							"fields": map[string]any{
+								"properties": map[string]any{
+									"key":       keyword,
+									"doc_count": map[string]any{"type": "long"},
+								},
+							},
+						},
+					},
+					"outputs": map[string]any{
+						"properties": map[string]any{
+							"index": map[string]any{"type": "integer"},
+							"output": map[string]any{
+								"properties": map[string]any{
+									"field": keyword,
+									"index": map[string]any{"type": "integer"},
+									"type":  keyword,
+								},
+							},
+							"status":       keyword,
+							"attempts":     map[string]any{"type": "integer"},
+							"error":        map[string]any{"type": "text"},
+							"completed_at": map[string]any{"type": "date"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	body, err := json.Marshal(template)
+	if err != nil {
+		return xerrors.Errorf("error JSON-encoding index template: %v", err)
+	}
+
+	data, err := e.es.Do(ctx, http.MethodPut, "/_index_template/"+e.index, body)
+	if err != nil {
+		return xerrors.Errorf("error creating index template: %v", err)
+	}
+
+	var resp struct {
+		Acknowledged bool `json:"acknowledged"`
+	}
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return xerrors.Errorf("error JSON-decoding response body: %v", err)
+	}
+	if !resp.Acknowledged {
+		return xerrors.New("index template not acknowledged by Elasticsearch")
+	}
+	return nil
+}
+
+// Add indexes the history as a document whose ID is the ID of its
+// alert.
+func (e *ElasticsearchStore) Add(ctx context.Context, h *alert.History) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return xerrors.Errorf("error encoding alert history: %v", err)
+	}
+
+	path := fmt.Sprintf("%s/_doc/%s", e.indexPath(), url.PathEscape(h.Alert.ID))
+	if _, err = e.es.Do(ctx, http.MethodPut, path, data); err != nil {
+		return xerrors.Errorf("error indexing alert history: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package history
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+)
+
+func TestElasticsearchStore(t *testing.T) {
+	var (
+		mutex    sync.Mutex
+		template map[string]any
+		docs     = make(map[string]map[string]any)
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if user, pass, _ := r.BasicAuth(); user != "elastic" || pass != "changeme" {
+			t.Errorf("unexpected credentials: %q, %q", user, pass)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodPut && r.URL.Path == "/_index_template/alert-history":
+			if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			_, _ = w.Write([]byte(`{"acknowledged": true}`))
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/<alert-history-{now/d}>/_doc/"):
+			var doc map[string]any
+			if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			docs[strings.TrimPrefix(r.URL.Path, "/<alert-history-{now/d}>/_doc/")] = doc
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	ctx := t.Context()
+
+	store, err := NewElasticsearchStore(&ElasticsearchStoreConfig{
+		Client:        ts.Client(),
+		URL:           ts.URL + "/",
+		Username:      "elastic",
+		Password:      "changeme",
+		Index:         "alert-history",
+		ILMPolicyName: "alert-history-policy",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.PutTemplate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	settings, _ := json.Marshal(template["template"])
+	if !strings.Contains(string(settings), `"lifecycle":{"name":"alert-history-policy"}`) {
+		t.Errorf("expected the template to apply the ILM policy, got %s", settings)
+	}
+	if !strings.Contains(string(settings), `"aliases":{"alert-history":{}}`) {
+		t.Errorf("expected the template to alias the indices, got %s", settings)
+	}
+
+	err = store.Add(ctx, &alert.History{
+		Alert: &alert.Alert{ID: "alert-1", RuleName: "test-rule"},
+		Deliveries: []*alert.DeliveryRecord{
+			{Index: 0, Status: alert.DeliverySent, Attempts: 1},
+		},
+		ReceivedAt:  time.Now(),
+		CompletedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, ok := docs["alert-1"]
+	if !ok || doc["rule_name"] != "test-rule" || doc["status"] != "sent" {
+		t.Fatalf("unexpected documents: %+v", docs)
+	}
+}
+
+func TestPutTemplate_NotAcknowledged(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"acknowledged": false}`))
+	}))
+	defer ts.Close()
+
+	store, err := NewElasticsearchStore(&ElasticsearchStoreConfig{
+		Client: ts.Client(),
+		URL:    ts.URL,
+		Index:  "alert-history",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.PutTemplate(t.Context()); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestNewElasticsearchStore_Errors(t *testing.T) {
+	if _, err := NewElasticsearchStore(nil); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+)
+
+// chanHistorySink is a mock alert.HistorySink that sends
+// histories on a channel.
+type chanHistorySink chan *History
+
+func (c chanHistorySink) Add(ctx context.Context, h *History) error {
+	c <- h
+	return nil
+}
+
+func TestHistoryStatus(t *testing.T) {
+	cases := []struct {
+		name     string
+		statuses []DeliveryStatus
+		expected DeliveryStatus
+	}{
+		{"unrouted", nil, DeliveryUnrouted},
+		{"sent", []DeliveryStatus{DeliverySent, DeliverySent}, DeliverySent},
+		{"rate-limited", []DeliveryStatus{DeliverySent, DeliveryRateLimited}, DeliveryRateLimited},
+		{"pending", []DeliveryStatus{DeliveryRateLimited, DeliveryPending}, DeliveryPending},
+		{"failed", []DeliveryStatus{DeliveryPending, DeliveryFailed, DeliverySent}, DeliveryFailed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &History{}
+			for i, status := range tc.statuses {
+				h.Deliveries = append(h.Deliveries, &DeliveryRecord{Index: i, Status: status})
+			}
+			if status := h.Status(); status != tc.expected {
+				t.Errorf("expected status %q, got %q", tc.expected, status)
+			}
+		})
+	}
+}
+
+func TestHistoryMarshalJSON(t *testing.T) {
+	received := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	h := &History{
+		Alert: &Alert{ID: "test-id", RuleName: "test-rule", Records: []*Record{{Filter: "hits.hits._source"}}},
+		Deliveries: []*DeliveryRecord{{
+			Index:    0,
+			Output:   &Output{Field: "outputs", Index: 0, Type: "slack"},
+			Status:   DeliveryFailed,
+			Attempts: 3,
+			Error:    "test error",
+		}},
+		ReceivedAt:  received,
+		CompletedAt: received.Add(time.Minute),
+	}
+
+	data, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v map[string]any
+	if err = json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v["@timestamp"] != "2019-06-01T00:00:00Z" || v["alert_id"] != "test-id" || v["status"] != "failed" {
+		t.Errorf("unexpected history document: %s", data)
+	}
+	outputs, ok := v["outputs"].([]any)
+	if !ok || len(outputs) != 1 || outputs[0].(map[string]any)["error"] != "test error" {
+		t.Errorf("unexpected outputs: %s", data)
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	history := make(chanHistorySink, 3)
+	ah := NewHandler(&HandlerConfig{
+		Logger:  hclog.NewNullLogger(),
+		History: history,
+	})
+
+	failing := WithOutput(
+		WithRetryPolicy(&countingAlertMethod{err: xerrors.New("test error")}, &RetryPolicy{
+			MaxAttempts:    2,
+			InitialBackoff: 10 * time.Millisecond,
+			Multiplier:     1,
+		}),
+		&Output{Field: "outputs", Index: 1, Type: "slack"},
+	)
+	unmatched := NewRoutedMethod(&countingAlertMethod{}, &Route{Severities: []string{"critical"}})
+
+	outputCh := make(chan *Alert, 2)
+	outputCh <- &Alert{
+		ID:       randomUUID(t),
+		RuleName: "rule-a",
+		Methods:  []Method{&countingAlertMethod{}, failing, unmatched},
+	}
+	outputCh <- &Alert{
+		ID:       randomUUID(t),
+		RuleName: "rule-b",
+		Methods:  []Method{unmatched},
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	go ah.Run(ctx, outputCh)
+	defer func() {
+		cancel()
+		<-ah.DoneCh
+	}()
+
+	histories := make(map[string]*History)
+	for range 2 {
+		select {
+		case h := <-history:
+			histories[h.Alert.RuleName] = h
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected 2 histories, got %d", len(histories))
+		}
+	}
+
+	if h := histories["rule-b"]; h == nil || h.Status() != DeliveryUnrouted {
+		t.Errorf("expected the alert from rule-b to be unrouted, got %+v", h)
+	}
+
+	h := histories["rule-a"]
+	if h == nil || len(h.Deliveries) != 2 {
+		t.Fatalf("expected the alert from rule-a to be sent to 2 outputs, got %+v", h)
+	}
+	if h.Status() != DeliveryFailed || h.CompletedAt.Before(h.ReceivedAt) {
+		t.Errorf("unexpected history: %+v", h)
+	}
+	if d := h.Deliveries[0]; d.Index != 0 || d.Status != DeliverySent || d.Attempts != 1 || d.Output != nil {
+		t.Errorf("unexpected delivery to the first output: %+v", d)
+	}
+	d := h.Deliveries[1]
+	if d.Index != 1 || d.Status != DeliveryFailed || d.Attempts != 2 || d.Error != "test error" {
+		t.Errorf("unexpected delivery to the second output: %+v", d)
+	}
+	if d.Output == nil || d.Output.Type != "slack" {
+		t.Errorf("expected the output of the delivery to be recorded, got %+v", d.Output)
+	}
+}
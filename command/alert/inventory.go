@@ -30,12 +30,16 @@ func newInventory() *inventory {
 }
 
 func (i *inventory) register(id string) {
+	i.registerN(id, defaultNumAttempts)
+}
+
+func (i *inventory) registerN(id string, attempts int) {
 	i.mutex.Lock()
+	defer i.mutex.Unlock()
 	if _, ok := i.alerts[id]; ok {
 		return
 	}
-	i.alerts[id] = defaultNumAttempts
-	i.mutex.Unlock()
+	i.alerts[id] = attempts
 }
 
 func (i *inventory) deregister(id string) {
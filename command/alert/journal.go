@@ -0,0 +1,314 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// journalFile is the name of the file in the data directory in
+// which the FileJournal keeps the queued alerts.
+const journalFile = "alert-queue.jsonl"
+
+const (
+	journalOpAdd = "add"
+	journalOpAck = "ack"
+)
+
+// journalCompactAfter is the number of entries the file may hold
+// before it is compacted, provided that most of them are no longer
+// needed.
+const journalCompactAfter = 1000
+
+// Journal durably records the alerts received by the Handler until
+// they have been sent to all of their outputs so that they can be
+// sent after a restart.
+type Journal interface {
+	// Add records that the alert is to be sent with the methods
+	// at the given indices of its Methods, each of which was
+	// built from the corresponding Output
+	Add(a *Alert, outputs map[int]*Output) error
+
+	// Ack records that the alert no longer needs to be sent with
+	// the method at the given index of its Methods
+	Ack(alertID string, index int) error
+
+	// Pending returns the alerts which have not been sent with
+	// all of their methods, in the order in which they were added
+	Pending() []*PendingAlert
+}
+
+// PendingAlert is an alert that has not been sent with all of its
+// methods. Its Alert has no methods.
+type PendingAlert struct {
+	Alert *Alert
+
+	// Outputs are the outputs from which the methods with which
+	// the alert has not been sent were built, keyed by the index
+	// of the method
+	Outputs map[int]*Output
+}
+
+type journalEntry struct {
+	Op      string          `json:"op"`
+	ID      string          `json:"id"`
+	Alert   *alertJSON      `json:"alert,omitempty"`
+	Outputs map[int]*Output `json:"outputs,omitempty"`
+	Index   int             `json:"index,omitempty"`
+}
+
+// Ensure FileJournal adheres to the Journal interface.
+var _ Journal = (*FileJournal)(nil)
+
+// FileJournal is a Journal that appends to a file with one JSON
+// object per line. Alerts are added before they are sent and
+// acknowledged once they have been sent, so an alert may be sent
+// again after a restart, but it is not lost. The file is compacted
+// once most of its entries are no longer needed.
+type FileJournal struct {
+	mutex   sync.Mutex
+	path    string
+	file    *os.File
+	entries int
+	order   []string
+	pending map[string]*PendingAlert
+}
+
+// NewFileJournal opens the journal in the data directory dir,
+// creating it if it does not exist, and compacts it so that it
+// only holds the pending alerts.
+func NewFileJournal(dir string) (*FileJournal, error) {
+	if dir == "" {
+		return nil, xerrors.New("no data directory provided")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, xerrors.Errorf("error creating data directory: %v", err)
+	}
+
+	j := &FileJournal{
+		path:    filepath.Join(dir, journalFile),
+		pending: make(map[string]*PendingAlert),
+	}
+	if err := j.load(j.path); err != nil {
+		return nil, err
+	}
+	if err := j.rewrite(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// rewrite compacts the file and reopens it.
+func (j *FileJournal) rewrite() error {
+	if err := j.compact(j.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return xerrors.Errorf("error opening alert queue file: %v", err)
+	}
+	if j.file != nil {
+		j.file.Close()
+	}
+	j.file = file
+	j.entries = len(j.order)
+	return nil
+}
+
+func (j *FileJournal) load(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return xerrors.Errorf("error reading alert queue file: %v", err)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// The last line may be incomplete if the process
+			// was killed while writing it
+			continue
+		}
+		j.apply(&entry)
+	}
+	return scanner.Err()
+}
+
+func (j *FileJournal) apply(entry *journalEntry) {
+	switch entry.Op {
+	case journalOpAdd:
+		if entry.Alert == nil || len(entry.Outputs) == 0 {
+			return
+		}
+		if _, ok := j.pending[entry.ID]; !ok {
+			j.order = append(j.order, entry.ID)
+		}
+		j.pending[entry.ID] = &PendingAlert{
+			Alert:   entry.Alert.alert(),
+			Outputs: entry.Outputs,
+		}
+	case journalOpAck:
+		p, ok := j.pending[entry.ID]
+		if !ok {
+			return
+		}
+		delete(p.Outputs, entry.Index)
+		if len(p.Outputs) == 0 {
+			delete(j.pending, entry.ID)
+			j.order = slices.DeleteFunc(j.order, func(id string) bool { return id == entry.ID })
+		}
+	}
+}
+
+// compact rewrites the file so that it only holds the pending
+// alerts.
+func (j *FileJournal) compact(path string) error {
+	var buf bytes.Buffer
+	for _, id := range j.order {
+		p := j.pending[id]
+		a := newAlertJSON(p.Alert)
+		data, err := json.Marshal(&journalEntry{Op: journalOpAdd, ID: id, Alert: &a, Outputs: p.Outputs})
+		if err != nil {
+			return xerrors.Errorf("error encoding queued alert: %v", err)
+		}
+		buf.Write(append(data, '\n'))
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), journalFile+".*")
+	if err != nil {
+		return xerrors.Errorf("error creating temporary alert queue file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return xerrors.Errorf("error writing temporary alert queue file: %v", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return xerrors.Errorf("error writing temporary alert queue file: %v", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return xerrors.Errorf("error writing temporary alert queue file: %v", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return xerrors.Errorf("error replacing alert queue file: %v", err)
+	}
+	return nil
+}
+
+// Add appends the alert to the file and waits for it to be written
+// to disk.
+func (j *FileJournal) Add(a *Alert, outputs map[int]*Output) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	v := newAlertJSON(a)
+	entry := &journalEntry{Op: journalOpAdd, ID: a.ID, Alert: &v, Outputs: maps.Clone(outputs)}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if err := j.write(entry); err != nil {
+		return err
+	}
+	if err := j.file.Sync(); err != nil {
+		return xerrors.Errorf("error syncing alert queue file: %v", err)
+	}
+	j.apply(entry)
+	return nil
+}
+
+// Ack appends the acknowledgement to the file. Once no alerts are
+// pending, the file is truncated. Once the file holds many more
+// entries than there are pending alerts, it is compacted.
+func (j *FileJournal) Ack(alertID string, index int) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if _, ok := j.pending[alertID]; !ok {
+		return nil
+	}
+
+	entry := &journalEntry{Op: journalOpAck, ID: alertID, Index: index}
+	j.apply(entry)
+	if len(j.pending) == 0 {
+		if err := j.file.Truncate(0); err != nil {
+			return xerrors.Errorf("error truncating alert queue file: %v", err)
+		}
+		j.entries = 0
+		return nil
+	}
+	if err := j.write(entry); err != nil {
+		return err
+	}
+
+	if j.entries >= journalCompactAfter && j.entries > 2*len(j.pending) {
+		return j.rewrite()
+	}
+	return nil
+}
+
+func (j *FileJournal) write(entry *journalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return xerrors.Errorf("error encoding alert queue entry: %v", err)
+	}
+	if _, err = j.file.Write(append(data, '\n')); err != nil {
+		return xerrors.Errorf("error writing alert queue file: %v", err)
+	}
+	j.entries++
+	return nil
+}
+
+// Pending returns the alerts which have not been sent with all of
+// their methods.
+func (j *FileJournal) Pending() []*PendingAlert {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	pending := make([]*PendingAlert, 0, len(j.order))
+	for _, id := range j.order {
+		p := j.pending[id]
+		pending = append(pending, &PendingAlert{
+			Alert:   p.Alert,
+			Outputs: maps.Clone(p.Outputs),
+		})
+	}
+	return pending
+}
+
+// Close closes the file.
+func (j *FileJournal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.file.Close()
+}
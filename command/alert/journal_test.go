@@ -0,0 +1,207 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+func TestFileJournal(t *testing.T) {
+	dir := t.TempDir()
+	slack := &Output{Field: "outputs", Index: 0, Type: "slack"}
+	email := &Output{Field: "outputs", Index: 1, Type: "email"}
+
+	j, err := NewFileJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := &Alert{
+		ID:       "first",
+		RuleName: "test-rule",
+		Records:  []*Record{{Filter: "hits.hits._source", Text: "test text", BodyField: true}},
+	}
+	second := &Alert{ID: "second", RuleName: "test-rule"}
+
+	if err = j.Add(first, map[int]*Output{0: slack, 1: email}); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Add(second, map[int]*Output{1: email}); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Ack("first", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Ack("second", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate the process being killed while writing a line
+	f, err := os.OpenFile(filepath.Join(dir, journalFile), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteString(`{"op":"ack","id":"fir`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	j, err = NewFileJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	pending := j.Pending()
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending alert, got %d", len(pending))
+	}
+	p := pending[0]
+	if p.Alert.ID != "first" || len(p.Alert.Records) != 1 || !p.Alert.Records[0].BodyField {
+		t.Errorf("unexpected pending alert: %+v", p.Alert)
+	}
+	if len(p.Outputs) != 1 || *p.Outputs[1] != *email {
+		t.Errorf("unexpected pending outputs: %+v", p.Outputs)
+	}
+
+	if err = j.Ack("first", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(j.Pending()) != 0 {
+		t.Fatal("expected no pending alerts")
+	}
+
+	info, err := os.Stat(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("expected the file to be truncated once no alerts are pending, got %d bytes", info.Size())
+	}
+}
+
+func TestFileJournal_Compact(t *testing.T) {
+	dir := t.TempDir()
+	slack := &Output{Field: "outputs", Index: 0, Type: "slack"}
+
+	j, err := NewFileJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = j.Add(&Alert{ID: "stuck", RuleName: "test-rule"}, map[int]*Output{0: slack}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range journalCompactAfter {
+		id := fmt.Sprintf("sent-%d", i)
+		if err = j.Add(&Alert{ID: id, RuleName: "test-rule"}, map[int]*Output{0: slack}); err != nil {
+			t.Fatal(err)
+		}
+		if err = j.Ack(id, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Entries added after the file was compacted are kept
+	if err = j.Add(&Alert{ID: "last", RuleName: "test-rule"}, map[int]*Output{0: slack}); err != nil {
+		t.Fatal(err)
+	}
+	if err = j.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, journalFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > journalCompactAfter {
+		t.Errorf("expected the file to be compacted, got %d lines", lines)
+	}
+
+	j, err = NewFileJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	pending := j.Pending()
+	if len(pending) != 2 || pending[0].Alert.ID != "stuck" || pending[1].Alert.ID != "last" {
+		t.Fatalf("unexpected pending alerts: %+v", pending)
+	}
+}
+
+func TestRunJournal(t *testing.T) {
+	dir := t.TempDir()
+	output := &Output{Field: "outputs", Index: 0, Type: "file"}
+
+	j, err := NewFileJournal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	queued := &Alert{ID: randomUUID(t), RuleName: "test-rule", Records: []*Record{{Filter: "test.rule.1"}}}
+	if err = j.Add(queued, map[int]*Output{0: output}); err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(dir, "alerts.log")
+	fm := &fileAlertMethod{outputFilepath: filename}
+
+	ah := NewHandler(&HandlerConfig{
+		Logger:  hclog.NewNullLogger(),
+		Journal: j,
+		Resolve: func(a *Alert, o *Output) (Method, error) {
+			if *o != *output {
+				t.Errorf("unexpected output: %+v", o)
+			}
+			return fm, nil
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	outputCh := make(chan *Alert, 1)
+	outputCh <- &Alert{ID: randomUUID(t), RuleName: "test-rule", Methods: []Method{WithOutput(fm, output)}}
+
+	go ah.Run(ctx, outputCh)
+
+	defer func() {
+		cancel()
+		<-ah.DoneCh
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 2 {
+		t.Fatalf("expected both the queued and the new alert to be sent, got %d alerts", lines)
+	}
+	if pending := j.Pending(); len(pending) != 0 {
+		t.Fatalf("expected no pending alerts, got %d", len(pending))
+	}
+}
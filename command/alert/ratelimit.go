@@ -0,0 +1,281 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+)
+
+const (
+	// DigestRuleName is the rule name of the alerts that
+	// summarize the alerts held back by a RateLimit
+	DigestRuleName = "Rate Limit Digest"
+
+	digestFilter = "rate_limited"
+)
+
+// RateLimit limits how many alerts the Handler sends with a
+// Method using a token bucket. Alerts beyond the limit are not
+// sent individually. Instead, they are counted and a single
+// digest alert summarizing them is sent once the limit allows.
+type RateLimit struct {
+	// Key identifies the bucket of the limit. Methods whose
+	// RateLimits have the same key (e.g. because they send
+	// alerts to the same Slack channel) share a bucket, which
+	// uses the Limit, Period and Burst of the first of them
+	// to be used
+	Key string
+
+	// Limit is the number of alerts that may be sent per Period
+	Limit int
+
+	// Period is the period over which Limit alerts may be sent
+	Period time.Duration
+
+	// Burst is the number of alerts that may be sent at once
+	// after a quiet spell
+	Burst int
+}
+
+// rateLimitMethod wraps a Method with its RateLimit.
+type rateLimitMethod struct {
+	Method
+	limit *RateLimit
+}
+
+// WithRateLimit returns a Method that writes alerts with the
+// provided method and that the Handler rate limits per limit.
+// If limit is nil, method is returned unchanged.
+func WithRateLimit(method Method, limit *RateLimit) Method {
+	if limit == nil {
+		return method
+	}
+	return &rateLimitMethod{
+		Method: method,
+		limit:  limit,
+	}
+}
+
+func (r *rateLimitMethod) Unwrap() Method {
+	return r.Method
+}
+
+func (r *rateLimitMethod) Write(ctx context.Context, a *Alert) error {
+	return r.Method.Write(ctx, a)
+}
+
+// RateLimitOf returns the RateLimit of the method, or nil if
+// it does not have one.
+func RateLimitOf(method Method) *RateLimit {
+	if r, ok := as[*rateLimitMethod](method); ok {
+		return r.limit
+	}
+	return nil
+}
+
+// bucket is the token bucket of a RateLimit along with the
+// alerts held back since the last digest.
+type bucket struct {
+	limit  *RateLimit
+	tokens float64
+	last   time.Time
+
+	// digest is non-nil while alerts are being held back
+	digest *digest
+}
+
+func newBucket(limit *RateLimit, now time.Time) *bucket {
+	return &bucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   now,
+	}
+}
+
+// take takes a token from the bucket if there is one. If not,
+// it returns how long it will be until there is.
+func (b *bucket) take(now time.Time) (bool, time.Duration) {
+	rate := float64(b.limit.Limit) / float64(b.limit.Period)
+	b.tokens = min(float64(b.limit.Burst), b.tokens+float64(now.Sub(b.last))*rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate)
+}
+
+// digest counts the alerts held back by a RateLimit. Their
+// deliveries are the members of the delivery of the digest, so
+// they are acknowledged once it is sent.
+type digest struct {
+	method  Method
+	members []*delivery
+	rules   map[string]int
+	timer   *time.Timer
+}
+
+func (g *digest) add(d *delivery) {
+	g.method = d.method
+	members := d.members
+	if len(members) == 0 {
+		members = []*delivery{d}
+	}
+	for _, m := range members {
+		g.members = append(g.members, m)
+		g.rules[m.alert.QualifiedName()]++
+	}
+}
+
+// alert returns the alert summarizing the alerts held back.
+func (g *digest) alert() *Alert {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		id = fmt.Sprintf("digest-%d", time.Now().UnixNano())
+	}
+
+	fields := make([]*Field, 0, len(g.rules))
+	for _, rule := range slices.Sorted(maps.Keys(g.rules)) {
+		fields = append(fields, &Field{Key: rule, Count: g.rules[rule]})
+	}
+
+	return &Alert{
+		ID:       id,
+		RuleName: DigestRuleName,
+		Records: []*Record{
+			{
+				Filter: digestFilter,
+				Text: fmt.Sprintf("%d more %s from %d %s", len(g.members), Plural(len(g.members), "alert"),
+					len(g.rules), Plural(len(g.rules), "rule")),
+				Fields: fields,
+			},
+		},
+	}
+}
+
+// Plural returns the noun, made plural by adding an "s" unless n
+// is 1.
+func Plural(n int, noun string) string {
+	if n == 1 {
+		return noun
+	}
+	return noun + "s"
+}
+
+// limit returns true if the alert of the delivery may not be
+// sent yet per the RateLimit of its method, in which case it is
+// added to the digest of the bucket. Only first attempts are
+// limited, and nothing is limited while draining.
+func (a *Handler) limit(ctx context.Context, d *delivery) bool {
+	limit := RateLimitOf(d.method)
+	if limit == nil || d.digest || !d.start.IsZero() {
+		return false
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.draining {
+		return false
+	}
+
+	now := time.Now()
+	b, ok := a.buckets[limit.Key]
+	if !ok {
+		b = newBucket(limit, now)
+		a.buckets[limit.Key] = b
+	}
+
+	if b.digest != nil {
+		b.digest.add(d)
+		return true
+	}
+
+	ok, wait := b.take(now)
+	if ok {
+		return false
+	}
+
+	b.digest = &digest{rules: make(map[string]int)}
+	b.digest.add(d)
+
+	a.retryWG.Add(1)
+	b.digest.timer = time.AfterFunc(wait, func() {
+		defer a.retryWG.Done()
+		a.flush(ctx, b)
+	})
+	return true
+}
+
+// flush queues the digest of the bucket to be sent, waiting
+// again if the bucket has no token for it yet.
+func (a *Handler) flush(ctx context.Context, b *bucket) {
+	a.mutex.Lock()
+	g := b.digest
+	if g == nil {
+		a.mutex.Unlock()
+		return
+	}
+	draining := a.draining
+	if !draining {
+		if ok, wait := b.take(time.Now()); !ok {
+			a.retryWG.Add(1)
+			g.timer = time.AfterFunc(wait, func() {
+				defer a.retryWG.Done()
+				a.flush(ctx, b)
+			})
+			a.mutex.Unlock()
+			return
+		}
+	}
+	b.digest = nil
+	a.mutex.Unlock()
+
+	// The queues are closed while draining, so the digest is sent
+	// right away instead
+	if draining {
+		a.send(ctx, a.newDigestDelivery(g))
+		return
+	}
+	a.enqueue(ctx, a.newDigestDelivery(g), nil)
+}
+
+// pendingDigests stops waiting to send the digests of the buckets
+// and returns their deliveries. The mutex must be held.
+func (a *Handler) pendingDigests() []*delivery {
+	var deliveries []*delivery
+	for _, b := range a.buckets {
+		if b.digest == nil || !b.digest.timer.Stop() {
+			continue
+		}
+		a.retryWG.Done()
+		deliveries = append(deliveries, a.newDigestDelivery(b.digest))
+		b.digest = nil
+	}
+	return deliveries
+}
+
+func (a *Handler) newDigestDelivery(g *digest) *delivery {
+	d := a.newDelivery(-1, g.method, g.alert())
+	d.digest = true
+	d.members = g.members
+	return d
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+// chanAlertMethod is a mock alert.AlertMethod that sends the
+// alerts it writes to the channel.
+type chanAlertMethod chan *Alert
+
+func (c chanAlertMethod) Write(ctx context.Context, a *Alert) error {
+	c <- a
+	return nil
+}
+
+func TestBucketTake(t *testing.T) {
+	now := time.Now()
+	b := newBucket(&RateLimit{Limit: 2, Period: time.Second, Burst: 2}, now)
+
+	cases := []struct {
+		elapsed time.Duration
+		ok      bool
+		wait    time.Duration
+	}{
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 500 * time.Millisecond},
+		{250 * time.Millisecond, false, 250 * time.Millisecond},
+		{500 * time.Millisecond, true, 0},
+		{10 * time.Second, true, 0},
+		{10 * time.Second, true, 0},
+		{10 * time.Second, false, 500 * time.Millisecond},
+	}
+
+	for i, tc := range cases {
+		ok, wait := b.take(now.Add(tc.elapsed))
+		if ok != tc.ok || wait.Round(time.Millisecond) != tc.wait {
+			t.Errorf("take %d: expected (%t, %s), got (%t, %s)", i+1, tc.ok, tc.wait, ok, wait)
+		}
+	}
+}
+
+func TestRunRateLimit(t *testing.T) {
+	cases := []struct {
+		name   string
+		period time.Duration
+		cancel bool
+	}{
+		{
+			name:   "digest-after-wait",
+			period: 300 * time.Millisecond,
+		},
+		{
+			name:   "digest-on-shutdown",
+			period: time.Hour,
+			cancel: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sent := make(chanAlertMethod, 10)
+			limit := &RateLimit{Key: "slack", Limit: 1, Period: tc.period, Burst: 1}
+
+			// The alerts share a queue, and so are sent in order,
+			// because they share a Method
+			method := WithRateLimit(sent, limit)
+			ah := NewHandler(&HandlerConfig{Logger: hclog.NewNullLogger()})
+
+			outputCh := make(chan *Alert, 4)
+			for _, rule := range []string{"rule-a", "rule-a", "rule-b", "rule-c"} {
+				outputCh <- &Alert{ID: randomUUID(t), RuleName: rule, Methods: []Method{method}}
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+			go ah.Run(ctx, outputCh)
+
+			first := <-sent
+			if first.RuleName != "rule-a" {
+				t.Fatalf("expected the first alert to be sent, got one from %q", first.RuleName)
+			}
+
+			if tc.cancel {
+				for len(outputCh) > 0 {
+					time.Sleep(10 * time.Millisecond)
+				}
+				time.Sleep(50 * time.Millisecond)
+				cancel()
+			}
+
+			var digest *Alert
+			select {
+			case digest = <-sent:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the digest was not sent")
+			}
+			if digest.RuleName != DigestRuleName || len(digest.Records) != 1 {
+				t.Fatalf("unexpected digest: %+v", digest)
+			}
+			if text := digest.Records[0].Text; text != "3 more alerts from 3 rules" {
+				t.Errorf("unexpected digest text %q", text)
+			}
+			if fields := digest.Records[0].Fields; len(fields) != 3 || fields[0].Key != "rule-a" || fields[0].Count != 1 {
+				t.Errorf("unexpected digest fields: %+v", fields)
+			}
+
+			cancel()
+			<-ah.DoneCh
+			if len(sent) != 0 {
+				t.Errorf("expected only the first alert and the digest to be sent, got %d more", len(sent))
+			}
+		})
+	}
+}
+
+func TestRunRateLimit_Journal(t *testing.T) {
+	j, err := NewFileJournal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	sent := make(chanAlertMethod, 10)
+	limit := &RateLimit{Key: "slack", Limit: 1, Period: 500 * time.Millisecond, Burst: 1}
+	method := WithOutput(WithRateLimit(sent, limit), &Output{Field: "outputs", Index: 0, Type: "slack"})
+	ah := NewHandler(&HandlerConfig{Logger: hclog.NewNullLogger(), Journal: j})
+
+	outputCh := make(chan *Alert, 3)
+	for _, rule := range []string{"rule-a", "rule-b", "rule-c"} {
+		outputCh <- &Alert{ID: randomUUID(t), RuleName: rule, Methods: []Method{method}}
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer func() {
+		cancel()
+		<-ah.DoneCh
+	}()
+	go ah.Run(ctx, outputCh)
+
+	<-sent
+	for len(outputCh) > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The alerts held back stay in the journal until the digest
+	// counting them is sent
+	if pending := j.Pending(); len(pending) != 2 {
+		t.Fatalf("expected 2 pending alerts before the digest is sent, got %d", len(pending))
+	}
+
+	select {
+	case digest := <-sent:
+		if digest.RuleName != DigestRuleName {
+			t.Fatalf("expected the digest to be sent, got an alert from %q", digest.RuleName)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the digest was not sent")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if pending := j.Pending(); len(pending) != 0 {
+		t.Fatalf("expected no pending alerts after the digest is sent, got %d", len(pending))
+	}
+}
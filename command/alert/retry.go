@@ -0,0 +1,173 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+const (
+	defaultInitialBackoff = 2 * time.Second
+	defaultMaxBackoff     = time.Minute
+	defaultMultiplier     = 1.0
+	defaultJitter         = 0.5
+)
+
+// RetryPolicy governs how many times, and how often, the Handler
+// attempts to send an alert with a Method.
+type RetryPolicy struct {
+	// MaxAttempts is the largest number of times the alert is
+	// sent. It defaults to 3
+	MaxAttempts int
+
+	// InitialBackoff is how long to wait after the first failed
+	// attempt. It defaults to 2 seconds
+	InitialBackoff time.Duration
+
+	// MaxBackoff is the longest to wait between attempts. It
+	// defaults to 1 minute
+	MaxBackoff time.Duration
+
+	// Multiplier is by how much the backoff grows after each
+	// failed attempt. It defaults to 1 (i.e. constant backoff)
+	Multiplier float64
+
+	// Jitter is the fraction of the backoff that is randomly
+	// added to or subtracted from it. It defaults to 0.5
+	Jitter float64
+
+	// Deadline is how long after the first attempt no further
+	// attempts are made. If zero, there is no deadline
+	Deadline time.Duration
+}
+
+// DefaultRetryPolicy returns the RetryPolicy of Methods that do
+// not have one of their own.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    defaultNumAttempts,
+		InitialBackoff: defaultInitialBackoff,
+		MaxBackoff:     defaultMaxBackoff,
+		Multiplier:     defaultMultiplier,
+		Jitter:         defaultJitter,
+	}
+}
+
+// backoff returns how long to wait after the given number of
+// failed attempts. The jitter is applied using random, which
+// should be in [0, 1).
+func (p *RetryPolicy) backoff(attempts int, random float64) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempts-1))
+	if p.MaxBackoff > 0 {
+		d = math.Min(d, float64(p.MaxBackoff))
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*random - 1)
+	}
+	return time.Duration(d)
+}
+
+// retryMethod wraps a Method with its RetryPolicy.
+type retryMethod struct {
+	Method
+	policy *RetryPolicy
+}
+
+// WithRetryPolicy returns a Method that writes alerts with the
+// provided method and that the Handler retries per the policy.
+// If policy is nil, method is returned unchanged.
+func WithRetryPolicy(method Method, policy *RetryPolicy) Method {
+	if policy == nil {
+		return method
+	}
+	return &retryMethod{
+		Method: method,
+		policy: policy,
+	}
+}
+
+func (r *retryMethod) Unwrap() Method {
+	return r.Method
+}
+
+func (r *retryMethod) Write(ctx context.Context, a *Alert) error {
+	return r.Method.Write(ctx, a)
+}
+
+// RetryPolicyOf returns the RetryPolicy of the method, or the
+// default policy if it does not have one.
+func RetryPolicyOf(method Method) *RetryPolicy {
+	if r, ok := as[*retryMethod](method); ok {
+		return r.policy
+	}
+	return DefaultRetryPolicy()
+}
+
+// permanentError is an error that retrying will not fix.
+type permanentError struct {
+	err error
+}
+
+func (p *permanentError) Error() string {
+	return p.err.Error()
+}
+
+func (p *permanentError) Unwrap() error {
+	return p.err
+}
+
+// Permanent marks err as an error that retrying will not fix
+// (e.g. one caused by a bad configuration) so that the Handler
+// stops attempting to send the alert. Methods should return
+// errors that may go away if the alert is sent again (e.g.
+// network errors) as is.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent returns true if err, or any error it wraps, was
+// marked with Permanent().
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Wrapper is implemented by a Method that wraps another Method
+// (e.g. to add a route or a retry policy to it).
+type Wrapper interface {
+	Unwrap() Method
+}
+
+// as returns the first Method of type T in the chain of Methods
+// wrapped by method, starting with method itself.
+func as[T any](method Method) (T, bool) {
+	for method != nil {
+		if t, ok := method.(T); ok {
+			return t, true
+		}
+		w, ok := method.(Wrapper)
+		if !ok {
+			break
+		}
+		method = w.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
@@ -0,0 +1,143 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	r := rand.New(rand.NewSource(1)) //nolint:gosec
+
+	policy := &RetryPolicy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := policy.backoff(i+1, r.Float64()); got != want {
+			t.Errorf("attempt %d: expected backoff %s, got %s", i+1, want, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := range 100 {
+		got := policy.backoff(1, r.Float64())
+		if got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("iteration %d: backoff %s is outside of the jitter", i, got)
+		}
+	}
+}
+
+func TestRetryPolicyOf(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 5}
+
+	method := WithOutput(WithRetryPolicy(&errorAlertMethod{}, policy), &Output{})
+	if RetryPolicyOf(method) != policy {
+		t.Errorf("unexpected retry policy: %+v", RetryPolicyOf(method))
+	}
+	if got := RetryPolicyOf(&errorAlertMethod{}); got.MaxAttempts != defaultNumAttempts {
+		t.Errorf("unexpected default retry policy: %+v", got)
+	}
+}
+
+// countingAlertMethod is a mock alert.AlertMethod that counts how
+// many times Write() is called and returns err each time.
+type countingAlertMethod struct {
+	calls atomic.Int32
+	err   error
+}
+
+func (c *countingAlertMethod) Write(ctx context.Context, a *Alert) error {
+	c.calls.Add(1)
+	return c.err
+}
+
+func TestRunRetryPolicy(t *testing.T) {
+	fast := &RetryPolicy{MaxAttempts: 5, InitialBackoff: 10 * time.Millisecond, Multiplier: 1}
+
+	cases := []struct {
+		name   string
+		err    error
+		policy *RetryPolicy
+		calls  int32
+	}{
+		{
+			name:   "transient",
+			err:    xerrors.New("test error"),
+			policy: fast,
+			calls:  5,
+		},
+		{
+			name:   "permanent",
+			err:    Permanent(xerrors.New("test error")),
+			policy: fast,
+			calls:  1,
+		},
+		{
+			name: "deadline",
+			err:  xerrors.New("test error"),
+			policy: &RetryPolicy{
+				MaxAttempts:    100,
+				InitialBackoff: 100 * time.Millisecond,
+				Multiplier:     1,
+				Deadline:       250 * time.Millisecond,
+			},
+			calls: 3,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			deadLetters := make(chanDeadLetterSink, 1)
+			ah := NewHandler(&HandlerConfig{
+				Logger:      hclog.NewNullLogger(),
+				DeadLetters: deadLetters,
+			})
+
+			method := &countingAlertMethod{err: tc.err}
+			outputCh := make(chan *Alert, 1)
+			outputCh <- &Alert{
+				ID:       randomUUID(t),
+				RuleName: "test-rule",
+				Methods:  []Method{WithRetryPolicy(method, tc.policy)},
+			}
+
+			ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+			go ah.Run(ctx, outputCh)
+			defer func() {
+				cancel()
+				<-ah.DoneCh
+			}()
+
+			select {
+			case <-ctx.Done():
+				t.Fatal("context timed out")
+			case <-deadLetters:
+			}
+
+			if calls := method.calls.Load(); calls != tc.calls {
+				t.Errorf("expected %d attempts, got %d", tc.calls, calls)
+			}
+		})
+	}
+}
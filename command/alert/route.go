@@ -0,0 +1,105 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"slices"
+)
+
+// Route is used to limit which alerts are sent to an output.
+// An alert matches a route only if it matches every non-empty
+// field of the route.
+type Route struct {
+	// Severities are the alert severities that match
+	// this route
+	Severities []string
+
+	// Labels are the labels that an alert must have, with
+	// the same values, to match this route
+	Labels map[string]string
+
+	// ConditionGroups are the names of the condition groups
+	// of which at least one must have fired for an alert to
+	// match this route
+	ConditionGroups []string
+}
+
+// Matches returns true if the alert should be sent to
+// the outputs governed by this route.
+func (r *Route) Matches(a *Alert) bool {
+	if r == nil {
+		return true
+	}
+
+	if len(r.Severities) > 0 && !slices.Contains(r.Severities, a.Severity) {
+		return false
+	}
+
+	for k, v := range r.Labels {
+		if got, ok := a.Labels[k]; !ok || got != v {
+			return false
+		}
+	}
+
+	if len(r.ConditionGroups) > 0 && !slices.ContainsFunc(r.ConditionGroups, func(group string) bool {
+		return slices.Contains(a.ConditionGroups, group)
+	}) {
+		return false
+	}
+
+	return true
+}
+
+// Router is implemented by a Method, or a Method it wraps, that
+// should only be sent some alerts. The Handler will not call
+// Write() with an alert for which Matches() returns false.
+type Router interface {
+	Matches(*Alert) bool
+}
+
+// routedMethod wraps a Method with the Route that
+// governs which alerts are sent to it.
+type routedMethod struct {
+	Method
+	route *Route
+}
+
+// Ensure routedMethod adheres to the Router interface.
+var _ Router = (*routedMethod)(nil)
+
+// NewRoutedMethod returns a Method that writes alerts with
+// the provided method only if they match the route. If route
+// is nil, method is returned unchanged.
+func NewRoutedMethod(method Method, route *Route) Method {
+	if route == nil {
+		return method
+	}
+	return &routedMethod{
+		Method: method,
+		route:  route,
+	}
+}
+
+func (r *routedMethod) Unwrap() Method {
+	return r.Method
+}
+
+func (r *routedMethod) Matches(a *Alert) bool {
+	return r.route.Matches(a)
+}
+
+func (r *routedMethod) Write(ctx context.Context, a *Alert) error {
+	return r.Method.Write(ctx, a)
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"testing"
+)
+
+func TestRoute_Matches(t *testing.T) {
+	a := &Alert{
+		RuleName:        "test-rule",
+		Severity:        "warning",
+		Labels:          map[string]string{"team": "a", "env": "prod"},
+		ConditionGroups: []string{"errors"},
+	}
+
+	cases := []struct {
+		name     string
+		route    *Route
+		expected bool
+	}{
+		{
+			"nil-route",
+			nil,
+			true,
+		},
+		{
+			"empty-route",
+			&Route{},
+			true,
+		},
+		{
+			"severity-matches",
+			&Route{Severities: []string{"warning", "critical"}},
+			true,
+		},
+		{
+			"severity-does-not-match",
+			&Route{Severities: []string{"critical"}},
+			false,
+		},
+		{
+			"labels-match",
+			&Route{Labels: map[string]string{"team": "a"}},
+			true,
+		},
+		{
+			"label-value-does-not-match",
+			&Route{Labels: map[string]string{"team": "b"}},
+			false,
+		},
+		{
+			"label-missing",
+			&Route{Labels: map[string]string{"service": "api"}},
+			false,
+		},
+		{
+			"condition-group-fired",
+			&Route{ConditionGroups: []string{"latency", "errors"}},
+			true,
+		},
+		{
+			"condition-group-did-not-fire",
+			&Route{ConditionGroups: []string{"latency"}},
+			false,
+		},
+		{
+			"all-fields-must-match",
+			&Route{
+				Severities:      []string{"warning"},
+				Labels:          map[string]string{"team": "a"},
+				ConditionGroups: []string{"latency"},
+			},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.route.Matches(a); got != tc.expected {
+				t.Fatalf("got %t, expected %t", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestNewRoutedMethod(t *testing.T) {
+	fm := &fileAlertMethod{}
+
+	if m := NewRoutedMethod(fm, nil); m != Method(fm) {
+		t.Fatalf("expected the method to be returned unchanged when there is no route (got %T)", m)
+	}
+
+	m := NewRoutedMethod(fm, &Route{Severities: []string{"critical"}})
+	r, ok := m.(Router)
+	if !ok {
+		t.Fatalf("expected routed method to implement Router (got %T)", m)
+	}
+	if r.Matches(&Alert{Severity: "warning"}) {
+		t.Fatal("warning alert should not match a critical-only route")
+	}
+	if !r.Matches(&Alert{Severity: "critical"}) {
+		t.Fatal("critical alert should match a critical-only route")
+	}
+}
@@ -19,6 +19,15 @@ const (
 	defaultAttachmentFooterIcon = "https://www.elastic.co/static/images/elastic-logo-200.png"
 )
 
+// severityColors are the attachment colors used for alerts
+// of well-known severities.
+var severityColors = map[string]string{
+	"info":     "#439fe0",
+	"warning":  "#daa038",
+	"error":    "#ff0000",
+	"critical": "#a30200",
+}
+
 // field corresponds to the 'attachment.field'
 // field of a Slack message payload.
 type field struct {
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	cleanhttp "github.com/hashicorp/go-cleanhttp"
@@ -98,21 +99,23 @@ func NewAlertMethod(config *AlertMethodConfig) (alert.Method, error) {
 }
 
 // Write creates a properly-formatted Slack message from the
-// records and posts it to the webhook defined at the creation
+// alert and posts it to the webhook defined at the creation
 // of the AlertMethod. If there was an error making the
 // HTTP request, it returns a non-nil error.
-func (s *AlertMethod) Write(ctx context.Context, rule string, records []*alert.Record) error {
-	if len(records) < 1 {
+func (s *AlertMethod) Write(ctx context.Context, a *alert.Alert) error {
+	if len(a.Records) < 1 {
 		return nil
 	}
-	return s.post(ctx, s.buildPayload(rule, records))
+	return s.post(ctx, s.buildPayload(a))
 }
 
-// buildPayload creates a *Payload instance from the provided
-// records. After being JSON-encoded it can be included in a
-// POST request to a Slack webhook in order to create a new
-// Slack message.
-func (s *AlertMethod) buildPayload(rule string, records []*alert.Record) payload {
+// buildPayload creates a *Payload instance from the records
+// of the provided alert. After being JSON-encoded it can be
+// included in a POST request to a Slack webhook in order to
+// create a new Slack message. If the alert is the notification
+// of a group, the attachments of each alert of the group are
+// included in turn.
+func (s *AlertMethod) buildPayload(a *alert.Alert) payload {
 	pl := payload{
 		Channel:  s.channel,
 		Username: s.username,
@@ -120,11 +123,30 @@ func (s *AlertMethod) buildPayload(rule string, records []*alert.Record) payload
 		Emoji:    s.emoji,
 	}
 
-	records = s.preprocess(records)
+	if len(a.Group) > 0 {
+		pl.Text = strings.TrimSpace(s.text + "\n*" + a.QualifiedName() + "*")
+	}
+
+	for _, member := range a.Alerts() {
+		pl.Attachments = append(pl.Attachments, s.attachments(member)...)
+	}
+
+	return pl
+}
+
+// attachments creates the attachments describing a single alert.
+func (s *AlertMethod) attachments(a *alert.Alert) []attachment {
+	var atts []attachment
+
+	if a.HasMetadata() {
+		atts = append(atts, s.metadataAttachment(a))
+	}
+
+	records := s.preprocess(summarize(a.Records))
 
 	for _, record := range records {
 		att := attachment{
-			Title:      rule,
+			Title:      a.QualifiedName(),
 			Text:       record.Filter,
 			MarkdownIn: []string{"text"},
 			Color:      defaultAttachmentColor,
@@ -136,6 +158,8 @@ func (s *AlertMethod) buildPayload(rule string, records []*alert.Record) payload
 		if record.BodyField && record.Text != "" {
 			att.Text = att.Text + "\n```\n" + record.Text + "\n```"
 			att.Color = "#ff0000"
+		} else if record.Text != "" {
+			att.Text = att.Text + "\n" + record.Text
 		}
 
 		for _, f := range record.Fields {
@@ -151,10 +175,47 @@ func (s *AlertMethod) buildPayload(rule string, records []*alert.Record) payload
 			})
 		}
 
-		pl.Attachments = append(pl.Attachments, att)
+		atts = append(atts, att)
 	}
 
-	return pl
+	if color, ok := severityColors[strings.ToLower(a.Severity)]; ok {
+		for i := range atts {
+			atts[i].Color = color
+		}
+	}
+
+	return atts
+}
+
+// metadataAttachment creates an attachment describing the rule
+// that generated the alert so that responders have context.
+func (s *AlertMethod) metadataAttachment(a *alert.Alert) attachment {
+	att := attachment{
+		Title:      a.QualifiedName(),
+		Text:       a.Description,
+		Color:      defaultAttachmentColor,
+		Footer:     defaultAttachmentFooter,
+		FooterIcon: defaultAttachmentFooterIcon,
+		Timestamp:  time.Now().Unix(),
+	}
+
+	if a.Severity != "" {
+		att.Fields = append(att.Fields, field{Title: "Severity", Value: a.Severity, Short: true})
+	}
+
+	if a.Owner != "" {
+		att.Fields = append(att.Fields, field{Title: "Owner", Value: a.Owner, Short: true})
+	}
+
+	if a.RunbookURL != "" {
+		att.Fields = append(att.Fields, field{Title: "Runbook", Value: a.RunbookURL, Short: false})
+	}
+
+	if labels := a.SortedLabels(); len(labels) > 0 {
+		att.Fields = append(att.Fields, field{Title: "Labels", Value: strings.Join(labels, ", "), Short: false})
+	}
+
+	return att
 }
 
 func (s *AlertMethod) post(ctx context.Context, pl payload) error {
@@ -176,12 +237,33 @@ func (s *AlertMethod) post(ctx context.Context, pl payload) error {
 	resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return xerrors.Errorf("received non-200 status code: %s", resp.Status)
+		err = xerrors.Errorf("received non-200 status code: %s", resp.Status)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			// The webhook URL or payload is bad, so
+			// sending the alert again would not help
+			err = alert.Permanent(err)
+		}
+		return err
 	}
 
 	return err
 }
 
+// summarize replaces the text of records that have a summary
+// with that summary since Slack messages have limited space.
+func summarize(records []*alert.Record) []*alert.Record {
+	output := make([]*alert.Record, 0, len(records))
+	for _, record := range records {
+		if record.Summary != "" {
+			summarized := *record
+			summarized.Text = record.Summary
+			record = &summarized
+		}
+		output = append(output, record)
+	}
+	return output
+}
+
 // preprocess breaks attachments with text greater than s.textLimit
 // into multiple attachments in order to prevent trucation.
 func (s *AlertMethod) preprocess(records []*alert.Record) []*alert.Record {
@@ -187,6 +187,52 @@ func TestBuildPayload(t *testing.T) {
 				},
 			},
 		},
+		{
+			"plain-text",
+			[]*alert.Record{
+				{
+					Filter: "no data",
+					Text:   "The query returned no hits for 3 consecutive run(s)",
+				},
+			},
+			payload{
+				Attachments: []attachment{
+					{
+						Title:      rule,
+						Text:       "no data\nThe query returned no hits for 3 consecutive run(s)",
+						MarkdownIn: []string{"text"},
+						Footer:     "Go Elasticsearch Alerts",
+						FooterIcon: "https://www.elastic.co/static/images/elastic-logo-200.png",
+						Timestamp:  time.Now().Unix(),
+						Color:      defaultAttachmentColor,
+					},
+				},
+			},
+		},
+		{
+			"summary",
+			[]*alert.Record{
+				{
+					Filter:    filter,
+					Text:      "hit 1\nhit 2\nhit 3",
+					Summary:   "hit 1\n\n(1 of 3 hits shown)",
+					BodyField: true,
+				},
+			},
+			payload{
+				Attachments: []attachment{
+					{
+						Title:      rule,
+						Text:       filter + "\n```\nhit 1\n\n(1 of 3 hits shown)\n```",
+						MarkdownIn: []string{"text"},
+						Color:      "#ff0000",
+						Footer:     "Go Elasticsearch Alerts",
+						FooterIcon: "https://www.elastic.co/static/images/elastic-logo-200.png",
+						Timestamp:  time.Now().Unix(),
+					},
+				},
+			},
+		},
 	}
 
 	s := &AlertMethod{
@@ -195,7 +241,7 @@ func TestBuildPayload(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			payload := s.buildPayload(rule, tc.records)
+			payload := s.buildPayload(&alert.Alert{RuleName: rule, Records: tc.records})
 			if !reflect.DeepEqual(tc.expected.Attachments, payload.Attachments) {
 				t.Fatalf("Got Payload.Attachments:\n%+v\n\nExpected Payload.Attachments:\n%+v\n",
 					prettyJSON(t, payload.Attachments),
@@ -206,6 +252,94 @@ func TestBuildPayload(t *testing.T) {
 	}
 }
 
+func TestBuildPayload_Metadata(t *testing.T) {
+	s := &AlertMethod{
+		textLimit: 200,
+	}
+
+	payload := s.buildPayload(&alert.Alert{
+		RuleName:    "Test Rule",
+		Namespace:   "team-a",
+		Description: "Too many errors",
+		Owner:       "team-a@example.com",
+		RunbookURL:  "https://runbooks.example.com/errors",
+		Severity:    "critical",
+		Labels:      map[string]string{"service": "api", "env": "prod"},
+		Records: []*alert.Record{
+			{
+				Filter: "test.filter",
+				Fields: []*alert.Field{{Key: "foo", Count: 8}},
+			},
+		},
+	})
+
+	if len(payload.Attachments) != 2 {
+		t.Fatalf("expected 2 attachments (got %d)", len(payload.Attachments))
+	}
+
+	expected := attachment{
+		Title:      "team-a/Test Rule",
+		Text:       "Too many errors",
+		Color:      severityColors["critical"],
+		Footer:     defaultAttachmentFooter,
+		FooterIcon: defaultAttachmentFooterIcon,
+		Timestamp:  payload.Attachments[0].Timestamp,
+		Fields: []field{
+			{Title: "Severity", Value: "critical", Short: true},
+			{Title: "Owner", Value: "team-a@example.com", Short: true},
+			{Title: "Runbook", Value: "https://runbooks.example.com/errors", Short: false},
+			{Title: "Labels", Value: "env=prod, service=api", Short: false},
+		},
+	}
+	if !reflect.DeepEqual(payload.Attachments[0], expected) {
+		t.Fatalf("Got:\n%+v\n\nExpected:\n%+v", prettyJSON(t, payload.Attachments[0]), prettyJSON(t, expected))
+	}
+
+	if payload.Attachments[1].Color != severityColors["critical"] {
+		t.Fatalf("record attachment should have the severity color (got %q)", payload.Attachments[1].Color)
+	}
+}
+
+func TestBuildPayload_Group(t *testing.T) {
+	s := &AlertMethod{
+		text:      "New alerts",
+		textLimit: 200,
+	}
+
+	payload := s.buildPayload(&alert.Alert{
+		RuleName: "2 alerts from 2 rules",
+		Group: []*alert.Alert{
+			{
+				RuleName: "Rule A",
+				Severity: "critical",
+				Records:  []*alert.Record{{Filter: "a.filter"}},
+			},
+			{
+				RuleName: "Rule B",
+				Records:  []*alert.Record{{Filter: "b.filter"}},
+			},
+		},
+	})
+
+	if payload.Text != "New alerts\n*2 alerts from 2 rules*" {
+		t.Errorf("unexpected text %q", payload.Text)
+	}
+
+	// The first alert has metadata (its severity)
+	if len(payload.Attachments) != 3 {
+		t.Fatalf("expected 3 attachments (got %d)", len(payload.Attachments))
+	}
+
+	titles := []string{payload.Attachments[0].Title, payload.Attachments[1].Title, payload.Attachments[2].Title}
+	if !reflect.DeepEqual(titles, []string{"Rule A", "Rule A", "Rule B"}) {
+		t.Errorf("unexpected attachment titles %q", titles)
+	}
+	if payload.Attachments[1].Color != severityColors["critical"] || payload.Attachments[2].Color != defaultAttachmentColor {
+		t.Errorf("each attachment should have the color of its own alert (got %q and %q)",
+			payload.Attachments[1].Color, payload.Attachments[2].Color)
+	}
+}
+
 func TestWrite(t *testing.T) {
 	cases := []struct {
 		name    string
@@ -293,7 +427,7 @@ func TestWrite(t *testing.T) {
 			}
 
 			ctx := t.Context()
-			err = s.Write(ctx, "test-rule", tc.records)
+			err = s.Write(ctx, &alert.Alert{RuleName: "test-rule", Records: tc.records})
 			if tc.err {
 				if err == nil {
 					t.Fatal("expected an error but didn't receive one")
@@ -307,6 +441,44 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+func TestWrite_Permanent(t *testing.T) {
+	cases := []struct {
+		status    int
+		permanent bool
+	}{
+		{http.StatusNotFound, true},
+		{http.StatusForbidden, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusServiceUnavailable, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(http.StatusText(tc.status), func(t *testing.T) {
+			ts := newMockSlackServer(tc.status)
+			defer ts.Close()
+
+			s, err := NewAlertMethod(&AlertMethodConfig{
+				WebhookURL: ts.URL,
+				Text:       "test",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.Write(t.Context(), &alert.Alert{
+				RuleName: "test-rule",
+				Records:  []*alert.Record{{Filter: "hits.hits._source", Text: "test"}},
+			})
+			if err == nil {
+				t.Fatal("expected an error but didn't receive one")
+			}
+			if alert.IsPermanent(err) != tc.permanent {
+				t.Errorf("expected permanent? %t (got %v)", tc.permanent, err)
+			}
+		})
+	}
+}
+
 func newMockSlackServer(status int) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -378,7 +550,7 @@ func ExampleAlertMethod_buildPayload() {
 
 	sm := a.(*AlertMethod)
 
-	payload := sm.buildPayload("Test rule", records)
+	payload := sm.buildPayload(&alert.Alert{RuleName: "Test rule", Records: records})
 
 	// This loop is performed in order that tests will pass --
 	// it is not necessary to perform this
@@ -16,13 +16,18 @@ package sns
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"text/template"
 
 	"github.com/Masterminds/sprig"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
 	"golang.org/x/xerrors"
 
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
@@ -62,7 +67,7 @@ func NewAlertMethod(config *AlertMethodConfig) (alert.Method, error) {
 		return nil, xerrors.New("field 'output.config.template' must not be empty when using the SNS output method")
 	}
 
-	tmpl, err := template.New("sns").Funcs(sprig.FuncMap()).Parse(config.Template)
+	tmpl, err := parseTemplate(config.Template)
 	if err != nil {
 		return nil, xerrors.Errorf("error parsing SNS message template: %w", err)
 	}
@@ -84,35 +89,93 @@ func NewAlertMethod(config *AlertMethodConfig) (alert.Method, error) {
 
 // Write renders the pre-defined message template and publishes
 // the message to an AWS SNS topic.
-func (a *AlertMethod) Write(ctx context.Context, rule string, records []*alert.Record) error {
-	if len(records) < 1 {
+func (a *AlertMethod) Write(ctx context.Context, alrt *alert.Alert) error {
+	if len(alrt.Records) < 1 {
 		return nil
 	}
 
-	msg, err := a.renderTemplate(rule, records)
+	// The template would fail again with the same alert
+	msg, err := a.renderTemplate(alrt)
 	if err != nil {
-		return err
+		return alert.Permanent(err)
 	}
 
 	input := &sns.PublishInput{
-		Message:  aws.String(msg),
-		TopicArn: aws.String(a.topicARN),
+		Message:           aws.String(msg),
+		TopicArn:          aws.String(a.topicARN),
+		MessageAttributes: messageAttributes(alrt),
 	}
 
 	_, err = a.client.Publish(ctx, input)
 	if err != nil {
-		return xerrors.Errorf("error publishing alert to SNS: %w", err)
+		err = xerrors.Errorf("error publishing alert to SNS: %w", err)
+		if isPermanent(err) {
+			err = alert.Permanent(err)
+		}
+		return err
 	}
 	return nil
 }
 
-func (a *AlertMethod) renderTemplate(rule string, records []*alert.Record) (string, error) {
+// isPermanent returns true if SNS rejected the message with a 4XX
+// status code other than for throttling. The topic, the message or
+// the credentials are then bad (e.g. InvalidParameter, NotFound or
+// AuthorizationError), so publishing the alert again would not help.
+func isPermanent(err error) bool {
+	var respErr *awshttp.ResponseError
+	if !errors.As(err, &respErr) {
+		return false
+	}
+	status := respErr.HTTPStatusCode()
+	if status < 400 || status > 499 || status == http.StatusTooManyRequests {
+		return false
+	}
+	return !retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err).Bool()
+}
+
+// parseTemplate parses an SNS message template. In addition to the
+// sprig functions, templates may call the 'alert' function to access
+// the *alert.Alert being published (e.g. '{{ (alert).Severity }}').
+// The template data itself is the alert's records.
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("sns").
+		Funcs(sprig.FuncMap()).
+		Funcs(alertFuncs(nil)).
+		Parse(text)
+}
+
+func alertFuncs(a *alert.Alert) template.FuncMap {
+	return template.FuncMap{
+		"alert": func() *alert.Alert { return a },
+	}
+}
+
+// messageAttributes returns the SNS message attributes for the
+// alert so that subscribers can filter messages by severity.
+func messageAttributes(a *alert.Alert) map[string]types.MessageAttributeValue {
+	if a.Severity == "" {
+		return nil
+	}
+	return map[string]types.MessageAttributeValue{
+		"severity": {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(a.Severity),
+		},
+	}
+}
+
+func (a *AlertMethod) renderTemplate(alrt *alert.Alert) (string, error) {
+	tmpl, err := a.template.Clone()
+	if err != nil {
+		return "", xerrors.Errorf("error cloning SNS message template: %w", err)
+	}
+
 	out := bytes.Buffer{}
-	if err := a.template.Execute(&out, records); err != nil {
+	if err := tmpl.Funcs(alertFuncs(alrt)).Execute(&out, alrt.Records); err != nil {
 		return "", xerrors.Errorf("error executing SNS message template: %w", err)
 	}
 	if out.String() == "" {
 		out.WriteString("New alerts detected. See logs.")
 	}
-	return fmt.Sprintf("[%s]\n%s", rule, out.String()), nil
+	return fmt.Sprintf("[%s]\n%s", alrt.QualifiedName(), out.String()), nil
 }
@@ -14,10 +14,14 @@
 package sns
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"text/template"
 
-	"github.com/Masterminds/sprig"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
 
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
 )
@@ -153,6 +157,13 @@ func TestAlertMethod_renderTemplate(t *testing.T) {
 			false,
 			"[TEST ERROR ALERT]\nHit the deck!",
 		},
+		{
+			"alert-metadata",
+			"{{with alert}}{{.Severity}} ({{.Owner}}): {{.Description}}{{end}}",
+			defaultRecords,
+			false,
+			"[TEST ERROR ALERT]\ncritical (team-a): Too many errors",
+		},
 		{
 			"no-records-matching-template-logic",
 			"{{range .}}{{if ne .Text \"\"}}{{range $_, $v := regexFindAll \"\\\\[ERROR\\\\].*\" .Text -1 | uniq }}* {{$v | trimAll \"\\\",\"}}\n{{end}}{{end}}{{end}}",
@@ -165,9 +176,15 @@ func TestAlertMethod_renderTemplate(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
 			a := &AlertMethod{
-				template: template.Must(template.New("test").Funcs(sprig.FuncMap()).Parse(tc.template)),
+				template: template.Must(parseTemplate(tc.template)),
 			}
-			msg, err := a.renderTemplate("TEST ERROR ALERT", tc.records)
+			msg, err := a.renderTemplate(&alert.Alert{
+				RuleName:    "TEST ERROR ALERT",
+				Description: "Too many errors",
+				Owner:       "team-a",
+				Severity:    "critical",
+				Records:     tc.records,
+			})
 			if tc.expectErr {
 				if err == nil {
 					t.Fatal("Expected an error")
@@ -183,3 +200,56 @@ func TestAlertMethod_renderTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestWrite_Permanent(t *testing.T) {
+	cases := []struct {
+		status    int
+		code      string
+		permanent bool
+	}{
+		{http.StatusBadRequest, "InvalidParameter", true},
+		{http.StatusNotFound, "NotFound", true},
+		{http.StatusForbidden, "AuthorizationError", true},
+		{http.StatusBadRequest, "Throttling", false},
+		{http.StatusTooManyRequests, "Throttled", false},
+		{http.StatusInternalServerError, "InternalError", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.code, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(tc.status)
+				fmt.Fprintf(w, `<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code>`+
+					`<Message>test</Message></Error><RequestId>test</RequestId></ErrorResponse>`, tc.code)
+			}))
+			defer ts.Close()
+
+			tmpl, err := parseTemplate("test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := &AlertMethod{
+				client: sns.New(sns.Options{
+					Region:           "us-east-1",
+					BaseEndpoint:     aws.String(ts.URL),
+					Credentials:      aws.AnonymousCredentials{},
+					RetryMaxAttempts: 1,
+				}),
+				topicARN: "arn:aws:sns:us-east-1:123456789012:test",
+				template: tmpl,
+			}
+
+			err = a.Write(t.Context(), &alert.Alert{
+				RuleName: "test-rule",
+				Records:  []*alert.Record{{Filter: "hits.hits._source", Text: "test"}},
+			})
+			if err == nil {
+				t.Fatal("expected an error but didn't receive one")
+			}
+			if alert.IsPermanent(err) != tc.permanent {
+				t.Errorf("expected permanent? %t (got %v)", tc.permanent, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+const (
+	defaultWorkers      = 1
+	defaultQueueSize    = 100
+	defaultQueueTimeout = 5 * time.Second
+	defaultIdleTimeout  = 5 * time.Minute
+	defaultDrainTimeout = 10 * time.Second
+)
+
+var (
+	errQueueFull    = xerrors.New("the queue of the output is full")
+	errShuttingDown = xerrors.New("the alert handler is shutting down")
+)
+
+// delivery is the sending of an alert with one of its methods.
+type delivery struct {
+	id     string
+	index  int
+	method Method
+	alert  *Alert
+	policy *RetryPolicy
+	start  time.Time
+
+	// attempts is the number of times sending the alert has been
+	// attempted
+	attempts int
+
+	// digest is whether the alert is the digest of a RateLimit,
+	// which is not recorded with the journal
+	digest bool
+
+	// members are the deliveries of the alerts of the group the
+	// alert notifies of or that the digest counts, if any. They
+	// are acknowledged or given up on along with it
+	members []*delivery
+}
+
+func (a *Handler) newDelivery(index int, method Method, alert *Alert) *delivery {
+	d := &delivery{
+		id:     fmt.Sprintf("%d|%s", index, alert.ID),
+		index:  index,
+		method: method,
+		alert:  alert,
+		policy: RetryPolicyOf(method),
+	}
+	a.active.registerN(d.id, d.policy.MaxAttempts)
+	return d
+}
+
+// queueMethod wraps a Method with the key of its queue.
+type queueMethod struct {
+	Method
+	key string
+}
+
+// WithQueue returns a Method that writes alerts with the provided
+// method and whose alerts the Handler queues along with those of
+// the other methods with the same key (e.g. because they send
+// alerts to the same Slack channel).
+func WithQueue(method Method, key string) Method {
+	return &queueMethod{
+		Method: method,
+		key:    key,
+	}
+}
+
+func (q *queueMethod) Unwrap() Method {
+	return q.Method
+}
+
+// queueKey identifies the output to which the delivery sends its
+// alert. Each output has its own queue and workers.
+func (d *delivery) queueKey() string {
+	if q, ok := as[*queueMethod](d.method); ok {
+		return q.key
+	}
+	return fmt.Sprintf("%p", d.method)
+}
+
+// queue holds the deliveries waiting to be sent to an output.
+type queue struct {
+	key        string
+	deliveries chan *delivery
+
+	// waiting is the number of deliveries waiting for room in
+	// the queue. It is guarded by the mutex of the Handler
+	waiting int
+}
+
+// enqueue queues the delivery to be sent by the workers of its
+// output, starting them if they are not running. If the queue is
+// full, enqueue waits until there is room in it. If wait is nil,
+// the alert is not sent to the output once the queue timeout has
+// passed. Otherwise, enqueue waits until wait is closed.
+func (a *Handler) enqueue(ctx context.Context, d *delivery, wait <-chan struct{}) {
+	a.mutex.Lock()
+	if a.draining {
+		a.mutex.Unlock()
+		a.abandon(ctx, d, errShuttingDown)
+		return
+	}
+
+	key := d.queueKey()
+	q, ok := a.queues[key]
+	if !ok {
+		q = &queue{
+			key:        key,
+			deliveries: make(chan *delivery, a.queueSize),
+		}
+		a.queues[key] = q
+		for range a.workers {
+			a.workerWG.Add(1)
+			go a.work(ctx, q)
+		}
+	}
+
+	select {
+	case q.deliveries <- d:
+		a.mutex.Unlock()
+		return
+	default:
+	}
+
+	// The queue is neither reaped nor closed while deliveries are
+	// waiting for room in it
+	q.waiting++
+	a.enqueueWG.Add(1)
+	a.mutex.Unlock()
+
+	var timeout <-chan time.Time
+	if wait == nil {
+		timer := time.NewTimer(a.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case q.deliveries <- d:
+	case <-timeout:
+		err = errQueueFull
+	case <-wait:
+		err = errShuttingDown
+	case <-a.stopping:
+		err = errShuttingDown
+	}
+
+	a.mutex.Lock()
+	q.waiting--
+	a.mutex.Unlock()
+	a.enqueueWG.Done()
+
+	switch err {
+	case errQueueFull:
+		a.giveUp(ctx, d, err)
+	case errShuttingDown:
+		a.abandon(ctx, d, err)
+	}
+}
+
+// work sends the alerts of the deliveries in the queue until it
+// is closed, either while draining or once nothing has been sent
+// to the output for the idle timeout.
+func (a *Handler) work(ctx context.Context, q *queue) {
+	defer a.workerWG.Done()
+
+	idle := time.NewTimer(a.idleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case d, ok := <-q.deliveries:
+			if !ok {
+				return
+			}
+			a.send(ctx, d)
+		case <-idle.C:
+			if a.reap(q) {
+				return
+			}
+		}
+		idle.Reset(a.idleTimeout)
+	}
+}
+
+// reap closes the queue, which stops its workers, if no delivery
+// is in it or waiting for room in it. It returns true if the queue
+// is closed. Queues are not reaped while draining since drain
+// closes them.
+func (a *Handler) reap(q *queue) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.draining || len(q.deliveries) > 0 || q.waiting > 0 {
+		return false
+	}
+	// Another worker of the queue may have already closed it
+	if a.queues[q.key] == q {
+		delete(a.queues, q.key)
+		close(q.deliveries)
+	}
+	return true
+}
+
+// send attempts to send the alert of the delivery. If it fails,
+// the delivery is retried after a backoff unless it has no
+// attempts left.
+func (a *Handler) send(ctx context.Context, d *delivery) {
+	if a.limit(ctx, d) {
+		// The alert is acknowledged once the digest counting it
+		// is sent
+		a.active.deregister(d.id)
+		return
+	}
+	if d.start.IsZero() {
+		d.start = time.Now()
+	}
+	a.active.decrement(d.id)
+	d.attempts++
+
+	err := d.method.Write(ctx, d.alert)
+	if err == nil {
+		a.active.deregister(d.id)
+		a.ackDelivery(d)
+		a.settle(ctx, d, DeliverySent, nil)
+		return
+	}
+
+	remaining := a.active.remaining(d.id)
+	backoff := d.policy.backoff(d.policy.MaxAttempts-remaining, a.random())
+	if IsPermanent(err) || (d.policy.Deadline > 0 && time.Since(d.start)+backoff > d.policy.Deadline) {
+		remaining = 0
+	}
+	if remaining < 1 {
+		a.logger.Error("error returned by alert function", "error", err, "remaining_retries", 0)
+		a.giveUp(ctx, d, err)
+		return
+	}
+
+	a.logger.Error("error returned by alert function", "error", err,
+		"remaining_retries", remaining, "backoff", backoff.String())
+	a.retry(ctx, d, backoff)
+}
+
+// retry queues the delivery again once the backoff has passed
+// without holding up the worker.
+func (a *Handler) retry(ctx context.Context, d *delivery, backoff time.Duration) {
+	a.mutex.Lock()
+	if a.draining {
+		a.mutex.Unlock()
+		a.abandon(ctx, d, errShuttingDown)
+		return
+	}
+
+	a.retryWG.Add(1)
+	a.retries[d] = time.AfterFunc(backoff, func() {
+		defer a.retryWG.Done()
+
+		a.mutex.Lock()
+		delete(a.retries, d)
+		a.mutex.Unlock()
+
+		a.enqueue(ctx, d, nil)
+	})
+	a.mutex.Unlock()
+}
+
+// drain stops accepting deliveries and waits for the workers to
+// send the alerts that are queued or being sent. Deliveries waiting
+// to be retried are abandoned. If the drain timeout passes first,
+// cancelSends is called and drain returns without waiting further.
+// Groups and digests of alerts held back by rate limits are sent
+// with ctx.
+func (a *Handler) drain(ctx context.Context, cancelSends context.CancelFunc) {
+	a.mutex.Lock()
+	a.draining = true
+	close(a.stopping)
+	a.mutex.Unlock()
+
+	// The deliveries waiting for room in a queue stop waiting
+	// before the queues are closed
+	a.enqueueWG.Wait()
+
+	a.mutex.Lock()
+	for _, q := range a.queues {
+		close(q.deliveries)
+	}
+
+	var abandoned []*delivery
+	for d, timer := range a.retries {
+		if timer.Stop() {
+			abandoned = append(abandoned, d)
+			delete(a.retries, d)
+			a.retryWG.Done()
+		}
+	}
+
+	// The alerts held back by groups and rate limits would otherwise
+	// be lost, so they are sent without waiting any longer
+	pending := append(a.pendingGroups(), a.pendingDigests()...)
+	a.retryWG.Add(len(pending))
+	a.mutex.Unlock()
+
+	for _, d := range abandoned {
+		a.abandon(context.Background(), d, errShuttingDown)
+	}
+	for _, d := range pending {
+		go func() {
+			defer a.retryWG.Done()
+			a.send(ctx, d)
+		}()
+	}
+
+	doneCh := make(chan struct{})
+	go func() {
+		a.workerWG.Wait()
+		a.retryWG.Wait()
+		close(doneCh)
+	}()
+
+	select {
+	case <-doneCh:
+	case <-time.After(a.drainTimeout):
+		a.logger.Error("timed out waiting for alerts to be sent", "timeout", a.drainTimeout.String())
+		cancelSends()
+	}
+}
+
+// abandon stops sending the alert of the delivery because the
+// handler is shutting down. If the handler has a journal, the
+// alert is left in it so that it is sent after a restart. The
+// alerts counted in a digest are left in it instead, to be sent
+// individually. Otherwise, it is given up on.
+func (a *Handler) abandon(ctx context.Context, d *delivery, err error) {
+	if a.journal != nil {
+		a.active.deregister(d.id)
+		a.logger.Info(fmt.Sprintf("alert from rule %q will be sent after a restart", d.alert.QualifiedName()))
+		a.settle(ctx, d, DeliveryPending, err)
+		return
+	}
+	a.giveUp(ctx, d, err)
+}
+
+// giveUp stops sending the alert of the delivery and records it
+// with the DeadLetterSink, if any. The alerts of a group, or those
+// counted in a digest, are recorded individually so that they can
+// be replayed.
+func (a *Handler) giveUp(ctx context.Context, d *delivery, err error) {
+	a.active.deregister(d.id)
+	a.settle(ctx, d, DeliveryFailed, err)
+	if d.digest {
+		a.logger.Error("giving up sending rate limit digest", "error", err)
+	}
+	for _, m := range d.members {
+		a.deadLetter(ctx, OutputOf(m.method), m.alert, err)
+		a.ack(m.alert, m.index)
+	}
+	if len(d.members) > 0 {
+		return
+	}
+	a.deadLetter(ctx, OutputOf(d.method), d.alert, err)
+	a.ack(d.alert, d.index)
+}
+
+// ackDelivery acknowledges the alert of the delivery along with
+// those of its members, if any.
+func (a *Handler) ackDelivery(d *delivery) {
+	for _, m := range d.members {
+		a.ack(m.alert, m.index)
+	}
+	a.ack(d.alert, d.index)
+}
+
+func (a *Handler) random() float64 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	return a.rand.Float64()
+}
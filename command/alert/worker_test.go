@@ -0,0 +1,311 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package alert
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+)
+
+// blockingAlertMethod is a mock alert.AlertMethod whose Write()
+// blocks until release is closed or its context is canceled.
+type blockingAlertMethod struct {
+	release chan struct{}
+	sent    atomic.Int32
+}
+
+func (b *blockingAlertMethod) Write(ctx context.Context, a *Alert) error {
+	select {
+	case <-b.release:
+		b.sent.Add(1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestRunSlowOutput(t *testing.T) {
+	slow := &blockingAlertMethod{release: make(chan struct{})}
+	fast := &countingAlertMethod{}
+	failing := &countingAlertMethod{err: xerrors.New("test error")}
+
+	ah := NewHandler(&HandlerConfig{Logger: hclog.NewNullLogger()})
+
+	outputCh := make(chan *Alert, 2)
+	outputCh <- &Alert{
+		ID:       randomUUID(t),
+		RuleName: "test-rule",
+		Methods: []Method{
+			slow,
+			WithRetryPolicy(failing, &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, Multiplier: 1}),
+		},
+	}
+	outputCh <- &Alert{ID: randomUUID(t), RuleName: "test-rule", Methods: []Method{fast}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	go ah.Run(ctx, outputCh)
+	defer func() {
+		close(slow.release)
+		cancel()
+		<-ah.DoneCh
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for fast.calls.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the alert was not sent to the fast output while the slow output was sending")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if failing.calls.Load() != 1 {
+		t.Errorf("expected 1 attempt while waiting for the backoff, got %d", failing.calls.Load())
+	}
+}
+
+func TestRunDrain(t *testing.T) {
+	cases := []struct {
+		name    string
+		release bool
+		sent    int32
+		dead    int
+	}{
+		{
+			name:    "drained",
+			release: true,
+			sent:    1,
+		},
+		{
+			name: "drain-timeout",
+			dead: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			method := &blockingAlertMethod{release: make(chan struct{})}
+			deadLetters := make(chanDeadLetterSink, 2)
+			ah := NewHandler(&HandlerConfig{
+				Logger:       hclog.NewNullLogger(),
+				DeadLetters:  deadLetters,
+				DrainTimeout: 200 * time.Millisecond,
+			})
+
+			outputCh := make(chan *Alert, 1)
+			outputCh <- &Alert{
+				ID:       randomUUID(t),
+				RuleName: "test-rule",
+				Methods:  []Method{WithRetryPolicy(method, &RetryPolicy{MaxAttempts: 1})},
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			go ah.Run(ctx, outputCh)
+
+			for len(outputCh) > 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+			time.Sleep(50 * time.Millisecond)
+			cancel()
+
+			if tc.release {
+				close(method.release)
+			}
+
+			select {
+			case <-ah.DoneCh:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run did not return")
+			}
+
+			time.Sleep(50 * time.Millisecond)
+			if sent := method.sent.Load(); sent != tc.sent {
+				t.Errorf("expected %d alerts to be sent, got %d", tc.sent, sent)
+			}
+			if len(deadLetters) != tc.dead {
+				t.Errorf("expected %d dead letters, got %d", tc.dead, len(deadLetters))
+			}
+		})
+	}
+}
+
+func TestRunDrainBuffered(t *testing.T) {
+	method := &countingAlertMethod{}
+	ah := NewHandler(&HandlerConfig{Logger: hclog.NewNullLogger()})
+
+	outputCh := make(chan *Alert, 3)
+	for range 3 {
+		outputCh <- &Alert{ID: randomUUID(t), RuleName: "test-rule", Methods: []Method{method}}
+	}
+
+	// The alerts left in outputCh when the handler stops are sent
+	// while draining
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	go ah.Run(ctx, outputCh)
+
+	select {
+	case <-ah.DoneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return")
+	}
+	if calls := method.calls.Load(); calls != 3 {
+		t.Errorf("expected 3 alerts to be sent, got %d", calls)
+	}
+}
+
+func TestRunQueueFull(t *testing.T) {
+	cases := []struct {
+		name    string
+		timeout time.Duration
+		release time.Duration
+		sent    int32
+		dead    int
+	}{
+		{
+			name:    "given-up",
+			timeout: 100 * time.Millisecond,
+			release: time.Hour,
+			dead:    1,
+		},
+		{
+			name:    "room-in-time",
+			timeout: 5 * time.Second,
+			release: 100 * time.Millisecond,
+			sent:    3,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			method := &blockingAlertMethod{release: make(chan struct{})}
+			deadLetters := make(chanDeadLetterSink, 3)
+			ah := NewHandler(&HandlerConfig{
+				Logger:       hclog.NewNullLogger(),
+				DeadLetters:  deadLetters,
+				QueueSize:    1,
+				QueueTimeout: tc.timeout,
+			})
+
+			outputCh := make(chan *Alert, 3)
+			for range 3 {
+				outputCh <- &Alert{ID: randomUUID(t), RuleName: "test-rule", Methods: []Method{method}}
+			}
+
+			ctx, cancel := context.WithCancel(t.Context())
+			go ah.Run(ctx, outputCh)
+			timer := time.AfterFunc(tc.release, func() { close(method.release) })
+			defer func() {
+				if timer.Stop() {
+					close(method.release)
+				}
+				cancel()
+				<-ah.DoneCh
+			}()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for method.sent.Load() < tc.sent || len(deadLetters) < tc.dead {
+				if time.Now().After(deadline) {
+					t.Fatalf("expected %d alerts to be sent and %d dead letters, got %d and %d",
+						tc.sent, tc.dead, method.sent.Load(), len(deadLetters))
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if len(deadLetters) != tc.dead {
+				t.Fatalf("expected %d dead letters, got %d", tc.dead, len(deadLetters))
+			}
+			if tc.dead > 0 {
+				if d := <-deadLetters; d.Error != errQueueFull.Error() {
+					t.Errorf("unexpected error: %s", d.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestQueueKey(t *testing.T) {
+	method := &countingAlertMethod{}
+	cases := []struct {
+		name   string
+		first  *delivery
+		second *delivery
+		same   bool
+	}{
+		{
+			name:   "same-output-different-rules",
+			first:  &delivery{method: WithQueue(method, "slack|a"), alert: &Alert{RuleName: "rule-1"}},
+			second: &delivery{method: WithQueue(WithOutput(method, &Output{Index: 1}), "slack|a"), alert: &Alert{RuleName: "rule-2"}},
+			same:   true,
+		},
+		{
+			name:   "different-outputs",
+			first:  &delivery{method: WithQueue(method, "slack|a"), alert: &Alert{RuleName: "rule-1"}},
+			second: &delivery{method: WithQueue(method, "slack|b"), alert: &Alert{RuleName: "rule-1"}},
+		},
+		{
+			name:   "no-queue",
+			first:  &delivery{method: method, alert: &Alert{RuleName: "rule-1"}},
+			second: &delivery{method: method, alert: &Alert{RuleName: "2 alerts from 2 rules"}},
+			same:   true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if same := tc.first.queueKey() == tc.second.queueKey(); same != tc.same {
+				t.Errorf("expected the deliveries sharing a queue to be %t, got %t", tc.same, same)
+			}
+		})
+	}
+}
+
+func TestRunReapIdleQueues(t *testing.T) {
+	method := &countingAlertMethod{}
+	ah := NewHandler(&HandlerConfig{
+		Logger:  hclog.NewNullLogger(),
+		Workers: 2,
+	})
+	ah.idleTimeout = 50 * time.Millisecond
+
+	outputCh := make(chan *Alert)
+	ctx, cancel := context.WithCancel(t.Context())
+	go ah.Run(ctx, outputCh)
+	defer func() {
+		cancel()
+		<-ah.DoneCh
+	}()
+
+	queues := func() int {
+		ah.mutex.Lock()
+		defer ah.mutex.Unlock()
+		return len(ah.queues)
+	}
+
+	// A new queue is started for the alerts sent after the idle
+	// queue was reaped
+	for i := range 2 {
+		outputCh <- &Alert{ID: randomUUID(t), RuleName: "test-rule", Methods: []Method{WithQueue(method, "test")}}
+
+		deadline := time.Now().Add(5 * time.Second)
+		for method.calls.Load() < int32(i+1) || queues() > 0 {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d alerts to be sent and no queues, got %d and %d", i+1, method.calls.Load(), queues())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
@@ -51,17 +51,61 @@ func Run() int { //nolint:gocyclo,gocognit
 		return 1
 	}
 
-	qhs, err := buildQueryHandlers(cfg.Rules, cfg.Elasticsearch.Server.ElasticsearchURL, esClient, logger)
+	qhs, err := buildQueryHandlers(cfg.Rules, cfg, esClient, logger)
 	if err != nil {
 		logger.Error("Error creating query handlers from rules", "error", err)
 		return 1
 	}
 
+	rhs, err := buildReportHandlers(cfg, esClient, logger)
+	if err != nil {
+		logger.Error("Error creating report handlers", "error", err)
+		return 1
+	}
+
+	deadLetters, err := buildDeadLetterStore(cfg, esClient)
+	if err != nil {
+		logger.Error("Error creating dead letter store", "error", err)
+		return 1
+	}
+
+	historyStore, err := buildHistoryStore(cfg, esClient)
+	if err != nil {
+		logger.Error("Error creating alert history store", "error", err)
+		return 1
+	}
+
+	handlerConfig := &alert.HandlerConfig{
+		Logger:       logger.Named("alert_handler"),
+		Workers:      cfg.Delivery.Workers,
+		QueueSize:    cfg.Delivery.QueueSize,
+		QueueTimeout: cfg.Delivery.QueueTimeout,
+		DrainTimeout: cfg.Delivery.DrainTimeout,
+	}
+	if deadLetters != nil {
+		handlerConfig.DeadLetters = deadLetters
+	}
+	if historyStore != nil {
+		handlerConfig.History = historyStore
+	}
+	if cfg.DataDir != "" {
+		journal, err := alert.NewFileJournal(cfg.DataDir)
+		if err != nil {
+			logger.Error("Error opening alert queue", "error", err)
+			return 1
+		}
+		defer journal.Close()
+
+		handlerConfig.Journal = journal
+		handlerConfig.Resolve = func(a *alert.Alert, output *alert.Output) (alert.Method, error) {
+			return resolveOutput(cfg, a, output)
+		}
+	}
+
 	controller, err := newController(&controllerConfig{
-		queryHandlers: qhs,
-		alertHandler: alert.NewHandler(&alert.HandlerConfig{
-			Logger: logger.Named("alert_handler"),
-		}),
+		queryHandlers:  qhs,
+		reportHandlers: rhs,
+		alertHandler:   alert.NewHandler(handlerConfig),
 	})
 	if err != nil {
 		logger.Error("Error creating new controller", "error", err)
@@ -85,6 +129,14 @@ func Run() int { //nolint:gocyclo,gocognit
 		logger.Info(fmt.Sprintf("Successfully created template %q", qh.StateAliasURL()))
 	}
 
+	if historyStore != nil {
+		if err = historyStore.PutTemplate(ctx); err != nil {
+			logger.Error(fmt.Sprintf("Error creating template %q", historyStore.Alias()), "error", err)
+		} else {
+			logger.Info(fmt.Sprintf("Successfully created template %q", historyStore.Alias()))
+		}
+	}
+
 	go controller.run(ctx)
 
 	defer func() {
@@ -114,7 +166,7 @@ func Run() int { //nolint:gocyclo,gocognit
 				cancel()
 				return 1
 			}
-			qhs, err := buildQueryHandlers(rules, cfg.Elasticsearch.Server.ElasticsearchURL, esClient, logger)
+			qhs, err := buildQueryHandlers(rules, cfg, esClient, logger)
 			if err != nil {
 				logger.Error("Error creating query handlers from rules. Exiting", "error", err)
 				cancel()
@@ -25,8 +25,9 @@ import (
 )
 
 type controllerConfig struct {
-	alertHandler  *alert.Handler
-	queryHandlers []*query.QueryHandler
+	alertHandler   *alert.Handler
+	queryHandlers  []*query.QueryHandler
+	reportHandlers []*query.ReportHandler
 }
 
 type controller struct {
@@ -35,8 +36,10 @@ type controller struct {
 	updateHandlersCh chan []*query.QueryHandler
 	distLock         *lock.Lock
 	queryHandlerWG   *sync.WaitGroup
+	reportHandlerWG  *sync.WaitGroup
 	alertHandler     *alert.Handler
 	queryHandlers    []*query.QueryHandler
+	reportHandlers   []*query.ReportHandler
 }
 
 func newController(config *controllerConfig) (*controller, error) {
@@ -53,20 +56,31 @@ func newController(config *controllerConfig) (*controller, error) {
 		updateHandlersCh: make(chan []*query.QueryHandler, 1),
 		distLock:         lock.NewLock(),
 		queryHandlerWG:   new(sync.WaitGroup),
+		reportHandlerWG:  new(sync.WaitGroup),
 		alertHandler:     config.alertHandler,
 		queryHandlers:    config.queryHandlers,
+		reportHandlers:   config.reportHandlers,
 	}, nil
 }
 
 func (ctrl *controller) run(ctx context.Context) {
-	ctrl.startAlertHandler(ctx)
+	// The alert handler is only stopped once the query and report
+	// handlers have stopped so that the alerts they send while
+	// stopping are received rather than lost
+	alertCtx, stopAlertHandler := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopAlertHandler()
+
+	ctrl.startAlertHandler(alertCtx)
 	ctrl.startQueryHandlers(ctx)
+	ctrl.startReportHandlers(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
-			<-ctrl.alertHandler.DoneCh
 			ctrl.queryHandlerWG.Wait()
+			ctrl.reportHandlerWG.Wait()
+			stopAlertHandler()
+			<-ctrl.alertHandler.DoneCh
 			close(ctrl.doneCh)
 			return
 		case qhs := <-ctrl.updateHandlersCh:
@@ -88,6 +102,16 @@ func (ctrl *controller) startQueryHandlers(ctx context.Context) {
 	}
 }
 
+// startReportHandlers starts the report handlers. Unlike the query
+// handlers, they are not replaced when the rules are reloaded since
+// they are defined in the main configuration file.
+func (ctrl *controller) startReportHandlers(ctx context.Context) {
+	ctrl.reportHandlerWG.Add(len(ctrl.reportHandlers))
+	for _, rh := range ctrl.reportHandlers {
+		go rh.Run(ctx, ctrl.outputCh, ctrl.reportHandlerWG, ctrl.distLock)
+	}
+}
+
 func (ctrl *controller) stopQueryHandlers() {
 	for _, qh := range ctrl.queryHandlers {
 		qh.StopCh <- struct{}{}
@@ -14,6 +14,8 @@
 package command
 
 import (
+	"cmp"
+	"encoding/json"
 	"net/http"
 
 	hclog "github.com/hashicorp/go-hclog"
@@ -21,17 +23,29 @@ import (
 	"golang.org/x/xerrors"
 
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/deadletter"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/elasticsearch"
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/email"
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/file"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/history"
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/slack"
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/sns"
 	"github.com/morningconsult/go-elasticsearch-alerts/command/query"
 	"github.com/morningconsult/go-elasticsearch-alerts/config"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/esclient"
+)
+
+// The fields of the configuration files in which outputs are defined.
+const (
+	fieldOutputs             = "outputs"
+	fieldShardFailureOutputs = "shard_failure_outputs"
+	fieldErrorOutputs        = "error_outputs"
+	fieldReportOutputs       = "reports.outputs"
 )
 
 func buildQueryHandlers(
 	rules []config.RuleConfig,
-	esURL string,
+	cfg *config.Config,
 	esClient *http.Client,
 	logger hclog.Logger,
 ) ([]*query.QueryHandler, error) {
@@ -42,22 +56,56 @@ func buildQueryHandlers(
 		return nil, xerrors.New("no logger provided")
 	case esClient == nil:
 		return nil, xerrors.New("no HTTP client provided")
-	case esURL == "":
+	case cfg == nil || cfg.Elasticsearch == nil || cfg.Elasticsearch.Server == nil ||
+		cfg.Elasticsearch.Server.ElasticsearchURL == "":
 		return nil, xerrors.New("no URL provided")
 	}
+	esURL := cfg.Elasticsearch.Server.ElasticsearchURL
+
+	errorMethods := make([]alert.Method, 0, len(cfg.ErrorOutputs))
+	for i, output := range cfg.ErrorOutputs {
+		method, err := buildOutputMethod(output)
+		if err != nil {
+			return nil, xerrors.Errorf("error creating alert.AlertMethod: %v", err)
+		}
+		errorMethods = append(errorMethods, alert.WithOutput(method, newOutput(fieldErrorOutputs, i, output)))
+	}
 
 	queryHandlers := make([]*query.QueryHandler, 0, len(rules))
 	for _, rule := range rules {
 		var methods []alert.Method
-		for _, output := range rule.Outputs {
-			method, err := buildMethod(output)
+		for i, output := range rule.Outputs {
+			method, err := buildOutputMethod(output)
+			if err != nil {
+				return nil, xerrors.Errorf("error creating alert.AlertMethod: %v", err)
+			}
+			method = alert.NewRoutedMethod(method, buildRoute(output.Route))
+			methods = append(methods, alert.WithOutput(method, newOutput(fieldOutputs, i, output)))
+		}
+		var shardFailureMethods []alert.Method
+		for i, output := range rule.ShardFailureOutputs {
+			method, err := buildOutputMethod(output)
 			if err != nil {
 				return nil, xerrors.Errorf("error creating alert.AlertMethod: %v", err)
 			}
-			methods = append(methods, method)
+			method = alert.WithOutput(method, newOutput(fieldShardFailureOutputs, i, output))
+			shardFailureMethods = append(shardFailureMethods, method)
+		}
+		var baselineIndex string
+		var baselineData map[string]any
+		if rule.Baseline != nil {
+			baselineIndex = rule.Baseline.Index
+			baselineData = rule.Baseline.Body
 		}
+
 		handler, err := query.NewQueryHandler(&query.QueryHandlerConfig{
 			Name:         rule.Name,
+			Namespace:    rule.Namespace,
+			Description:  rule.Description,
+			Owner:        rule.Owner,
+			RunbookURL:   rule.RunbookURL,
+			Severity:     rule.Severity,
+			Labels:       rule.Labels,
 			Logger:       logger,
 			AlertMethods: methods,
 			Client:       esClient,
@@ -68,6 +116,25 @@ func buildQueryHandlers(
 			BodyField:    rule.BodyField,
 			Filters:      rule.Filters,
 			Conditions:   rule.Conditions,
+
+			ConditionGroups: rule.ConditionGroups,
+			ConditionLevels: rule.ConditionLevels,
+			BaselineIndex:   baselineIndex,
+			BaselineData:    baselineData,
+			QueryType:       rule.QueryType,
+			Searches:        rule.Searches,
+			Statement:       cmp.Or(rule.SQL, rule.ESQL),
+			CollectAll:      rule.CollectAll,
+			Dedup:           rule.Dedup,
+			Timeout:         rule.Timeout,
+			PartialResults:  rule.PartialResults,
+			NoData:          rule.NoData,
+			ConsecutiveRuns: rule.ConsecutiveRuns,
+			For:             rule.For,
+
+			ShardFailureMethods: shardFailureMethods,
+			ErrorMethods:        errorMethods,
+			ErrorThreshold:      cfg.ErrorThreshold,
 		})
 		if err != nil {
 			return nil, xerrors.Errorf("error creating new *query.QueryHandler: %v", err)
@@ -77,6 +144,158 @@ func buildQueryHandlers(
 	return queryHandlers, nil
 }
 
+func buildReportHandlers(cfg *config.Config, esClient *http.Client, logger hclog.Logger) ([]*query.ReportHandler, error) {
+	creds, err := esclient.CredentialsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	reportHandlers := make([]*query.ReportHandler, 0, len(cfg.Reports))
+	for _, report := range cfg.Reports {
+		var methods []alert.Method
+		for i, output := range report.Outputs {
+			method, err := buildOutputMethod(output)
+			if err != nil {
+				return nil, xerrors.Errorf("error creating alert.AlertMethod: %v", err)
+			}
+			methods = append(methods, alert.WithOutput(method, newOutput(fieldReportOutputs, i, output)))
+		}
+
+		handler, err := query.NewReportHandler(&query.ReportHandlerConfig{
+			Name:         report.Name,
+			Logger:       logger,
+			AlertMethods: methods,
+			Client:       esClient,
+			ESUrl:        cfg.Elasticsearch.Server.ElasticsearchURL,
+			Username:     creds.Username,
+			Password:     creds.Password,
+			Schedule:     report.Schedule,
+			Period:       report.Period,
+			Rules:        report.Rules,
+			TopKeys:      report.TopKeys,
+		})
+		if err != nil {
+			return nil, xerrors.Errorf("error creating new *query.ReportHandler: %v", err)
+		}
+		reportHandlers = append(reportHandlers, handler)
+	}
+	return reportHandlers, nil
+}
+
+func newOutput(field string, index int, output config.OutputConfig) *alert.Output {
+	return &alert.Output{
+		Field: field,
+		Index: index,
+		Type:  output.Type,
+	}
+}
+
+func buildDeadLetterStore(cfg *config.Config, esClient *http.Client) (deadletter.Store, error) {
+	if cfg.DeadLetter == nil {
+		return nil, nil
+	}
+
+	switch cfg.DeadLetter.Type {
+	case config.DeadLetterFile:
+		return deadletter.NewFileStore(cfg.DeadLetter.File)
+	case config.DeadLetterElasticsearch:
+		creds, err := esclient.CredentialsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		return deadletter.NewElasticsearchStore(&deadletter.ElasticsearchStoreConfig{
+			Client:   esClient,
+			URL:      cfg.Elasticsearch.Server.ElasticsearchURL,
+			Username: creds.Username,
+			Password: creds.Password,
+			Index:    cfg.DeadLetter.Index,
+		})
+	default:
+		return nil, xerrors.Errorf("dead letter type %q is not supported", cfg.DeadLetter.Type)
+	}
+}
+
+func buildHistoryStore(cfg *config.Config, esClient *http.Client) (*history.ElasticsearchStore, error) {
+	if cfg.History == nil {
+		return nil, nil
+	}
+
+	creds, err := esclient.CredentialsFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return history.NewElasticsearchStore(&history.ElasticsearchStoreConfig{
+		Client:        esClient,
+		URL:           cfg.Elasticsearch.Server.ElasticsearchURL,
+		Username:      creds.Username,
+		Password:      creds.Password,
+		Index:         cfg.History.Index,
+		ILMPolicyName: cfg.History.ILMPolicyName,
+	})
+}
+
+func buildRoute(route *config.RouteConfig) *alert.Route {
+	if route == nil {
+		return nil
+	}
+	return &alert.Route{
+		Severities:      route.Severities,
+		Labels:          route.Labels,
+		ConditionGroups: route.ConditionGroups,
+	}
+}
+
+// buildOutputMethod builds the Method of the output along with
+// its queue, retry policy, rate limit and grouping.
+func buildOutputMethod(output config.OutputConfig) (alert.Method, error) {
+	method, err := buildMethod(output)
+	if err != nil {
+		return nil, err
+	}
+	method = alert.WithRetryPolicy(method, buildRetryPolicy(output.Retry))
+
+	// Outputs of the same type and configuration (e.g. the same
+	// Slack webhook used by several rules) share queues, rate
+	// limits and groups
+	key, err := json.Marshal(output.Config)
+	if err != nil {
+		return nil, xerrors.Errorf("error encoding output configuration: %v", err)
+	}
+	outputKey := output.Type + "|" + string(key)
+	method = alert.WithQueue(method, outputKey)
+
+	if output.RateLimit != nil {
+		method = alert.WithRateLimit(method, &alert.RateLimit{
+			Key:    outputKey,
+			Limit:  output.RateLimit.Limit,
+			Period: output.RateLimit.Period,
+			Burst:  output.RateLimit.Burst,
+		})
+	}
+	if output.Group != nil {
+		method = alert.WithGrouping(method, &alert.Grouping{
+			Key:  outputKey,
+			By:   output.Group.By,
+			Wait: output.Group.Wait,
+		})
+	}
+	return method, nil
+}
+
+func buildRetryPolicy(retry *config.RetryConfig) *alert.RetryPolicy {
+	if retry == nil {
+		return nil
+	}
+	return &alert.RetryPolicy{
+		MaxAttempts:    retry.MaxAttempts,
+		InitialBackoff: retry.InitialBackoff,
+		MaxBackoff:     retry.MaxBackoff,
+		Multiplier:     retry.Multiplier,
+		Jitter:         *retry.Jitter,
+		Deadline:       retry.Deadline,
+	}
+}
+
 func buildMethod(output config.OutputConfig) (alert.Method, error) {
 	var method alert.Method
 	var err error
@@ -100,6 +319,12 @@ func buildMethod(output config.OutputConfig) (alert.Method, error) {
 			return nil, xerrors.Errorf("error decoding email output configuration: %v", err)
 		}
 		method, err = email.NewAlertMethod(emailConfig)
+	case "elasticsearch":
+		esConfig := new(elasticsearch.AlertMethodConfig)
+		if err = mapstructure.Decode(output.Config, esConfig); err != nil {
+			return nil, xerrors.Errorf("error decoding Elasticsearch output configuration: %v", err)
+		}
+		method, err = elasticsearch.NewAlertMethod(esConfig)
 	case "sns":
 		snsConfig := new(sns.AlertMethodConfig)
 		if err = mapstructure.Decode(output.Config, snsConfig); err != nil {
@@ -0,0 +1,203 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// collectAll pages through every hit matching the query, up to the
+// rule's maximum, using a point in time and 'search_after'. The
+// returned response is the response to the first page (including
+// any aggregations) with 'hits.hits' holding all of the collected
+// hits. It is partial if the response to any page was.
+func (q *QueryHandler) collectAll(ctx context.Context) (map[string]any, error) { //nolint:gocognit
+	pit, err := q.openPIT(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		// Close the point in time even if ctx was canceled
+		if err := q.closePIT(context.WithoutCancel(ctx), pit); err != nil {
+			q.logger.Warn(fmt.Sprintf("[Rule: %q] error closing point in time", q.name), "error", err)
+		}
+	}()
+
+	var (
+		first       map[string]any
+		hits        []any
+		searchAfter any
+	)
+	for len(hits) < q.collect.MaxHits {
+		body := q.pageBody(pit, searchAfter, first == nil)
+		data, err := q.post(ctx, http.MethodGet, fmt.Sprintf("%s/_search", q.esURL), body)
+		if err != nil {
+			return nil, err
+		}
+		if id, ok := data["pit_id"].(string); ok && id != "" {
+			pit = id
+		}
+
+		page, _ := hitsOf(data)["hits"].([]any)
+		if first == nil {
+			first = data
+		} else {
+			mergePartial(first, data)
+		}
+		hits = append(hits, page...)
+
+		if len(page) < q.collect.PageSize {
+			break
+		}
+
+		last, ok := page[len(page)-1].(map[string]any)
+		if !ok || last["sort"] == nil {
+			return nil, xerrors.New("last hit of page has no 'sort' field to search after")
+		}
+		searchAfter = last["sort"]
+	}
+
+	if len(hits) > q.collect.MaxHits {
+		q.logger.Warn(fmt.Sprintf("[Rule: %q] collected the maximum number of hits", q.name),
+			"max_hits", q.collect.MaxHits)
+		hits = hits[:q.collect.MaxHits]
+	}
+
+	outer := hitsOf(first)
+	outer["hits"] = hits
+	first["hits"] = outer
+	return first, nil
+}
+
+// pageBody returns the body of the request for a page of hits. Only
+// the first page requests the aggregations of the query.
+func (q *QueryHandler) pageBody(pit string, searchAfter any, first bool) map[string]any {
+	body := maps.Clone(q.withTimeout(q.queryData))
+	delete(body, "from")
+	if !first {
+		delete(body, "aggs")
+		delete(body, "aggregations")
+	}
+
+	body["size"] = q.collect.PageSize
+	body["pit"] = map[string]any{
+		"id":         pit,
+		"keep_alive": q.collect.KeepAlive,
+	}
+	body["sort"] = withTiebreaker(body["sort"])
+	if searchAfter != nil {
+		body["search_after"] = searchAfter
+	}
+	return body
+}
+
+// withTiebreaker returns the sort of the query with '_shard_doc' as
+// its last field, unless it already sorts on it, so that no hit is
+// skipped or repeated when searching after hits with the same sort
+// values (e.g. the same '@timestamp').
+func withTiebreaker(sort any) []any {
+	var fields []any
+	switch s := sort.(type) {
+	case nil:
+	case []any:
+		fields = slices.Clone(s)
+	default:
+		fields = []any{s}
+	}
+
+	for _, field := range fields {
+		switch f := field.(type) {
+		case string:
+			if f == "_shard_doc" {
+				return fields
+			}
+		case map[string]any:
+			if _, ok := f["_shard_doc"]; ok {
+				return fields
+			}
+		}
+	}
+	return append(fields, map[string]any{"_shard_doc": "asc"})
+}
+
+// mergePartial marks the response to the first page as partial if the
+// response to a later page is, so that checkPartial covers every page.
+func mergePartial(first, page map[string]any) {
+	if timedOut, ok := page["timed_out"].(bool); ok && timedOut {
+		first["timed_out"] = true
+	}
+
+	shards, _ := page["_shards"].(map[string]any)
+	failed, _ := shards["failed"].(json.Number)
+	n, err := failed.Int64()
+	if err != nil || n <= 0 {
+		return
+	}
+
+	firstShards, ok := first["_shards"].(map[string]any)
+	if !ok {
+		first["_shards"] = shards
+		return
+	}
+	// The pages are searched on the same shards, so the most shards
+	// that failed on any page is how many failed
+	prev, _ := firstShards["failed"].(json.Number)
+	if m, err := prev.Int64(); err != nil || n > m {
+		firstShards["failed"] = failed
+	}
+	failures, _ := firstShards["failures"].([]any)
+	more, _ := shards["failures"].([]any)
+	firstShards["failures"] = append(failures, more...)
+}
+
+func (q *QueryHandler) openPIT(ctx context.Context) (string, error) {
+	u := fmt.Sprintf("%s/%s/_pit?keep_alive=%s", q.esURL, q.queryIndex, url.QueryEscape(q.collect.KeepAlive))
+	req, err := q.newRequest(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return "", xerrors.Errorf("error creating new request: %v", err)
+	}
+
+	data, err := q.do(req)
+	if err != nil {
+		return "", xerrors.Errorf("error opening point in time: %v", err)
+	}
+
+	id, ok := data["id"].(string)
+	if !ok || strings.TrimSpace(id) == "" {
+		return "", xerrors.New("no point in time ID in Elasticsearch response")
+	}
+	return id, nil
+}
+
+func (q *QueryHandler) closePIT(ctx context.Context, pit string) error {
+	_, err := q.post(ctx, http.MethodDelete, fmt.Sprintf("%s/_pit", q.esURL), map[string]any{"id": pit})
+	return err
+}
+
+// hitsOf returns the 'hits' object of the response.
+func hitsOf(data map[string]any) map[string]any {
+	if hits, ok := data["hits"].(map[string]any); ok {
+		return hits
+	}
+	return map[string]any{}
+}
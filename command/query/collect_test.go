@@ -0,0 +1,241 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/file"
+	"github.com/morningconsult/go-elasticsearch-alerts/config"
+)
+
+// newPITServer returns a server with total documents which are
+// served in pages using a point in time and 'search_after'. The
+// fields of later are added to the responses to the pages after
+// the first one.
+func newPITServer(t *testing.T, total int, closed *atomic.Bool, later map[string]any) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/test-index/_pit":
+			if r.URL.Query().Get("keep_alive") != "1m" {
+				http.Error(w, "unexpected keep_alive", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"id": "pit-1"})
+		case r.Method == http.MethodDelete && r.URL.Path == "/_pit":
+			closed.Store(true)
+			json.NewEncoder(w).Encode(map[string]any{"succeeded": true})
+		case r.URL.Path == "/_search":
+			var body struct {
+				Size        int            `json:"size"`
+				PIT         map[string]any `json:"pit"`
+				SearchAfter []int          `json:"search_after"`
+				Aggs        map[string]any `json:"aggs"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.PIT["id"] != "pit-1" {
+				http.Error(w, "unexpected body", http.StatusBadRequest)
+				return
+			}
+
+			start := 0
+			if len(body.SearchAfter) > 0 {
+				start = body.SearchAfter[0] + 1
+			}
+			hits := []any{}
+			for i := start; i < total && i < start+body.Size; i++ {
+				hits = append(hits, map[string]any{
+					"_id":     i,
+					"_source": map[string]any{"n": i},
+					"sort":    []int{i},
+				})
+			}
+
+			resp := map[string]any{
+				"pit_id": "pit-1",
+				"hits": map[string]any{
+					"total": map[string]any{"value": total},
+					"hits":  hits,
+				},
+			}
+			if body.Aggs != nil {
+				resp["aggregations"] = map[string]any{"first_page": true}
+			}
+			if start > 0 {
+				maps.Copy(resp, later)
+			}
+			json.NewEncoder(w).Encode(resp)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+}
+
+func TestCollectAll(t *testing.T) {
+	cases := []struct {
+		name     string
+		total    int
+		maxHits  int
+		expected int
+	}{
+		{"fewer-than-a-page", 3, 100, 3},
+		{"several-pages", 25, 100, 25},
+		{"exact-pages", 20, 100, 20},
+		{"capped", 25, 12, 12},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			closed := new(atomic.Bool)
+			ts := newPITServer(t, tc.total, closed, nil)
+			defer ts.Close()
+
+			collect := &config.CollectAllConfig{
+				MaxHits:     tc.maxHits,
+				PageSize:    5,
+				KeepAlive:   "1m",
+				SummaryHits: 2,
+			}
+
+			qh, err := NewQueryHandler(&QueryHandlerConfig{
+				Name:         "Test Collect",
+				ESUrl:        ts.URL,
+				QueryIndex:   "test-index",
+				AlertMethods: []alert.Method{&file.AlertMethod{}},
+				QueryData: map[string]any{
+					"query": map[string]any{"match_all": map[string]any{}},
+					"aggs":  map[string]any{"foo": map[string]any{}},
+				},
+				CollectAll: collect,
+				Schedule:   "@every 10m",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := qh.query(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !closed.Load() {
+				t.Error("point in time was not closed")
+			}
+			if data["aggregations"] == nil {
+				t.Error("expected the aggregations of the first page")
+			}
+
+			res, err := qh.process(data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.hits) != tc.expected {
+				t.Fatalf("expected %d hits, got %d", tc.expected, len(res.hits))
+			}
+			if len(res.records) != 1 {
+				t.Fatalf("expected 1 record, got %d", len(res.records))
+			}
+			if suffix := fmt.Sprintf("(2 of %d hits shown)", tc.expected); !strings.HasSuffix(res.records[0].Summary, suffix) {
+				t.Errorf("unexpected summary:\n%s", res.records[0].Summary)
+			}
+		})
+	}
+}
+
+func TestCollectAll_PartialPages(t *testing.T) {
+	cases := []struct {
+		name   string
+		later  map[string]any
+		reason string
+	}{
+		{
+			name:   "timed-out",
+			later:  map[string]any{"timed_out": true},
+			reason: "the query timed out",
+		},
+		{
+			name: "shard-failed",
+			later: map[string]any{"_shards": map[string]any{
+				"total":    2,
+				"failed":   1,
+				"failures": []any{map[string]any{"shard": 1, "reason": map[string]any{"type": "test"}}},
+			}},
+			reason: "1 of 2 shards failed",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			closed := new(atomic.Bool)
+			ts := newPITServer(t, 12, closed, tc.later)
+			defer ts.Close()
+
+			qh, err := NewQueryHandler(&QueryHandlerConfig{
+				Name:           "Test Collect",
+				ESUrl:          ts.URL,
+				QueryIndex:     "test-index",
+				AlertMethods:   []alert.Method{&file.AlertMethod{}},
+				QueryData:      map[string]any{"query": map[string]any{"match_all": map[string]any{}}},
+				CollectAll:     &config.CollectAllConfig{MaxHits: 100, PageSize: 5, KeepAlive: "1m"},
+				PartialResults: partialResultsFail,
+				Schedule:       "@every 10m",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := qh.query(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = qh.checkPartial(data, make(chan *alert.Alert, 1))
+			if err == nil || !strings.Contains(err.Error(), tc.reason) {
+				t.Errorf("expected the partial page to fail the run with %q, got %v", tc.reason, err)
+			}
+		})
+	}
+}
+
+func TestWithTiebreaker(t *testing.T) {
+	tiebreaker := map[string]any{"_shard_doc": "asc"}
+	cases := []struct {
+		name     string
+		sort     any
+		expected []any
+	}{
+		{"none", nil, []any{tiebreaker}},
+		{"field", "@timestamp", []any{"@timestamp", tiebreaker}},
+		{"object", map[string]any{"@timestamp": "desc"}, []any{map[string]any{"@timestamp": "desc"}, tiebreaker}},
+		{"list", []any{"@timestamp", "host"}, []any{"@timestamp", "host", tiebreaker}},
+		{"already-last", []any{"@timestamp", "_shard_doc"}, []any{"@timestamp", "_shard_doc"}},
+		{"already-object", []any{map[string]any{"_shard_doc": "desc"}}, []any{map[string]any{"_shard_doc": "desc"}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if sort := withTiebreaker(tc.sort); !reflect.DeepEqual(sort, tc.expected) {
+				t.Errorf("expected sort %v, got %v", tc.expected, sort)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/jsonpath"
+)
+
+const sourceSuffix = "._source"
+
+// bodyElements returns the elements of the response at the body field
+// and, if the rule deduplicates hits, the key identifying each element.
+// If the body field ends with '._source', keys are looked up in the hits
+// themselves so that metadata such as '_id' can be used. Elements with
+// no key have an empty key and are never deduplicated.
+func (q *QueryHandler) bodyElements(respData map[string]any) ([]any, []string) {
+	if q.dedup == nil {
+		return jsonpath.GetAll(respData, q.bodyField), nil
+	}
+
+	if parent, ok := strings.CutSuffix(q.bodyField, sourceSuffix); ok {
+		var (
+			elems []any
+			keys  []string
+		)
+		for _, elem := range jsonpath.GetAll(respData, parent) {
+			hit, ok := elem.(map[string]any)
+			if !ok || hit["_source"] == nil {
+				continue
+			}
+			elems = append(elems, hit["_source"])
+			keys = append(keys, keyOf(hit, q.dedup.Key))
+		}
+		return elems, keys
+	}
+
+	elems := jsonpath.GetAll(respData, q.bodyField)
+	keys := make([]string, len(elems))
+	for i, elem := range elems {
+		if m, ok := elem.(map[string]any); ok {
+			keys[i] = keyOf(m, q.dedup.Key)
+		}
+	}
+	return elems, keys
+}
+
+// unseen removes the elements whose keys were alerted on within the
+// rule's deduplication TTL. It returns the remaining elements and
+// their non-empty keys.
+func (q *QueryHandler) unseen(elems []any, keys []string, now time.Time) ([]any, []string) {
+	if q.dedup == nil {
+		return elems, nil
+	}
+
+	var (
+		kept     = make([]any, 0, len(elems))
+		keptKeys []string
+	)
+	for i, elem := range elems {
+		key := keys[i]
+		if key == "" {
+			kept = append(kept, elem)
+			continue
+		}
+		if seen, ok := q.state.Seen[key]; ok && now.Sub(seen) < q.dedup.TTL {
+			continue
+		}
+		kept = append(kept, elem)
+		keptKeys = append(keptKeys, key)
+	}
+	return kept, keptKeys
+}
+
+// remember records that the hits with the given keys were alerted
+// on and forgets the hits alerted on longer ago than the rule's
+// deduplication TTL. If more hits than the rule's maximum are then
+// remembered, those alerted on longest ago are forgotten.
+func (q *QueryHandler) remember(keys []string, now time.Time) {
+	if q.dedup == nil {
+		return
+	}
+
+	for key, seen := range q.state.Seen {
+		if now.Sub(seen) >= q.dedup.TTL {
+			delete(q.state.Seen, key)
+		}
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	if q.state.Seen == nil {
+		q.state.Seen = make(map[string]time.Time, len(keys))
+	}
+	for _, key := range keys {
+		q.state.Seen[key] = now
+	}
+
+	excess := len(q.state.Seen) - q.dedup.MaxKeys
+	if q.dedup.MaxKeys <= 0 || excess <= 0 {
+		return
+	}
+
+	oldest := slices.SortedFunc(maps.Keys(q.state.Seen), func(a, b string) int {
+		return cmp.Or(q.state.Seen[a].Compare(q.state.Seen[b]), strings.Compare(a, b))
+	})
+	for _, key := range oldest[:excess] {
+		delete(q.state.Seen, key)
+	}
+}
+
+func keyOf(m map[string]any, path string) string {
+	for _, v := range jsonpath.GetAll(m, path) {
+		if v != nil {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
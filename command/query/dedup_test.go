@@ -0,0 +1,110 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/config"
+)
+
+func TestProcess_Dedup(t *testing.T) {
+	response := func(ids ...string) map[string]any {
+		hits := make([]any, 0, len(ids))
+		for _, id := range ids {
+			hits = append(hits, map[string]any{
+				"_id":     id,
+				"_source": map[string]any{"message": "message " + id, "event": map[string]any{"id": "event-" + id}},
+			})
+		}
+		return map[string]any{"hits": map[string]any{"hits": hits}}
+	}
+
+	cases := []struct {
+		name      string
+		bodyField string
+		key       string
+	}{
+		{"hit-id", defaultBodyField, "_id"},
+		{"source-field", defaultBodyField, "_source.event.id"},
+		{"body-element-field", "hits.hits", "_id"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			qh := &QueryHandler{
+				logger:    hclog.NewNullLogger(),
+				bodyField: tc.bodyField,
+				dedup:     &config.DedupConfig{Key: tc.key, TTL: time.Hour},
+				state:     new(ruleState),
+			}
+			start := time.Now()
+
+			res, err := qh.process(response("a", "b"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.hits) != 2 || len(res.keys) != 2 {
+				t.Fatalf("expected 2 hits and keys, got %d and %d", len(res.hits), len(res.keys))
+			}
+			qh.remember(res.keys, start)
+
+			res, err = qh.process(response("b", "c"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.hits) != 1 || !strings.Contains(res.records[0].Text, "message c") {
+				t.Fatalf("expected only hit c, got %v", res.hits)
+			}
+
+			res, err = qh.process(response("a", "b"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.records) != 0 {
+				t.Fatalf("expected no records, got %d", len(res.records))
+			}
+
+			// Once the TTL has passed the hits are forgotten
+			qh.remember(nil, start.Add(2*time.Hour))
+			if len(qh.state.Seen) != 0 {
+				t.Fatalf("expected seen hits to expire, got %v", qh.state.Seen)
+			}
+		})
+	}
+}
+
+func TestRemember_MaxKeys(t *testing.T) {
+	qh := &QueryHandler{
+		dedup: &config.DedupConfig{TTL: time.Hour, MaxKeys: 3},
+		state: new(ruleState),
+	}
+	start := time.Now()
+
+	qh.remember([]string{"a", "b"}, start)
+	qh.remember([]string{"c"}, start.Add(time.Minute))
+	qh.remember([]string{"d", "a"}, start.Add(2*time.Minute))
+
+	// b is the hit alerted on longest ago, since a was alerted on again
+	if len(qh.state.Seen) != 3 {
+		t.Fatalf("expected 3 seen hits, got %v", qh.state.Seen)
+	}
+	if _, ok := qh.state.Seen["b"]; ok {
+		t.Fatalf("expected the oldest hit to be forgotten, got %v", qh.state.Seen)
+	}
+}
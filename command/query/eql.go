@@ -0,0 +1,81 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/jsonpath"
+)
+
+const eqlSequencesField = "hits.sequences"
+
+// eql executes the query with the EQL search API. Matched events
+// are returned in 'hits.events' and matched sequences in
+// 'hits.sequences'.
+func (q *QueryHandler) eql(ctx context.Context, index string, body map[string]any) (map[string]any, error) {
+	return q.post(ctx, http.MethodGet, fmt.Sprintf("%s/%s/_eql/search", q.esURL, index), body)
+}
+
+// sequenceRecords converts each sequence matched by an EQL query
+// into an *alert.Record whose text holds the sources of the events
+// of the sequence, so that each sequence is grouped in the outputs.
+func (q *QueryHandler) sequenceRecords(respData map[string]any) ([]*alert.Record, error) {
+	var records []*alert.Record
+	for i, elem := range jsonpath.GetAll(respData, eqlSequencesField) {
+		sequence, ok := elem.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		events, _ := sequence["events"].([]any)
+		texts := make([]string, 0, len(events))
+		for _, e := range events {
+			event, ok := e.(map[string]any)
+			if !ok {
+				continue
+			}
+			data, err := json.MarshalIndent(event["_source"], "", "    ")
+			if err != nil {
+				return nil, err
+			}
+			texts = append(texts, string(data))
+		}
+
+		if len(texts) == 0 {
+			continue
+		}
+
+		filter := fmt.Sprintf("%s[%d]", eqlSequencesField, i)
+		if keys, ok := sequence["join_keys"].([]any); ok && len(keys) > 0 {
+			joined := make([]string, 0, len(keys))
+			for _, key := range keys {
+				joined = append(joined, fmt.Sprint(key))
+			}
+			filter = fmt.Sprintf("%s (%s)", filter, strings.Join(joined, " - "))
+		}
+
+		records = append(records, &alert.Record{
+			Filter:    filter,
+			Text:      strings.Join(texts, hitsDelimiter),
+			BodyField: true,
+		})
+	}
+	return records, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/file"
+	"github.com/morningconsult/go-elasticsearch-alerts/config"
+)
+
+func TestQuery_EQL(t *testing.T) {
+	cases := []struct {
+		name     string
+		response string
+		filters  []string
+	}{
+		{
+			name: "sequences",
+			response: `{"hits":{"total":{"value":2},"sequences":[
+  {"join_keys":["web-1"],"events":[
+    {"_id":"1","_source":{"event":{"category":"process"},"process":{"name":"curl"}}},
+    {"_id":"2","_source":{"event":{"category":"network"},"destination":{"ip":"10.0.0.1"}}}
+  ]},
+  {"join_keys":["web-2"],"events":[
+    {"_id":"3","_source":{"event":{"category":"process"},"process":{"name":"wget"}}},
+    {"_id":"4","_source":{"event":{"category":"network"},"destination":{"ip":"10.0.0.2"}}}
+  ]}
+]}}`,
+			filters: []string{
+				"hits.sequences[0] (web-1)",
+				"hits.sequences[1] (web-2)",
+			},
+		},
+		{
+			name:     "events",
+			response: `{"hits":{"total":{"value":1},"events":[{"_id":"1","_source":{"process":{"name":"curl"}}}]}}`,
+			filters:  []string{eqlBodyField},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/logs-endpoint-*/_eql/search" {
+					http.Error(w, "unexpected path "+r.URL.Path, http.StatusNotFound)
+					return
+				}
+				fmt.Fprint(w, tc.response)
+			}))
+			defer ts.Close()
+
+			qh, err := NewQueryHandler(&QueryHandlerConfig{
+				Name:         "Test EQL",
+				ESUrl:        ts.URL,
+				QueryIndex:   "logs-endpoint-*",
+				QueryType:    config.QueryTypeEQL,
+				AlertMethods: []alert.Method{&file.AlertMethod{}},
+				QueryData: map[string]any{
+					"query": `sequence by host.name [process where true] [network where true]`,
+				},
+				Schedule: "@every 10m",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := qh.query(t.Context())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			res, err := qh.process(data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(res.records) != len(tc.filters) {
+				t.Fatalf("expected %d records, got %d", len(tc.filters), len(res.records))
+			}
+			for i, record := range res.records {
+				if record.Filter != tc.filters[i] {
+					t.Errorf("record %d: expected filter %q, got %q", i, tc.filters[i], record.Filter)
+				}
+				if !record.BodyField || record.Text == "" {
+					t.Errorf("record %d: expected body field text, got %+v", i, record)
+				}
+			}
+
+			if tc.name == "sequences" && !strings.Contains(res.records[1].Text, "wget") {
+				t.Errorf("unexpected sequence text:\n%s", res.records[1].Text)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"fmt"
+
+	uuid "github.com/hashicorp/go-uuid"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+)
+
+const (
+	defaultErrorThreshold = 3
+
+	errorFilter    = "error"
+	recoveryFilter = "recovered"
+)
+
+// failed records that this run of the rule failed with err. Once
+// the rule has failed on errThreshold consecutive runs, an alert is
+// sent to the error outputs. Only one such alert is sent until the
+// rule succeeds again.
+func (q *QueryHandler) failed(err error, outputCh chan *alert.Alert) {
+	if len(q.errMethods) == 0 {
+		return
+	}
+
+	q.state.Failures++
+	if q.state.Failures != q.errThreshold {
+		return
+	}
+
+	q.sendErrorAlert(
+		fmt.Sprintf("This rule has failed on %d consecutive runs", q.state.Failures),
+		"error",
+		&alert.Record{Filter: errorFilter, Text: err.Error()},
+		outputCh,
+	)
+}
+
+// succeeded records that this run of the rule succeeded. If an alert
+// about the rule failing was sent, a recovery notice is sent to the
+// error outputs.
+func (q *QueryHandler) succeeded(outputCh chan *alert.Alert) {
+	if len(q.errMethods) == 0 || q.state.Failures == 0 {
+		return
+	}
+
+	failures := q.state.Failures
+	q.state.Failures = 0
+	if failures < q.errThreshold {
+		return
+	}
+
+	q.sendErrorAlert(
+		"This rule has recovered",
+		"info",
+		&alert.Record{
+			Filter: recoveryFilter,
+			Text:   fmt.Sprintf("The rule succeeded after failing on %d consecutive runs", failures),
+		},
+		outputCh,
+	)
+}
+
+func (q *QueryHandler) sendErrorAlert(description, severity string, record *alert.Record, outputCh chan *alert.Alert) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		q.logger.Error(fmt.Sprintf("[Rule: %q] error creating new random UUID", q.name), "error", err)
+		return
+	}
+
+	outputCh <- &alert.Alert{
+		ID:          id,
+		RuleName:    q.name,
+		Namespace:   q.namespace,
+		Description: description,
+		Owner:       q.owner,
+		RunbookURL:  q.runbookURL,
+		Severity:    severity,
+		Labels:      q.labels,
+		Methods:     q.errMethods,
+		Records:     []*alert.Record{record},
+	}
+}
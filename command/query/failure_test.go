@@ -0,0 +1,105 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"errors"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/file"
+)
+
+func TestFailures(t *testing.T) {
+	cases := []struct {
+		name    string
+		runs    []bool
+		filters []string
+	}{
+		{
+			name: "below-threshold",
+			runs: []bool{false, false, true},
+		},
+		{
+			name:    "at-threshold",
+			runs:    []bool{false, false, false},
+			filters: []string{errorFilter},
+		},
+		{
+			name:    "alerts-once",
+			runs:    []bool{false, false, false, false, false},
+			filters: []string{errorFilter},
+		},
+		{
+			name:    "recovery",
+			runs:    []bool{false, false, false, false, true, true},
+			filters: []string{errorFilter, recoveryFilter},
+		},
+		{
+			name:    "interrupted",
+			runs:    []bool{false, false, true, false, false, false},
+			filters: []string{errorFilter},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			outputCh := make(chan *alert.Alert, len(tc.runs))
+			qh := &QueryHandler{
+				name:         "test-rule",
+				logger:       hclog.NewNullLogger(),
+				errMethods:   []alert.Method{&file.AlertMethod{}},
+				errThreshold: 3,
+				state:        new(ruleState),
+			}
+
+			for _, ok := range tc.runs {
+				if ok {
+					qh.succeeded(outputCh)
+				} else {
+					qh.failed(errors.New("no such index [foo]"), outputCh)
+				}
+			}
+			close(outputCh)
+
+			var filters []string
+			for a := range outputCh {
+				if len(a.Records) != 1 {
+					t.Fatalf("expected 1 record, got %d", len(a.Records))
+				}
+				filters = append(filters, a.Records[0].Filter)
+			}
+			if len(filters) != len(tc.filters) {
+				t.Fatalf("expected alerts %q, got %q", tc.filters, filters)
+			}
+			for i := range filters {
+				if filters[i] != tc.filters[i] {
+					t.Errorf("expected alerts %q, got %q", tc.filters, filters)
+				}
+			}
+		})
+	}
+}
+
+func TestFailures_NoErrorMethods(t *testing.T) {
+	outputCh := make(chan *alert.Alert, 1)
+	qh := &QueryHandler{errThreshold: 1, state: new(ruleState)}
+
+	qh.failed(errors.New("boom"), outputCh)
+	if len(outputCh) != 0 || qh.state.Failures != 0 {
+		t.Fatal("failures should not be tracked without error outputs")
+	}
+}
@@ -15,6 +15,7 @@ package query
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -22,6 +23,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -35,16 +37,23 @@ import (
 
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
 	"github.com/morningconsult/go-elasticsearch-alerts/config"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/esclient"
 	"github.com/morningconsult/go-elasticsearch-alerts/internal/lock"
 )
 
 const (
 	templateVersion        string = "0.0.3"
-	envESBasicAuthUsername string = "GO_ELASTICSEARCH_ALERTS_ES_USERNAME"
-	envESBasicAuthPassword string = "GO_ELASTICSEARCH_ALERTS_ES_PASSWORD"
 	defaultStateIndexAlias string = "go-es-alerts"
 	defaultTimestampFormat string = time.RFC3339
 	defaultBodyField       string = "hits.hits._source"
+	queryTypeSearch        string = config.QueryTypeSearch
+	queryTypeCount         string = config.QueryTypeCount
+	queryTypeMSearch       string = config.QueryTypeMSearch
+	queryTypeSQL           string = config.QueryTypeSQL
+	queryTypeESQL          string = config.QueryTypeESQL
+	queryTypeEQL           string = config.QueryTypeEQL
+	tabularBodyField       string = "rows"
+	eqlBodyField           string = "hits.events._source"
 )
 
 // QueryHandlerConfig is passed as an argument to NewQueryHandler().
@@ -53,6 +62,21 @@ type QueryHandlerConfig struct { //nolint:revive
 	// the 'name' field of the rule configuration file
 	Name string
 
+	// Namespace is the namespace of the rule (typically the
+	// team that owns it). It is derived from the directory of
+	// the rule configuration file unless set explicitly
+	Namespace string
+
+	// Description, Owner, RunbookURL, Severity and Labels
+	// describe the rule to those responding to its alerts.
+	// These should come from the fields of the same names
+	// in the rule configuration file
+	Description string
+	Owner       string
+	RunbookURL  string
+	Severity    string
+	Labels      map[string]string
+
 	// AlertMethods will be passed along with any results returned
 	// by a query to the alert handler via the outputCh
 	AlertMethods []alert.Method
@@ -96,6 +120,91 @@ type QueryHandlerConfig struct { //nolint:revive
 	// Conditions are used to make alerts fire when certain criteria
 	// are met.
 	Conditions []config.Condition
+
+	// ConditionGroups are named sets of conditions. If any are
+	// provided, alerts only fire when at least one group's
+	// conditions are all met
+	ConditionGroups []config.ConditionGroup
+
+	// ConditionLevels are ordered from least to most severe. If
+	// any are provided, alerts only fire when at least one level's
+	// conditions are all met and take the severity of the highest
+	// such level
+	ConditionLevels []config.ConditionLevel
+
+	// BaselineIndex and BaselineData are the index and payload of
+	// the query whose response conditions comparing to 'baseline'
+	// are evaluated against. These should come from the 'baseline'
+	// field of the rule configuration file
+	BaselineIndex string
+	BaselineData  map[string]any
+
+	// QueryType is how the rule queries Elasticsearch (see the
+	// config.QueryType* constants). It defaults to "search". This
+	// should come from the 'query_type' field of the rule
+	// configuration file
+	QueryType string
+
+	// Searches are the named searches executed when QueryType is
+	// "msearch". This should come from the 'searches' field of the
+	// rule configuration file
+	Searches []config.SearchConfig
+
+	// CollectAll makes the rule page through every hit matching
+	// the query. This should come from the 'collect_all' field of
+	// the rule configuration file
+	CollectAll *config.CollectAllConfig
+
+	// Timeout is how long the query may take. It is sent to
+	// Elasticsearch and enforced by the client. This should come
+	// from the 'timeout' field of the rule configuration file
+	Timeout time.Duration
+
+	// PartialResults is what to do with partial responses (see the
+	// config.PartialResults* constants). This should come from the
+	// 'partial_results' field of the rule configuration file
+	PartialResults string
+
+	// ShardFailureMethods are the methods by which alerts about
+	// partial responses are sent. These should come from the
+	// 'shard_failure_outputs' field of the rule configuration file
+	ShardFailureMethods []alert.Method
+
+	// Dedup makes the rule exclude hits it has already alerted on
+	// from the body field. This should come from the 'dedup' field
+	// of the rule configuration file
+	Dedup *config.DedupConfig
+
+	// Statement is the SQL or ES|QL statement executed when
+	// QueryType is "sql" or "esql". This should come from the
+	// 'sql' or 'esql' field of the rule configuration file
+	Statement string
+
+	// NoData makes the rule also alert when the query returns no
+	// data for a number of consecutive runs. This should come from
+	// the 'no_data' field of the rule configuration file
+	NoData *config.NoDataConfig
+
+	// ConsecutiveRuns is the number of consecutive runs on which
+	// the conditions must hold before an alert is sent. This should
+	// come from the 'consecutive_runs' field of the rule
+	// configuration file
+	ConsecutiveRuns int
+
+	// For is how long the conditions must have held before an
+	// alert is sent. This should come from the 'for' field of
+	// the rule configuration file
+	For time.Duration
+
+	// ErrorMethods are the methods by which alerts about the rule
+	// repeatedly failing to run are sent. These should come from
+	// the 'error_outputs' field of the main configuration file
+	ErrorMethods []alert.Method
+
+	// ErrorThreshold is the number of consecutive failed runs after
+	// which an alert is sent to the ErrorMethods. This should come
+	// from the 'error_threshold' field of the main configuration file
+	ErrorThreshold int
 }
 
 // QueryHandler performs the defined Elasticsearch query at the
@@ -106,6 +215,12 @@ type QueryHandler struct { //nolint:revive
 	StopCh chan struct{}
 
 	name         string
+	namespace    string
+	description  string
+	owner        string
+	runbookURL   string
+	severity     string
+	labels       map[string]string
 	hostname     string
 	logger       hclog.Logger
 	alertMethods []alert.Method
@@ -113,11 +228,34 @@ type QueryHandler struct { //nolint:revive
 	esURL        string
 	queryIndex   string
 	queryData    map[string]any
+	queryType    string
+	searches     []config.SearchConfig
+	statement    string
+	collect      *config.CollectAllConfig
+	dedup        *config.DedupConfig
+	timeout      time.Duration
+	partial      string
+	shardMethods []alert.Method
 	schedule     cron.Schedule
 	bodyField    string
 	filters      []string
 	conditions   []config.Condition
-	newRequest   func(ctx context.Context, method, url string, data io.Reader) (*http.Request, error)
+	groups       []config.ConditionGroup
+	levels       []config.ConditionLevel
+	baseIndex    string
+	baseData     map[string]any
+	noData       *config.NoDataConfig
+	minRuns      int
+	minDuration  time.Duration
+	errMethods   []alert.Method
+	errThreshold int
+	state        *ruleState
+
+	// leader is whether this node held the lock on the most
+	// recent run, in which case q.state is up to date
+	leader bool
+
+	newRequest func(ctx context.Context, method, url string, data io.Reader) (*http.Request, error)
 }
 
 // NewQueryHandler creates a new *QueryHandler instance.
@@ -155,12 +293,24 @@ func NewQueryHandler(config *QueryHandlerConfig) (*QueryHandler, error) {
 
 	if config.BodyField == "" {
 		config.BodyField = defaultBodyField
+		switch {
+		case isTabular(config.QueryType):
+			config.BodyField = tabularBodyField
+		case config.QueryType == queryTypeEQL:
+			config.BodyField = eqlBodyField
+		}
 	}
 
 	return &QueryHandler{
 		StopCh: make(chan struct{}),
 
 		name:         config.Name,
+		namespace:    config.Namespace,
+		description:  config.Description,
+		owner:        config.Owner,
+		runbookURL:   config.RunbookURL,
+		severity:     config.Severity,
+		labels:       config.Labels,
 		hostname:     hostname,
 		logger:       config.Logger,
 		alertMethods: config.AlertMethods,
@@ -168,10 +318,28 @@ func NewQueryHandler(config *QueryHandlerConfig) (*QueryHandler, error) {
 		esURL:        config.ESUrl,
 		queryIndex:   config.QueryIndex,
 		queryData:    config.QueryData,
+		queryType:    cmp.Or(config.QueryType, queryTypeSearch),
+		searches:     config.Searches,
+		statement:    config.Statement,
+		collect:      config.CollectAll,
+		dedup:        config.Dedup,
+		timeout:      config.Timeout,
+		partial:      config.PartialResults,
+		shardMethods: config.ShardFailureMethods,
 		schedule:     schedule,
 		bodyField:    config.BodyField,
 		filters:      config.Filters,
 		conditions:   config.Conditions,
+		groups:       config.ConditionGroups,
+		levels:       config.ConditionLevels,
+		baseIndex:    config.BaselineIndex,
+		baseData:     config.BaselineData,
+		noData:       config.NoData,
+		minRuns:      config.ConsecutiveRuns,
+		minDuration:  config.For,
+		errMethods:   config.ErrorMethods,
+		errThreshold: cmp.Or(config.ErrorThreshold, defaultErrorThreshold),
+		state:        new(ruleState),
 		newRequest:   reqFunc,
 	}, nil
 }
@@ -188,7 +356,7 @@ func validateConfig(config *QueryHandlerConfig) error {
 		allErrors = multierror.Append(allErrors, xerrors.New("no Elasticsearch URL provided"))
 	}
 
-	if config.QueryIndex == "" {
+	if config.QueryIndex == "" && !isTabular(config.QueryType) {
 		allErrors = multierror.Append(allErrors, xerrors.New("no Elasticsearch index provided"))
 	}
 
@@ -196,36 +364,29 @@ func validateConfig(config *QueryHandlerConfig) error {
 		allErrors = multierror.Append(allErrors, xerrors.New("at least one alert method must be specified"))
 	}
 
-	if len(config.QueryData) < 1 {
+	switch {
+	case config.QueryType == queryTypeMSearch:
+		if len(config.Searches) < 1 {
+			allErrors = multierror.Append(allErrors, xerrors.New("no searches provided"))
+		}
+	case isTabular(config.QueryType):
+		if config.Statement == "" {
+			allErrors = multierror.Append(allErrors, xerrors.New("no SQL or ES|QL statement provided"))
+		}
+	case len(config.QueryData) < 1:
 		allErrors = multierror.Append(allErrors, xerrors.New("no query body provided"))
 	}
 	return allErrors.ErrorOrNil()
 }
 
 func buildHTTPRequestFunc() (func(context.Context, string, string, io.Reader) (*http.Request, error), error) {
-	username := os.Getenv(envESBasicAuthUsername)
-	password := os.Getenv(envESBasicAuthPassword)
-
-	if (username != "" || password != "") && (username == "" || password == "") {
-		return nil, xerrors.Errorf(
-			"both %s and %s should be set when using basic auth",
-			envESBasicAuthUsername,
-			envESBasicAuthPassword,
-		)
+	creds, err := esclient.CredentialsFromEnv()
+	if err != nil {
+		return nil, err
 	}
 
 	f := func(ctx context.Context, method, url string, data io.Reader) (*http.Request, error) {
-		req, err := http.NewRequestWithContext(ctx, method, url, data)
-		if err != nil {
-			return nil, xerrors.Errorf("error creating new HTTP request instance: %v", err)
-		}
-		if data != nil {
-			req.Header.Set("Content-Type", "application/json")
-		}
-		if username != "" {
-			req.SetBasicAuth(username, password)
-		}
-		return req, nil
+		return esclient.NewRequest(ctx, method, url, data, creds)
 	}
 
 	return f, nil
@@ -238,8 +399,10 @@ func buildHTTPRequestFunc() (func(context.Context, string, string, io.Reader) (*
 // will execute the query immediately. Afterwards, it will attempt to
 // write a new state document to Elasticsearch in which the 'next_query'
 // equals the next time the query shall be executed per the provided
-// cron schedule. It will only execute the query if distLock.Acquired()
-// is true.
+// cron schedule. It will only execute the query, and write the state
+// document, if distLock.Acquired() is true. When this node acquires
+// the lock, the rule state is first reloaded from the latest state
+// document.
 func (q *QueryHandler) Run( //nolint:gocyclo,gocognit
 	ctx context.Context,
 	outputCh chan *alert.Alert,
@@ -247,9 +410,8 @@ func (q *QueryHandler) Run( //nolint:gocyclo,gocognit
 	distLock *lock.Lock,
 ) {
 	var (
-		now           = time.Now()
-		next          = now
-		maintainState = true
+		now  = time.Now()
+		next = now
 	)
 
 	defer func() {
@@ -275,8 +437,9 @@ func (q *QueryHandler) Run( //nolint:gocyclo,gocognit
 	if t != nil {
 		next = *t
 	}
+	q.leader = distLock.Acquired()
 
-	if distLock.Acquired() {
+	if q.leader {
 		q.logger.Info(
 			fmt.Sprintf(
 				"[Rule: %q] scheduling query now (next execution at: %s)",
@@ -287,28 +450,60 @@ func (q *QueryHandler) Run( //nolint:gocyclo,gocognit
 	}
 
 	for {
-		hits := []map[string]any{}
+		var (
+			hits   = []map[string]any{}
+			sent   *alert.Alert
+			ran    bool
+			runErr error
+		)
 		select {
 		case <-ctx.Done():
 			return
 		case <-q.StopCh:
 			return
 		case <-time.After(next.Sub(now)):
-			if distLock.Acquired() {
+			if q.lead(ctx, distLock) {
+				ran = true
 				data, err := q.query(ctx)
 				if err != nil {
 					q.logger.Error(fmt.Sprintf("[Rule: %q] error querying Elasticsearch", q.name), "error", err)
+					runErr = err
+					break
+				}
+
+				if err := q.checkPartial(data, outputCh); err != nil {
+					q.logger.Error(fmt.Sprintf("[Rule: %q] error querying Elasticsearch", q.name), "error", err)
+					runErr = err
+					break
+				}
+
+				ref, err := q.reference(ctx)
+				if err != nil {
+					q.logger.Error(fmt.Sprintf("[Rule: %q] error querying Elasticsearch for baseline", q.name), "error", err)
+					runErr = err
 					break
 				}
 
-				var records []*alert.Record
-				records, hits, err = q.process(data)
+				res, err := q.process(data, ref)
 				if err != nil {
 					q.logger.Error(fmt.Sprintf("[Rule: %q] error processing response", q.name), "error", err)
+					runErr = err
 					break
 				}
+				hits = res.hits
+				keys := res.keys
+				if !q.held(len(res.records) > 0, time.Now()) {
+					res.records = nil
+					keys = nil
+				}
+				q.remember(keys, time.Now())
+				if record := q.checkNoData(data); record != nil {
+					res.records = append(res.records, record)
+				}
+				q.state.Values = config.ComparisonValues(data, q.allConditions())
+				q.state.History = config.UpdateHistory(q.state.History, data, q.allConditions())
 
-				if len(records) > 0 {
+				if len(res.records) > 0 {
 					id, err := uuid.GenerateUUID()
 					if err != nil {
 						q.logger.Error(fmt.Sprintf("[Rule: %q] error creating new random UUID", q.name), "error", err)
@@ -316,31 +511,74 @@ func (q *QueryHandler) Run( //nolint:gocyclo,gocognit
 					}
 
 					a := &alert.Alert{
-						ID:       id,
-						RuleName: q.name,
-						Records:  records,
-						Methods:  q.alertMethods,
+						ID:          id,
+						RuleName:    q.name,
+						Namespace:   q.namespace,
+						Description: q.description,
+						Owner:       q.owner,
+						RunbookURL:  q.runbookURL,
+						Severity:    cmp.Or(res.severity, q.severity),
+						Labels:      q.labels,
+						Records:     res.records,
+						Methods:     q.alertMethods,
+
+						ConditionGroups: res.groups,
 					}
 					outputCh <- a
+					sent = a
 				}
 			}
 		}
 		now = time.Now()
 		next = q.schedule.Next(now)
-		if maintainState {
-			if err := q.setNextQuery(ctx, next, hits); err != nil {
-				q.logger.Error(fmt.Sprintf("[Rule: %q] error creating next query document in Elasticsearch", q.name), "error", err)
-				q.logger.Info(fmt.Sprintf("[Rule: %q] continuing without maintaining job state in Elasticsearch", q.name))
-				maintainState = false
+		// Only the leader writes state documents since the state
+		// held by the other nodes is stale
+		if q.leader && distLock.Acquired() {
+			if err := q.setNextQuery(ctx, next, hits, sent); err != nil {
+				q.logger.Error(fmt.Sprintf("[Rule: %q] error creating next query document in Elasticsearch, "+
+					"it will be written again on the next run", q.name), "error", err)
+				if runErr == nil {
+					runErr = err
+				}
+			}
+		}
+
+		// A run only succeeds once its state has been written
+		if ran {
+			if runErr != nil {
+				q.failed(runErr, outputCh)
+			} else {
+				q.succeeded(outputCh)
 			}
 		}
 	}
 }
 
+// lead returns true if this node holds the lock. If it did not hold
+// it on the previous run, another node may have run the rule since,
+// so the rule state is reloaded from the latest state document.
+func (q *QueryHandler) lead(ctx context.Context, distLock *lock.Lock) bool {
+	if !distLock.Acquired() {
+		q.leader = false
+		return false
+	}
+	if q.leader {
+		return true
+	}
+
+	if _, err := q.getNextQuery(ctx); err != nil {
+		q.logger.Error(fmt.Sprintf("[Rule: %q] error reloading rule state from Elasticsearch, "+
+			"continuing with the state held in memory", q.name), "error", err)
+	}
+	q.leader = true
+	return true
+}
+
 // PutTemplate attempts to create a template in Elasticsearch which
 // will serve as an alias for the state indices. The state indices
 // will be named 'go-es-alerts-status-{date}'; therefore, this template
-// enables searching all state indices via this alias.
+// enables searching all state indices via this alias. The mappings of
+// the template are also added to the existing state indices.
 func (q *QueryHandler) PutTemplate(ctx context.Context, stateIndexConfig *config.StateTemplateConfig) error {
 	var lifecycle map[string]string
 	if stateIndexConfig != nil && stateIndexConfig.ILMPolicyName != "" {
@@ -383,39 +621,7 @@ func (q *QueryHandler) PutTemplate(ctx context.Context, stateIndexConfig *config
 					"lifecycle": lifecycle,
 				},
 			},
-			"mappings": map[string]any{
-				"dynamic_templates": []map[string]any{
-					{
-						"strings_as_keywords": map[string]any{
-							"match_mapping_type": "string",
-							"mapping": map[string]any{
-								"type": "keyword",
-							},
-						},
-					},
-				},
-				"properties": map[string]any{
-					"@timestamp": map[string]any{
-						"type": "date",
-					},
-					"rule_name": map[string]any{
-						"type": "keyword",
-					},
-					"next_query": map[string]any{
-						"type": "date",
-					},
-					"hostname": map[string]any{
-						"type": "keyword",
-					},
-					"hits_count": map[string]any{
-						"type":       "long",
-						"null_value": 0,
-					},
-					"hits": map[string]any{
-						"enabled": false,
-					},
-				},
-			},
+			"mappings": stateMappings(),
 		},
 	}
 
@@ -456,13 +662,106 @@ func (q *QueryHandler) PutTemplate(ctx context.Context, stateIndexConfig *config
 	if !ack {
 		return xerrors.New("elasticsearch did not acknowledge creation of new template")
 	}
+	return q.putMappings(ctx)
+}
+
+// putMappings adds the mappings of the template to the existing
+// state indices, which the template only applies to when they are
+// created, so that the fields added to the state documents since
+// then are mapped as expected. It does nothing if there are no
+// state indices yet.
+func (q *QueryHandler) putMappings(ctx context.Context) error {
+	var payload bytes.Buffer
+	if err := json.NewEncoder(&payload).Encode(stateMappings()); err != nil {
+		return xerrors.Errorf("encoding state index mappings: %w", err)
+	}
+
+	resp, err := q.makeRequest(ctx, http.MethodPut, q.StateAliasURL()+"/_mapping", &payload)
+	if err != nil {
+		return xerrors.Errorf("error making HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if resp.StatusCode != 200 {
+		return xerrors.Errorf("error updating the mappings of the state indices (status: %q): Response body:\n%s",
+			resp.Status, q.readErrRespBody(resp))
+	}
 	return nil
 }
 
+// stateMappings returns the mappings of the state documents.
+func stateMappings() map[string]any {
+	return map[string]any{
+		"dynamic_templates": []map[string]any{
+			{
+				"strings_as_keywords": map[string]any{
+					"match_mapping_type": "string",
+					"mapping": map[string]any{
+						"type": "keyword",
+					},
+				},
+			},
+		},
+		"properties": map[string]any{
+			"@timestamp": map[string]any{
+				"type": "date",
+			},
+			"rule_name": map[string]any{
+				"type": "keyword",
+			},
+			"next_query": map[string]any{
+				"type": "date",
+			},
+			"hostname": map[string]any{
+				"type": "keyword",
+			},
+			"hits_count": map[string]any{
+				"type":       "long",
+				"null_value": 0,
+			},
+			"hits": map[string]any{
+				"enabled": false,
+			},
+			"state": map[string]any{
+				"type":    "object",
+				"enabled": false,
+			},
+			"alert": map[string]any{
+				"properties": map[string]any{
+					"id": map[string]any{
+						"type": "keyword",
+					},
+					"rule": map[string]any{
+						"type": "keyword",
+					},
+					"severity": map[string]any{
+						"type": "keyword",
+					},
+					"fields": map[string]any{
+						"type": "nested",
+						"properties": map[string]any{
+							"key": map[string]any{
+								"type": "keyword",
+							},
+							"doc_count": map[string]any{
+								"type": "long",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
 // getNextQuery queries the state indices for the most recently-
 // created document belonging to this rule. It then attempts to
 // parse the 'next_query' field in order to inform the Run() loop
-// when to next execute the query.
+// when to next execute the query. It also restores the rule state
+// persisted in the document, if any.
 func (q *QueryHandler) getNextQuery(ctx context.Context) (*time.Time, error) {
 	payload := fmt.Sprintf(`{
     "query": {
@@ -483,6 +782,11 @@ func (q *QueryHandler) getNextQuery(ctx context.Context) (*time.Time, error) {
         "next_query": {
           "order": "desc"
         }
+      },
+      {
+        "@timestamp": {
+          "order": "desc"
+        }
       }
     ],
     "size": 1
@@ -493,7 +797,7 @@ func (q *QueryHandler) getNextQuery(ctx context.Context) (*time.Time, error) {
 		return nil, xerrors.Errorf("error parsing URL: %v", err)
 	}
 	query := u.Query()
-	query.Add("filter_path", "hits.hits._source.next_query")
+	query.Add("filter_path", "hits.hits._source.next_query,hits.hits._source.state")
 	u.RawQuery = query.Encode()
 
 	resp, err := q.makeRequest(ctx, http.MethodGet, u.String(), bytes.NewBufferString(payload))
@@ -510,7 +814,8 @@ func (q *QueryHandler) getNextQuery(ctx context.Context) (*time.Time, error) {
 		Hits struct {
 			Hits []struct {
 				Source struct {
-					NextQuery string `json:"next_query"`
+					NextQuery string          `json:"next_query"`
+					State     json.RawMessage `json:"state"`
 				} `json:"_source"`
 			} `json:"hits"`
 		} `json:"hits"`
@@ -532,13 +837,23 @@ func (q *QueryHandler) getNextQuery(ctx context.Context) (*time.Time, error) {
 	if err != nil {
 		return nil, xerrors.Errorf("error parsing time: %v", err)
 	}
+
+	if raw := data.Hits.Hits[0].Source.State; len(raw) > 0 {
+		state := new(ruleState)
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(state); err != nil {
+			return nil, xerrors.Errorf("error JSON-decoding rule state: %v", err)
+		}
+		q.state = state
+	}
 	return &t, nil
 }
 
 // setNextQuery creates a new document in a state index to
 // inform the Run() loop when to next execute the query if
 // the process gets restarted.
-func (q *QueryHandler) setNextQuery(ctx context.Context, ts time.Time, hits []map[string]any) error {
+func (q *QueryHandler) setNextQuery(ctx context.Context, ts time.Time, hits []map[string]any, sent *alert.Alert) error {
 	status := struct {
 		Time  string           `json:"@timestamp"`
 		Name  string           `json:"rule_name"`
@@ -546,13 +861,19 @@ func (q *QueryHandler) setNextQuery(ctx context.Context, ts time.Time, hits []ma
 		Host  string           `json:"hostname"`
 		NHits int              `json:"hits_count"`
 		Hits  []map[string]any `json:"hits,omitempty"`
+		State *ruleState       `json:"state,omitempty"`
+		Alert *firing          `json:"alert,omitempty"`
 	}{
-		Time:  time.Now().Format(defaultTimestampFormat),
+		// Sub-second precision breaks ties between the documents
+		// with the same next_query when restoring the state
+		Time:  time.Now().Format(time.RFC3339Nano),
 		Name:  q.cleanedName(),
 		Next:  ts.Format(defaultTimestampFormat),
 		Host:  q.hostname,
 		NHits: len(hits),
 		Hits:  hits,
+		State: q.state,
+		Alert: newFiring(sent),
 	}
 
 	payload := bytes.Buffer{}
@@ -574,12 +895,100 @@ func (q *QueryHandler) setNextQuery(ctx context.Context, ts time.Time, hits []ma
 }
 
 func (q *QueryHandler) query(ctx context.Context) (map[string]any, error) {
+	ctx, cancel := q.withClientTimeout(ctx)
+	defer cancel()
+
+	switch q.queryType {
+	case queryTypeCount:
+		return q.count(ctx, q.queryIndex, q.queryData)
+	case queryTypeMSearch:
+		return q.msearch(ctx)
+	case queryTypeSQL:
+		return q.sql(ctx)
+	case queryTypeESQL:
+		return q.esql(ctx)
+	case queryTypeEQL:
+		return q.eql(ctx, q.queryIndex, q.queryData)
+	default:
+		if q.collect != nil {
+			return q.collectAll(ctx)
+		}
+		return q.search(ctx, q.queryIndex, q.withTimeout(q.queryData))
+	}
+}
+
+// reference returns the values against which comparison conditions
+// are evaluated. If the rule has a baseline query, it is executed.
+func (q *QueryHandler) reference(ctx context.Context) (*config.Reference, error) {
+	ref := &config.Reference{
+		Previous: q.state.Values,
+		History:  q.state.History,
+	}
+	if q.baseData == nil {
+		return ref, nil
+	}
+
+	search := q.search
+	switch q.queryType {
+	case queryTypeCount:
+		search = q.count
+	case queryTypeEQL:
+		search = q.eql
+	}
+
+	ctx, cancel := q.withClientTimeout(ctx)
+	defer cancel()
+
+	data, err := search(ctx, q.baseIndex, q.withTimeout(q.baseData))
+	if err != nil {
+		return nil, err
+	}
+	ref.Baseline = data
+	return ref, nil
+}
+
+// allConditions returns every condition of the rule, including
+// those of its condition groups and levels.
+func (q *QueryHandler) allConditions() []config.Condition {
+	conditions := slices.Clone(q.conditions)
+	for _, group := range q.groups {
+		conditions = append(conditions, group.Conditions...)
+	}
+	for _, level := range q.levels {
+		conditions = append(conditions, level.Conditions...)
+	}
+	return conditions
+}
+
+func (q *QueryHandler) search(ctx context.Context, index string, body map[string]any) (map[string]any, error) {
+	return q.post(ctx, http.MethodGet, fmt.Sprintf("%s/%s/_search", q.esURL, index), body)
+}
+
+// count executes the query with the _count API. Conditions
+// should refer to the number of matching documents as 'count'.
+func (q *QueryHandler) count(ctx context.Context, index string, body map[string]any) (map[string]any, error) {
+	return q.post(ctx, http.MethodGet, fmt.Sprintf("%s/%s/_count", q.esURL, index), body)
+}
+
+// post sends the JSON-encoded body to the given URL and returns
+// the JSON-decoded response.
+func (q *QueryHandler) post(ctx context.Context, method, url string, body map[string]any) (map[string]any, error) {
 	payload := bytes.Buffer{}
-	if err := json.NewEncoder(&payload).Encode(&q.queryData); err != nil {
+	if err := json.NewEncoder(&payload).Encode(&body); err != nil {
 		return nil, xerrors.Errorf("error JSON-encoding Elasticsearch query body: %v", err)
 	}
 
-	resp, err := q.makeRequest(ctx, http.MethodGet, fmt.Sprintf("%s/%s/_search", q.esURL, q.queryIndex), &payload)
+	req, err := q.newRequest(ctx, method, url, &payload)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating new request: %v", err)
+	}
+	return q.do(req)
+}
+
+// do sends the request to Elasticsearch and returns the
+// JSON-decoded response.
+func (q *QueryHandler) do(req *http.Request) (map[string]any, error) {
+	resp, err := q.client.Do(req)
 	if err != nil {
 		return nil, xerrors.Errorf("error making HTTP request: %v", err)
 	}
@@ -600,8 +1009,16 @@ func (q *QueryHandler) query(ctx context.Context) (map[string]any, error) {
 	return data, nil
 }
 
+// cleanedName returns the name by which this rule is identified
+// in the state indices. Rules in a namespace are prefixed by the
+// namespace so that rules of the same name owned by different
+// teams do not share state.
 func (q *QueryHandler) cleanedName() string {
-	return strings.ReplaceAll(strings.ToLower(q.name), " ", "-")
+	name := q.name
+	if q.namespace != "" {
+		name = q.namespace + "/" + name
+	}
+	return strings.ReplaceAll(strings.ToLower(name), " ", "-")
 }
 
 func (q *QueryHandler) makeRequest(ctx context.Context, method, url string, data io.Reader) (*http.Response, error) {
@@ -656,5 +1073,9 @@ func (q *QueryHandler) StateIndexURL() string {
 // TemplateName returns the name of the Elasticsearch
 // template used to search against all state indices.
 func (q *QueryHandler) TemplateName() string {
+	return templateName()
+}
+
+func templateName() string {
 	return fmt.Sprintf("%s-%s", defaultStateIndexAlias, templateVersion)
 }
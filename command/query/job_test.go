@@ -18,6 +18,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -25,6 +26,7 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -36,6 +38,7 @@ import (
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
 	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/file"
 	"github.com/morningconsult/go-elasticsearch-alerts/config"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/esclient"
 	"github.com/morningconsult/go-elasticsearch-alerts/internal/lock"
 )
 
@@ -164,9 +167,9 @@ func TestBuildHTTPRequestFunc(t *testing.T) {
 		username := "foo@bar.com"
 		password := "baz"
 
-		t.Setenv(envESBasicAuthUsername, username)
+		t.Setenv(esclient.EnvUsername, username)
 
-		t.Setenv(envESBasicAuthPassword, password)
+		t.Setenv(esclient.EnvPassword, password)
 
 		reqFunc, err := buildHTTPRequestFunc()
 		if err != nil {
@@ -191,10 +194,10 @@ func TestBuildHTTPRequestFunc(t *testing.T) {
 	t.Run("username-and-password-not-both-set", func(t *testing.T) {
 		username := "foo@bar.com"
 
-		t.Setenv(envESBasicAuthUsername, username)
+		t.Setenv(esclient.EnvUsername, username)
 
-		t.Setenv(envESBasicAuthPassword, "")
-		os.Unsetenv(envESBasicAuthPassword)
+		t.Setenv(esclient.EnvPassword, "")
+		os.Unsetenv(esclient.EnvPassword)
 
 		_, err := buildHTTPRequestFunc()
 		if err == nil {
@@ -203,8 +206,8 @@ func TestBuildHTTPRequestFunc(t *testing.T) {
 		gotError := err.Error()
 		expectError := fmt.Sprintf(
 			"both %s and %s should be set when using basic auth",
-			envESBasicAuthUsername,
-			envESBasicAuthPassword,
+			esclient.EnvUsername,
+			esclient.EnvPassword,
 		)
 		if gotError != expectError {
 			t.Errorf("Expected error:\n%s\nGot error:\n%s", expectError, gotError)
@@ -348,6 +351,63 @@ func TestPutTemplate_WithILMPolicy(t *testing.T) {
 	}
 }
 
+func TestPutTemplate_ExistingIndices(t *testing.T) {
+	reqFunc, err := buildHTTPRequestFunc()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name   string
+		status int
+		err    bool
+	}{
+		{"updated", 200, false},
+		{"no-indices", 404, false},
+		{"conflict", 400, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var mappings []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/_index_template/" + templateName():
+					w.Write([]byte(`{"acknowledged": true}`))
+				case "/" + templateName() + "/_mapping":
+					mappings, _ = io.ReadAll(r.Body)
+					w.WriteHeader(tc.status)
+					w.Write([]byte(`{"acknowledged": true}`))
+				default:
+					http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+				}
+			}))
+			t.Cleanup(ts.Close)
+
+			qh := &QueryHandler{
+				client:     cleanhttp.DefaultClient(),
+				esURL:      ts.URL,
+				newRequest: reqFunc,
+			}
+
+			err := qh.PutTemplate(t.Context(), nil)
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !strings.Contains(string(mappings), `"fields":{"properties"`) ||
+				!strings.Contains(string(mappings), `"type":"nested"`) {
+				t.Errorf("expected the mappings of the new fields to be added, got %s", mappings)
+			}
+		})
+	}
+}
+
 func TestGetNextQuery(t *testing.T) {
 	expected := time.Now().Add(2 * time.Hour).Format(time.RFC3339)
 	cases := []struct {
@@ -502,6 +562,41 @@ func TestGetNextQuery(t *testing.T) {
 	}
 }
 
+func TestGetNextQuery_RestoresState(t *testing.T) {
+	next := time.Now().Add(2 * time.Hour).Format(time.RFC3339)
+	ts := newTestServer(200, fmt.Sprintf(
+		`{"hits":{"hits":[{"_source":{"next_query":%q,"state":{"values":{"hits.total.value":120},"history":{"hits.total.value":[100,110,120]}}}}]}}`,
+		next,
+	))
+	defer ts.Close()
+
+	qh, err := NewQueryHandler(&QueryHandlerConfig{
+		Name:         "Test Errors",
+		ESUrl:        ts.URL,
+		QueryIndex:   "test-*",
+		AlertMethods: []alert.Method{&file.AlertMethod{}},
+		QueryData: map[string]any{
+			"hello": "world",
+		},
+		Schedule: "@every 10m",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = qh.getNextQuery(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := qh.state.Values["hits.total.value"]; got != json.Number("120") {
+		t.Fatalf("unexpected restored value (got %v, expected 120)", got)
+	}
+
+	if got := qh.state.History["hits.total.value"]; len(got) != 3 || got[2] != json.Number("120") {
+		t.Fatalf("unexpected restored history: %v", got)
+	}
+}
+
 func TestRun(t *testing.T) {
 	queryIndex := randomUUID(t)
 	expected := map[string]any{
@@ -621,6 +716,76 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestRun_StateFailures(t *testing.T) {
+	queryIndex := randomUUID(t)
+	var writes atomic.Int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case fmt.Sprintf("/%s-%s/_search", defaultStateIndexAlias, templateVersion):
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"hits":{"hits":[]}}`))
+		case fmt.Sprintf("/<%s-status-%s-{now/d}>/_doc", defaultStateIndexAlias, templateVersion):
+			writes.Add(1)
+			http.Error(w, "index is read-only", http.StatusForbidden)
+		case fmt.Sprintf("/%s/_search", queryIndex):
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"hits":{"hits":[]}}`))
+		}
+	}))
+	defer ts.Close()
+
+	errThreshold := 2
+	qh, err := NewQueryHandler(&QueryHandlerConfig{
+		Name:           "Test State Failures",
+		Logger:         hclog.NewNullLogger(),
+		ESUrl:          ts.URL,
+		QueryIndex:     queryIndex,
+		AlertMethods:   []alert.Method{&file.AlertMethod{}},
+		ErrorMethods:   []alert.Method{&file.AlertMethod{}},
+		ErrorThreshold: errThreshold,
+		QueryData:      map[string]any{"query": map[string]any{"match_all": map[string]any{}}},
+		Schedule:       "@every 1s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Second)
+	defer cancel()
+
+	outputCh := make(chan *alert.Alert, 10)
+	lock := lock.NewLock()
+	lock.Set(true)
+	wg.Add(1)
+	go qh.Run(ctx, outputCh, &wg, lock)
+
+	// The state write keeps being attempted and keeps failing after
+	// the error alert is sent
+	for writes.Load() < int32(errThreshold+1) {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("expected %d state writes, got %d", errThreshold+1, writes.Load())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	cancel()
+	wg.Wait()
+	close(outputCh)
+
+	var alerts []*alert.Alert
+	for a := range outputCh {
+		alerts = append(alerts, a)
+	}
+	if len(alerts) != 1 {
+		t.Fatalf("expected 1 error alert, got %d", len(alerts))
+	}
+	if len(alerts[0].Records) != 1 || alerts[0].Records[0].Filter != errorFilter {
+		t.Errorf("unexpected records: %+v", alerts[0].Records)
+	}
+}
+
 func TestSetNextQuery(t *testing.T) {
 	cases := []struct {
 		name   string
@@ -668,7 +833,7 @@ func TestSetNextQuery(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			err = qh.setNextQuery(t.Context(), time.Now().Add(1*time.Hour), nil)
+			err = qh.setNextQuery(t.Context(), time.Now().Add(1*time.Hour), nil, nil)
 			if tc.err {
 				if err == nil {
 					t.Fatal("expected an error but didn't receive one")
@@ -0,0 +1,72 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/xerrors"
+)
+
+// msearch executes the rule's named searches in a single request
+// with the _msearch API. The response to each search is placed
+// under 'responses.<name>' of the returned map so that conditions
+// and filters can refer to it (e.g. 'responses.errors.hits.total.value').
+func (q *QueryHandler) msearch(ctx context.Context) (map[string]any, error) {
+	payload := bytes.Buffer{}
+	enc := json.NewEncoder(&payload)
+	for _, search := range q.searches {
+		header := map[string]any{"index": search.Index}
+		if err := enc.Encode(header); err != nil {
+			return nil, xerrors.Errorf("error JSON-encoding header of search %q: %v", search.Name, err)
+		}
+		if err := enc.Encode(q.withTimeout(search.Body)); err != nil {
+			return nil, xerrors.Errorf("error JSON-encoding body of search %q: %v", search.Name, err)
+		}
+	}
+
+	req, err := q.newRequest(ctx, http.MethodPost, fmt.Sprintf("%s/_msearch", q.esURL), &payload)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating new request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	data, err := q.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, _ := data["responses"].([]any)
+	if len(raw) != len(q.searches) {
+		return nil, xerrors.Errorf("expected %d responses from Elasticsearch, got %d", len(q.searches), len(raw))
+	}
+
+	responses := make(map[string]any, len(q.searches))
+	for i, search := range q.searches {
+		resp, ok := raw[i].(map[string]any)
+		if !ok {
+			return nil, xerrors.Errorf("unexpected response to search %q", search.Name)
+		}
+		if e, ok := resp["error"]; ok {
+			return nil, xerrors.Errorf("error in search %q: %v", search.Name, e)
+		}
+		responses[search.Name] = resp
+	}
+
+	return map[string]any{"responses": responses}, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/file"
+	"github.com/morningconsult/go-elasticsearch-alerts/config"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/jsonpath"
+)
+
+func TestQuery_Count(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/test-index/_count" {
+			http.Error(w, "unexpected path "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"count":42}`)
+	}))
+	defer ts.Close()
+
+	qh, err := NewQueryHandler(&QueryHandlerConfig{
+		Name:         "Test Count",
+		ESUrl:        ts.URL,
+		QueryIndex:   "test-index",
+		QueryType:    config.QueryTypeCount,
+		AlertMethods: []alert.Method{&file.AlertMethod{}},
+		QueryData: map[string]any{
+			"query": map[string]any{"match_all": map[string]any{}},
+		},
+		Schedule: "@every 10m",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := qh.query(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["count"] != json.Number("42") {
+		t.Fatalf("unexpected count: %v", data["count"])
+	}
+}
+
+func TestQuery_MSearch(t *testing.T) {
+	cases := []struct {
+		name     string
+		response string
+		err      bool
+	}{
+		{
+			name:     "success",
+			response: `{"responses":[{"hits":{"total":{"value":7}}},{"hits":{"total":{"value":100}}}]}`,
+		},
+		{
+			name:     "search-error",
+			response: `{"responses":[{"hits":{"total":{"value":7}}},{"error":{"type":"index_not_found_exception"},"status":404}]}`,
+			err:      true,
+		},
+		{
+			name:     "missing-responses",
+			response: `{"responses":[{"hits":{"total":{"value":7}}}]}`,
+			err:      true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/_msearch" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+					http.Error(w, "unexpected request", http.StatusBadRequest)
+					return
+				}
+
+				var lines []map[string]any
+				scanner := bufio.NewScanner(r.Body)
+				for scanner.Scan() {
+					var line map[string]any
+					if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					lines = append(lines, line)
+				}
+				if len(lines) != 4 || lines[0]["index"] != "errors-*" || lines[2]["index"] != "requests-*" {
+					http.Error(w, "unexpected body", http.StatusBadRequest)
+					return
+				}
+				fmt.Fprint(w, tc.response)
+			}))
+			defer ts.Close()
+
+			qh, err := NewQueryHandler(&QueryHandlerConfig{
+				Name:         "Test MSearch",
+				ESUrl:        ts.URL,
+				QueryIndex:   "test-index",
+				QueryType:    config.QueryTypeMSearch,
+				AlertMethods: []alert.Method{&file.AlertMethod{}},
+				Searches: []config.SearchConfig{
+					{
+						Name:  "errors",
+						Index: "errors-*",
+						Body:  map[string]any{"size": 0},
+					},
+					{
+						Name:  "requests",
+						Index: "requests-*",
+						Body:  map[string]any{"size": 0},
+					},
+				},
+				Schedule: "@every 10m",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := qh.query(t.Context())
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := jsonpath.GetAll(data, "responses.errors.hits.total.value"); len(got) != 1 || got[0] != json.Number("7") {
+				t.Errorf("unexpected errors total: %v", got)
+			}
+			if got := jsonpath.GetAll(data, "responses.requests.hits.total.value"); len(got) != 1 || got[0] != json.Number("100") {
+				t.Errorf("unexpected requests total: %v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/jsonpath"
+)
+
+const noDataFilter = "no data"
+
+// checkNoData counts the consecutive runs in which the response had
+// no data. Once the count reaches the rule's threshold, it returns a
+// record explaining what data was expected; otherwise it returns nil.
+func (q *QueryHandler) checkNoData(respData map[string]any) *alert.Record {
+	if q.noData == nil {
+		return nil
+	}
+
+	if q.hasData(respData) {
+		q.state.NoDataRuns = 0
+		return nil
+	}
+
+	q.state.NoDataRuns++
+	if q.state.NoDataRuns < q.noData.ConsecutiveRuns {
+		return nil
+	}
+
+	text := fmt.Sprintf("The query returned no hits for %d consecutive run(s)", q.state.NoDataRuns)
+	if q.noData.Field != "" {
+		text = fmt.Sprintf("The field %q was missing from the response for %d consecutive run(s)",
+			q.noData.Field, q.state.NoDataRuns)
+	}
+
+	return &alert.Record{
+		Filter: noDataFilter,
+		Text:   text,
+	}
+}
+
+// hasData returns false if the response is missing the rule's no-data
+// field or, if the rule has no such field, if it has no hits (or, for
+// count rules, a count of zero; for msearch rules, no hits in any of
+// the responses; for SQL and ES|QL rules, no rows).
+func (q *QueryHandler) hasData(respData map[string]any) bool {
+	if q.noData.Field != "" {
+		return present(jsonpath.GetAll(respData, q.noData.Field))
+	}
+
+	switch q.queryType {
+	case queryTypeCount:
+		return positive(respData["count"])
+	case queryTypeMSearch:
+		responses, _ := respData["responses"].(map[string]any)
+		for _, resp := range responses {
+			if data, ok := resp.(map[string]any); ok && hasHits(data) {
+				return true
+			}
+		}
+		return false
+	case queryTypeSQL, queryTypeESQL:
+		return positive(respData["row_count"])
+	default:
+		return hasHits(respData)
+	}
+}
+
+// hasHits returns true if the search response has any hits.
+func hasHits(respData map[string]any) bool {
+	// hits.total is an object in Elasticsearch 7+ and a number before
+	for _, path := range []string{"hits.total.value", "hits.total"} {
+		for _, elem := range jsonpath.GetAll(respData, path) {
+			if _, ok := elem.(json.Number); ok {
+				return positive(elem)
+			}
+		}
+	}
+
+	return present(jsonpath.GetAll(respData, "hits.hits"))
+}
+
+// positive returns true if the value is a number greater than zero
+// or a number that cannot be parsed as an integer.
+func positive(v any) bool {
+	n, ok := v.(json.Number)
+	if !ok {
+		return false
+	}
+	total, err := n.Int64()
+	return err != nil || total > 0
+}
+
+// present returns true if any of the elements returned by
+// jsonpath.GetAll is not nil.
+func present(elems []any) bool {
+	for _, elem := range elems {
+		if elem != nil {
+			return true
+		}
+	}
+	return false
+}
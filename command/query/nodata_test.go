@@ -0,0 +1,136 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"cmp"
+	"encoding/json"
+	"testing"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/config"
+)
+
+func TestCheckNoData(t *testing.T) {
+	empty := map[string]any{
+		"hits": map[string]any{
+			"total": map[string]any{"value": json.Number("0")},
+			"hits":  []any{},
+		},
+	}
+	nonEmpty := map[string]any{
+		"hits": map[string]any{
+			"total": map[string]any{"value": json.Number("3")},
+			"hits":  []any{map[string]any{"_id": "1"}},
+		},
+		"aggregations": map[string]any{
+			"heartbeat": map[string]any{"value": json.Number("1")},
+		},
+	}
+	legacy := map[string]any{
+		"hits": map[string]any{
+			"total": json.Number("0"),
+		},
+	}
+
+	zeroCount := map[string]any{"count": json.Number("0")}
+	count := map[string]any{"count": json.Number("12")}
+	emptyMSearch := map[string]any{
+		"responses": map[string]any{"errors": empty, "warnings": legacy},
+	}
+	nonEmptyMSearch := map[string]any{
+		"responses": map[string]any{"errors": empty, "warnings": nonEmpty},
+	}
+	noRows := map[string]any{"rows": []any{}, "row_count": json.Number("0")}
+	rows := map[string]any{
+		"rows":      []any{map[string]any{"host": "a"}},
+		"row_count": json.Number("1"),
+	}
+
+	cases := []struct {
+		name      string
+		queryType string
+		noData    *config.NoDataConfig
+		responses []map[string]any
+		expect    []bool
+	}{
+		{
+			name:      "disabled",
+			noData:    nil,
+			responses: []map[string]any{empty, empty},
+			expect:    []bool{false, false},
+		},
+		{
+			name:      "zero-hits",
+			noData:    &config.NoDataConfig{ConsecutiveRuns: 2},
+			responses: []map[string]any{empty, empty, empty, nonEmpty, empty},
+			expect:    []bool{false, true, true, false, false},
+		},
+		{
+			name:      "legacy-total",
+			noData:    &config.NoDataConfig{ConsecutiveRuns: 1},
+			responses: []map[string]any{legacy, nonEmpty},
+			expect:    []bool{true, false},
+		},
+		{
+			name:      "missing-field",
+			noData:    &config.NoDataConfig{Field: "aggregations.heartbeat.value", ConsecutiveRuns: 1},
+			responses: []map[string]any{nonEmpty, empty},
+			expect:    []bool{false, true},
+		},
+		{
+			name:      "count",
+			queryType: queryTypeCount,
+			noData:    &config.NoDataConfig{ConsecutiveRuns: 1},
+			responses: []map[string]any{count, zeroCount, nonEmpty},
+			expect:    []bool{false, true, true},
+		},
+		{
+			name:      "msearch",
+			queryType: queryTypeMSearch,
+			noData:    &config.NoDataConfig{ConsecutiveRuns: 1},
+			responses: []map[string]any{nonEmptyMSearch, emptyMSearch, nonEmpty},
+			expect:    []bool{false, true, true},
+		},
+		{
+			name:      "sql",
+			queryType: queryTypeSQL,
+			noData:    &config.NoDataConfig{ConsecutiveRuns: 1},
+			responses: []map[string]any{rows, noRows, nonEmpty},
+			expect:    []bool{false, true, true},
+		},
+		{
+			name:      "esql",
+			queryType: queryTypeESQL,
+			noData:    &config.NoDataConfig{ConsecutiveRuns: 2},
+			responses: []map[string]any{noRows, noRows, rows},
+			expect:    []bool{false, true, false},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			qh := &QueryHandler{
+				queryType: cmp.Or(tc.queryType, queryTypeSearch),
+				noData:    tc.noData,
+				state:     new(ruleState),
+			}
+			for i, resp := range tc.responses {
+				record := qh.checkNoData(resp)
+				if (record != nil) != tc.expect[i] {
+					t.Fatalf("run %d: expected a record? %t (got %v)", i+1, tc.expect[i], record)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+)
+
+const (
+	partialResultsIgnore string = "ignore"
+	partialResultsFail   string = "fail"
+
+	// clientTimeoutGrace is how much longer than the rule's timeout
+	// the client waits so that Elasticsearch can return the partial
+	// results it gathered before the timeout
+	clientTimeoutGrace = 5 * time.Second
+
+	shardFailuresFilter = "_shards.failures"
+)
+
+// withClientTimeout returns a copy of ctx that is canceled shortly
+// after the rule's timeout, if it has one.
+func (q *QueryHandler) withClientTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if q.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, q.timeout+clientTimeoutGrace)
+}
+
+// withTimeout returns a copy of the search body with the rule's
+// timeout unless the body has its own timeout or the query type
+// does not accept one.
+func (q *QueryHandler) withTimeout(body map[string]any) map[string]any {
+	if q.timeout <= 0 || (q.queryType != queryTypeSearch && q.queryType != queryTypeMSearch) {
+		return body
+	}
+	if _, ok := body["timeout"]; ok {
+		return body
+	}
+
+	body = maps.Clone(body)
+	body["timeout"] = q.timeoutParam()
+	return body
+}
+
+// timeoutParam returns the rule's timeout formatted for Elasticsearch.
+func (q *QueryHandler) timeoutParam() string {
+	return fmt.Sprintf("%dms", q.timeout.Milliseconds())
+}
+
+// checkPartial handles a partial response per the rule's partial
+// results policy. Unless the policy is to ignore partial responses,
+// an alert describing why the response is partial is sent to the
+// rule's shard failure outputs. Only one such alert is sent until
+// a complete response is received. If the policy is to fail, an
+// error is returned.
+func (q *QueryHandler) checkPartial(data map[string]any, outputCh chan *alert.Alert) error {
+	reasons, failures := partialReasons("", data)
+	if len(reasons) == 0 || q.partial == partialResultsIgnore {
+		q.state.Partial = false
+		return nil
+	}
+	reason := strings.Join(reasons, "; ")
+
+	alreadyPartial := q.state.Partial
+	q.state.Partial = true
+	if len(q.shardMethods) > 0 && !alreadyPartial {
+		if err := q.sendShardFailureAlert(reason, failures, outputCh); err != nil {
+			q.logger.Error(fmt.Sprintf("[Rule: %q] error creating shard failure alert", q.name), "error", err)
+		}
+	}
+
+	if q.partial == partialResultsFail {
+		return xerrors.Errorf("partial response from Elasticsearch: %s", reason)
+	}
+
+	q.logger.Warn(fmt.Sprintf("[Rule: %q] partial response from Elasticsearch", q.name), "reason", reason)
+	return nil
+}
+
+func (q *QueryHandler) sendShardFailureAlert(reason string, failures []any, outputCh chan *alert.Alert) error {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+
+	text := reason
+	if len(failures) > 0 {
+		data, err := json.MarshalIndent(failures, "", "    ")
+		if err != nil {
+			return err
+		}
+		text = text + "\n\n" + string(data)
+	}
+
+	outputCh <- &alert.Alert{
+		ID:          id,
+		RuleName:    q.name,
+		Namespace:   q.namespace,
+		Description: "The response to the query of this rule was partial, so alerts may be missing",
+		Owner:       q.owner,
+		RunbookURL:  q.runbookURL,
+		Severity:    "warning",
+		Labels:      q.labels,
+		Methods:     q.shardMethods,
+		Records: []*alert.Record{
+			{
+				Filter: shardFailuresFilter,
+				Text:   text,
+			},
+		},
+	}
+	return nil
+}
+
+// partialReasons returns why the response is partial, if it is, along
+// with any shard failures it reports. The responses to the searches
+// of an msearch rule are each checked.
+func partialReasons(prefix string, data map[string]any) ([]string, []any) {
+	if responses, ok := data["responses"].(map[string]any); ok && prefix == "" {
+		var (
+			reasons  []string
+			failures []any
+		)
+		for _, name := range slices.Sorted(maps.Keys(responses)) {
+			resp, ok := responses[name].(map[string]any)
+			if !ok {
+				continue
+			}
+			r, f := partialReasons(name+": ", resp)
+			reasons = append(reasons, r...)
+			failures = append(failures, f...)
+		}
+		return reasons, failures
+	}
+
+	var reasons []string
+	if timedOut, ok := data["timed_out"].(bool); ok && timedOut {
+		reasons = append(reasons, prefix+"the query timed out")
+	}
+
+	shards, _ := data["_shards"].(map[string]any)
+	failed, _ := shards["failed"].(json.Number)
+	if n, err := failed.Int64(); err == nil && n > 0 {
+		reasons = append(reasons, fmt.Sprintf("%s%d of %v shards failed", prefix, n, shards["total"]))
+	}
+
+	failures, _ := shards["failures"].([]any)
+	return reasons, failures
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/file"
+	"github.com/morningconsult/go-elasticsearch-alerts/config"
+)
+
+func TestPartialReasons(t *testing.T) {
+	shardFailure := map[string]any{
+		"timed_out": false,
+		"_shards": map[string]any{
+			"total":    json.Number("5"),
+			"failed":   json.Number("2"),
+			"failures": []any{map[string]any{"shard": json.Number("0"), "reason": "boom"}},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		data     map[string]any
+		reasons  []string
+		failures int
+	}{
+		{
+			name: "complete",
+			data: map[string]any{
+				"timed_out": false,
+				"_shards":   map[string]any{"total": json.Number("5"), "failed": json.Number("0")},
+			},
+		},
+		{
+			name:    "timed-out",
+			data:    map[string]any{"timed_out": true},
+			reasons: []string{"the query timed out"},
+		},
+		{
+			name:     "shard-failures",
+			data:     shardFailure,
+			reasons:  []string{"2 of 5 shards failed"},
+			failures: 1,
+		},
+		{
+			name: "msearch",
+			data: map[string]any{
+				"responses": map[string]any{
+					"errors":   shardFailure,
+					"requests": map[string]any{"timed_out": true},
+				},
+			},
+			reasons:  []string{"errors: 2 of 5 shards failed", "requests: the query timed out"},
+			failures: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reasons, failures := partialReasons("", tc.data)
+			if strings.Join(reasons, "; ") != strings.Join(tc.reasons, "; ") {
+				t.Errorf("expected reasons %q, got %q", tc.reasons, reasons)
+			}
+			if len(failures) != tc.failures {
+				t.Errorf("expected %d failures, got %d", tc.failures, len(failures))
+			}
+		})
+	}
+}
+
+func TestCheckPartial(t *testing.T) {
+	partial := map[string]any{"timed_out": true}
+
+	cases := []struct {
+		policy string
+		alert  bool
+		err    bool
+	}{
+		{config.PartialResultsIgnore, false, false},
+		{config.PartialResultsWarn, true, false},
+		{config.PartialResultsFail, true, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.policy, func(t *testing.T) {
+			outputCh := make(chan *alert.Alert, 1)
+			qh := &QueryHandler{
+				name:         "test-rule",
+				logger:       hclog.NewNullLogger(),
+				partial:      tc.policy,
+				shardMethods: []alert.Method{&file.AlertMethod{}},
+				state:        new(ruleState),
+			}
+
+			err := qh.checkPartial(partial, outputCh)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected an error? %t (got %v)", tc.err, err)
+			}
+
+			select {
+			case a := <-outputCh:
+				if !tc.alert {
+					t.Fatal("unexpected shard failure alert")
+				}
+				if len(a.Records) != 1 || a.Records[0].Filter != shardFailuresFilter {
+					t.Errorf("unexpected records: %+v", a.Records)
+				}
+			default:
+				if tc.alert {
+					t.Fatal("expected a shard failure alert")
+				}
+			}
+
+			// No further alert is sent while the responses are partial
+			if err = qh.checkPartial(partial, outputCh); tc.err != (err != nil) {
+				t.Fatalf("expected an error? %t (got %v)", tc.err, err)
+			}
+			if len(outputCh) != 0 {
+				t.Fatal("unexpected alert for a response that is still partial")
+			}
+
+			if err := qh.checkPartial(map[string]any{"timed_out": false}, outputCh); err != nil {
+				t.Fatal(err)
+			}
+			if len(outputCh) != 0 {
+				t.Fatal("unexpected alert for a complete response")
+			}
+
+			// Once a complete response was received, a partial
+			// response is alerted on again
+			_ = qh.checkPartial(partial, outputCh)
+			if tc.alert != (len(outputCh) == 1) {
+				t.Fatalf("expected a shard failure alert? %t (got %d)", tc.alert, len(outputCh))
+			}
+		})
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	body := map[string]any{"query": map[string]any{"match_all": map[string]any{}}}
+
+	qh := &QueryHandler{queryType: queryTypeSearch, timeout: 30 * time.Second}
+	got := qh.withTimeout(body)
+	if got["timeout"] != "30000ms" {
+		t.Errorf("unexpected timeout: %v", got["timeout"])
+	}
+	if _, ok := body["timeout"]; ok {
+		t.Error("withTimeout modified the given body")
+	}
+
+	qh.queryType = queryTypeCount
+	if _, ok := qh.withTimeout(body)["timeout"]; ok {
+		t.Error("count queries do not accept a timeout in the body")
+	}
+}
@@ -0,0 +1,376 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-uuid"
+	"github.com/robfig/cron"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/esclient"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/lock"
+)
+
+const (
+	defaultReportPeriod  = 24 * time.Hour
+	defaultReportTopKeys = 5
+
+	// maxReportRules is the largest number of rules a report
+	// summarizes
+	maxReportRules = 1000
+)
+
+// firing is recorded in the state document of a run of a rule
+// that sent an alert so that reports can summarize the alerts
+// sent by the rule.
+type firing struct {
+	ID       string         `json:"id"`
+	Rule     string         `json:"rule"`
+	Severity string         `json:"severity,omitempty"`
+	Fields   []*alert.Field `json:"fields,omitempty"`
+}
+
+func newFiring(a *alert.Alert) *firing {
+	if a == nil {
+		return nil
+	}
+	f := &firing{
+		ID:       a.ID,
+		Rule:     a.QualifiedName(),
+		Severity: a.Severity,
+	}
+	for _, record := range a.Records {
+		f.Fields = append(f.Fields, record.Fields...)
+	}
+	return f
+}
+
+// ReportHandlerConfig is passed as an argument to NewReportHandler().
+type ReportHandlerConfig struct {
+	// Name is the name of the report. This should come from the
+	// 'name' field of the report in the main configuration file
+	Name string
+
+	// AlertMethods are the methods by which the report is sent
+	AlertMethods []alert.Method
+
+	// Client is an *http.Client instance that will be used to
+	// query Elasticsearch
+	Client *http.Client
+
+	// ESUrl is the URL of the Elasticsearch instance. This should
+	// come from the 'elasticsearch.server.url' field of the main
+	// configuration file
+	ESUrl string
+
+	// Username and Password are used to authenticate with
+	// Elasticsearch if Username is not empty
+	Username string
+	Password string
+
+	// Schedule is when the report is sent (in cron syntax)
+	Schedule string
+
+	// Period is how far back the report looks for alerts. It
+	// defaults to 24 hours
+	Period time.Duration
+
+	// Rules limits the report to the alerts of these rules,
+	// given by name prefixed with their namespace, if any. If
+	// empty, the alerts of every rule are included
+	Rules []string
+
+	// TopKeys is the number of record keys with the highest
+	// counts listed for each rule. It defaults to 5
+	TopKeys int
+
+	Logger hclog.Logger
+}
+
+// ReportHandler summarizes the alerts sent by the rules, per the
+// state documents of their runs, and sends the summary to the
+// AlertHandler at the specified interval.
+type ReportHandler struct {
+	// StopCh terminates the Run() method when closed
+	StopCh chan struct{}
+
+	name         string
+	alertMethods []alert.Method
+	schedule     cron.Schedule
+	period       time.Duration
+	rules        []string
+	topKeys      int
+	logger       hclog.Logger
+	es           *esclient.Client
+}
+
+// NewReportHandler creates a new *ReportHandler instance.
+func NewReportHandler(config *ReportHandlerConfig) (*ReportHandler, error) {
+	if config == nil {
+		config = &ReportHandlerConfig{}
+	}
+
+	var allErrors *multierror.Error
+	if config.Name == "" {
+		allErrors = multierror.Append(allErrors, xerrors.New("no report name provided"))
+	}
+	config.ESUrl = strings.TrimRight(config.ESUrl, "/")
+	if config.ESUrl == "" {
+		allErrors = multierror.Append(allErrors, xerrors.New("no Elasticsearch URL provided"))
+	}
+	if len(config.AlertMethods) < 1 {
+		allErrors = multierror.Append(allErrors, xerrors.New("at least one alert method must be specified"))
+	}
+	if err := allErrors.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+
+	schedule, err := cron.Parse(config.Schedule)
+	if err != nil {
+		return nil, xerrors.Errorf("error parsing cron schedule: %v", err)
+	}
+
+	if config.Logger == nil {
+		config.Logger = hclog.Default()
+	}
+
+	return &ReportHandler{
+		StopCh: make(chan struct{}),
+
+		name:         config.Name,
+		alertMethods: config.AlertMethods,
+		schedule:     schedule,
+		period:       cmp.Or(config.Period, defaultReportPeriod),
+		rules:        config.Rules,
+		topKeys:      cmp.Or(config.TopKeys, defaultReportTopKeys),
+		logger:       config.Logger,
+		es: esclient.New(config.Client, config.ESUrl, esclient.Credentials{
+			Username: config.Username,
+			Password: config.Password,
+		}),
+	}, nil
+}
+
+// Run sends the report to the AlertHandler via outputCh each
+// time it is scheduled. The report covers the alerts sent during
+// the period leading up to that time. It will only send the
+// report if distLock.Acquired() is true.
+func (r *ReportHandler) Run(
+	ctx context.Context,
+	outputCh chan *alert.Alert,
+	wg *sync.WaitGroup,
+	distLock *lock.Lock,
+) {
+	defer func() {
+		wg.Done()
+	}()
+
+	next := r.schedule.Next(time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.StopCh:
+			return
+		case <-time.After(time.Until(next)):
+			if distLock.Acquired() {
+				to := time.Now()
+				a, err := r.report(ctx, to.Add(-r.period), to)
+				if err != nil {
+					r.logger.Error(fmt.Sprintf("[Report: %q] error creating report", r.name), "error", err)
+				} else {
+					outputCh <- a
+				}
+			}
+			next = r.schedule.Next(time.Now())
+		}
+	}
+}
+
+// ruleSummary summarizes the alerts sent by a rule.
+type ruleSummary struct {
+	name        string
+	count       int
+	first, last time.Time
+	keys        []*alert.Field
+}
+
+// report returns the alert summarizing the alerts sent between
+// from and to.
+func (r *ReportHandler) report(ctx context.Context, from, to time.Time) (*alert.Alert, error) {
+	summaries, err := r.summaries(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, xerrors.Errorf("error creating new random UUID: %v", err)
+	}
+
+	return &alert.Alert{
+		ID:       id,
+		RuleName: r.name,
+		Description: fmt.Sprintf("Alerts sent between %s and %s",
+			from.Format(time.RFC822), to.Format(time.RFC822)),
+		Records: r.summarize(summaries),
+		Methods: r.alertMethods,
+	}, nil
+}
+
+// reportResponse is the response to the aggregations of the state
+// documents of the runs that sent alerts.
+type reportResponse struct {
+	Aggregations struct {
+		Rules struct {
+			SumOtherDocCount int `json:"sum_other_doc_count"`
+			Buckets          []struct {
+				Key      string `json:"key"`
+				DocCount int    `json:"doc_count"`
+				First    struct {
+					Value float64 `json:"value"`
+				} `json:"first"`
+				Last struct {
+					Value float64 `json:"value"`
+				} `json:"last"`
+				Fields struct {
+					Keys struct {
+						Buckets []struct {
+							Key   string `json:"key"`
+							Count struct {
+								Value float64 `json:"value"`
+							} `json:"count"`
+						} `json:"buckets"`
+					} `json:"keys"`
+				} `json:"fields"`
+			} `json:"buckets"`
+		} `json:"rules"`
+	} `json:"aggregations"`
+}
+
+// summaries aggregates the state documents of the runs that sent
+// alerts between from and to by rule, ordered by the number of
+// alerts sent.
+func (r *ReportHandler) summaries(ctx context.Context, from, to time.Time) ([]*ruleSummary, error) {
+	filters := []any{
+		map[string]any{"exists": map[string]any{"field": "alert.id"}},
+		map[string]any{"range": map[string]any{"@timestamp": map[string]any{
+			"gte": from.Format(defaultTimestampFormat),
+			"lt":  to.Format(defaultTimestampFormat),
+		}}},
+	}
+	if len(r.rules) > 0 {
+		filters = append(filters, map[string]any{"terms": map[string]any{"alert.rule": r.rules}})
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"size":  0,
+		"query": map[string]any{"bool": map[string]any{"filter": filters}},
+		"aggs": map[string]any{
+			"rules": map[string]any{
+				"terms": map[string]any{
+					"field": "alert.rule",
+					"size":  maxReportRules,
+					"order": []any{map[string]any{"_count": "desc"}, map[string]any{"_key": "asc"}},
+				},
+				"aggs": map[string]any{
+					"first": map[string]any{"min": map[string]any{"field": "@timestamp"}},
+					"last":  map[string]any{"max": map[string]any{"field": "@timestamp"}},
+					"fields": map[string]any{
+						"nested": map[string]any{"path": "alert.fields"},
+						"aggs": map[string]any{
+							"keys": map[string]any{
+								"terms": map[string]any{
+									"field": "alert.fields.key",
+									"size":  r.topKeys,
+									"order": []any{map[string]any{"count": "desc"}, map[string]any{"_key": "asc"}},
+								},
+								"aggs": map[string]any{
+									"count": map[string]any{"sum": map[string]any{"field": "alert.fields.doc_count"}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("error JSON-encoding aggregations: %v", err)
+	}
+
+	data, err := r.es.Do(ctx, http.MethodPost, "/"+templateName()+"/_search", body)
+	if err != nil {
+		return nil, xerrors.Errorf("error searching state indices: %v", err)
+	}
+
+	var resp reportResponse
+	if err = json.Unmarshal(data, &resp); err != nil {
+		return nil, xerrors.Errorf("error JSON-decoding response body: %v", err)
+	}
+
+	rules := resp.Aggregations.Rules
+	if rules.SumOtherDocCount > 0 {
+		r.logger.Warn(fmt.Sprintf("[Report: %q] only the %d rules that sent the most alerts are included in the report",
+			r.name, maxReportRules))
+	}
+
+	summaries := make([]*ruleSummary, 0, len(rules.Buckets))
+	for _, bucket := range rules.Buckets {
+		s := &ruleSummary{
+			name:  bucket.Key,
+			count: bucket.DocCount,
+			first: time.UnixMilli(int64(bucket.First.Value)).UTC(),
+			last:  time.UnixMilli(int64(bucket.Last.Value)).UTC(),
+			keys:  make([]*alert.Field, 0, len(bucket.Fields.Keys.Buckets)),
+		}
+		for _, key := range bucket.Fields.Keys.Buckets {
+			s.keys = append(s.keys, &alert.Field{Key: key.Key, Count: int(key.Count.Value)})
+		}
+		summaries = append(summaries, s)
+	}
+	return summaries, nil
+}
+
+// summarize returns a record for each rule that sent alerts. Each
+// lists how many alerts the rule sent, when it sent the first and
+// last of them and the record keys with the highest counts.
+func (r *ReportHandler) summarize(summaries []*ruleSummary) []*alert.Record {
+	if len(summaries) == 0 {
+		return []*alert.Record{{Filter: "summary", Text: "No alerts were sent"}}
+	}
+
+	records := make([]*alert.Record, 0, len(summaries))
+	for _, s := range summaries {
+		records = append(records, &alert.Record{
+			Filter: s.name,
+			Text: fmt.Sprintf("%d %s (first at %s, last at %s)", s.count, alert.Plural(s.count, "alert"),
+				s.first.Format(time.RFC822), s.last.Format(time.RFC822)),
+			Fields: s.keys,
+		})
+	}
+	return records
+}
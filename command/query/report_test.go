@@ -0,0 +1,199 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/file"
+)
+
+func TestNewReportHandler(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *ReportHandlerConfig
+		err    bool
+	}{
+		{
+			"success",
+			&ReportHandlerConfig{
+				Name:         "Daily Summary",
+				ESUrl:        "http://127.0.0.1:9200",
+				Schedule:     "0 0 8 * * *",
+				AlertMethods: []alert.Method{&file.AlertMethod{}},
+			},
+			false,
+		},
+		{
+			"no-name",
+			&ReportHandlerConfig{
+				ESUrl:        "http://127.0.0.1:9200",
+				Schedule:     "0 0 8 * * *",
+				AlertMethods: []alert.Method{&file.AlertMethod{}},
+			},
+			true,
+		},
+		{
+			"no-methods",
+			&ReportHandlerConfig{
+				Name:     "Daily Summary",
+				ESUrl:    "http://127.0.0.1:9200",
+				Schedule: "0 0 8 * * *",
+			},
+			true,
+		},
+		{
+			"bad-schedule",
+			&ReportHandlerConfig{
+				Name:         "Daily Summary",
+				ESUrl:        "http://127.0.0.1:9200",
+				Schedule:     "daily",
+				AlertMethods: []alert.Method{&file.AlertMethod{}},
+			},
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rh, err := NewReportHandler(tc.config)
+			if tc.err != (err != nil) {
+				t.Fatalf("expected an error? %t (got %v)", tc.err, err)
+			}
+			if err == nil && (rh.period != 24*time.Hour || rh.topKeys != 5) {
+				t.Errorf("unexpected defaults: period %s, top keys %d", rh.period, rh.topKeys)
+			}
+		})
+	}
+}
+
+func TestNewFiring(t *testing.T) {
+	if newFiring(nil) != nil {
+		t.Error("expected no firing for runs that did not send an alert")
+	}
+
+	f := newFiring(&alert.Alert{
+		ID:        "test-id",
+		RuleName:  "Errors",
+		Namespace: "team-a",
+		Severity:  "critical",
+		Records: []*alert.Record{
+			{Filter: "hits.hits._source", Text: "{}"},
+			{Filter: "aggregations.hosts.buckets", Fields: []*alert.Field{{Key: "foo", Count: 2}}},
+		},
+	})
+	expected := &firing{ID: "test-id", Rule: "team-a/Errors", Severity: "critical", Fields: []*alert.Field{{Key: "foo", Count: 2}}}
+	if !reflect.DeepEqual(f, expected) {
+		t.Errorf("expected %+v, got %+v", expected, f)
+	}
+}
+
+func TestReport(t *testing.T) {
+	from := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	var query map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/go-es-alerts-"+templateVersion+"/_search" {
+			http.Error(w, "unexpected path "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"hits": {"hits": []}, "aggregations": {"rules": {"sum_other_doc_count": 0, "buckets": [
+  {"key": "team-a/Errors", "doc_count": 2,
+   "first": {"value": 1559350800000.0, "value_as_string": "2019-06-01T01:00:00Z"},
+   "last": {"value": 1559358000000.0, "value_as_string": "2019-06-01T03:00:00Z"},
+   "fields": {"doc_count": 4, "keys": {"buckets": [
+     {"key": "bar", "doc_count": 2, "count": {"value": 6.0}},
+     {"key": "foo", "doc_count": 1, "count": {"value": 3.0}}
+   ]}}},
+  {"key": "Disk Usage", "doc_count": 1,
+   "first": {"value": 1559354400000.0, "value_as_string": "2019-06-01T02:00:00Z"},
+   "last": {"value": 1559354400000.0, "value_as_string": "2019-06-01T02:00:00Z"},
+   "fields": {"doc_count": 0, "keys": {"buckets": []}}}
+]}}}`))
+	}))
+	defer ts.Close()
+
+	rh, err := NewReportHandler(&ReportHandlerConfig{
+		Name:         "Daily Summary",
+		Logger:       hclog.NewNullLogger(),
+		ESUrl:        ts.URL,
+		Schedule:     "0 0 8 * * *",
+		Rules:        []string{"team-a/Errors", "Disk Usage"},
+		TopKeys:      2,
+		AlertMethods: []alert.Method{&file.AlertMethod{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := rh.report(t.Context(), from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filter, _ := json.Marshal(query["query"])
+	if !strings.Contains(string(filter), `"alert.rule":["team-a/Errors","Disk Usage"]`) {
+		t.Errorf("the report should only search for the alerts of its rules, got %s", filter)
+	}
+	aggs, _ := json.Marshal(query["aggs"])
+	if query["size"] != 0.0 || !strings.Contains(string(aggs), `"size":2`) ||
+		!strings.Contains(string(aggs), `"field":"alert.rule"`) {
+		t.Errorf("the report should aggregate the alerts rather than fetch them, got size %v and %s",
+			query["size"], aggs)
+	}
+
+	if a.RuleName != "Daily Summary" || len(a.Methods) != 1 {
+		t.Errorf("unexpected report alert: %+v", a)
+	}
+
+	expected := []*alert.Record{
+		{
+			Filter: "team-a/Errors",
+			Text:   "2 alerts (first at 01 Jun 19 01:00 UTC, last at 01 Jun 19 03:00 UTC)",
+			Fields: []*alert.Field{{Key: "bar", Count: 6}, {Key: "foo", Count: 3}},
+		},
+		{
+			Filter: "Disk Usage",
+			Text:   "1 alert (first at 01 Jun 19 02:00 UTC, last at 01 Jun 19 02:00 UTC)",
+			Fields: []*alert.Field{},
+		},
+	}
+	if !reflect.DeepEqual(a.Records, expected) {
+		got, _ := json.MarshalIndent(a.Records, "", "  ")
+		t.Errorf("unexpected records:\n%s", got)
+	}
+}
+
+func TestSummarize_NoAlerts(t *testing.T) {
+	rh := &ReportHandler{topKeys: 5}
+	records := rh.summarize(nil)
+	if len(records) != 1 || records[0].Text != "No alerts were sent" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+}
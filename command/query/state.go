@@ -0,0 +1,78 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ruleState is the state of a rule that must survive between runs.
+// It is kept in memory by the *QueryHandler and persisted in the
+// 'state' field of the documents written to the state indices so
+// that it survives restarts and changes of leader.
+type ruleState struct {
+	// Values are the values of the fields of the conditions that
+	// compare to the previous run as of the most recent run
+	Values map[string]any `json:"values,omitempty"`
+
+	// History holds the most recent values, oldest first, of the
+	// fields of the rule's anomaly conditions
+	History map[string][]json.Number `json:"history,omitempty"`
+
+	// NoDataRuns is the number of consecutive runs in which the
+	// response had no data
+	NoDataRuns int `json:"no_data_runs,omitempty"`
+
+	// PendingRuns is the number of consecutive runs on which the
+	// rule's conditions held
+	PendingRuns int `json:"pending_runs,omitempty"`
+
+	// PendingSince is when the rule's conditions started holding
+	PendingSince *time.Time `json:"pending_since,omitempty"`
+
+	// Seen maps the keys of the hits already alerted on to when
+	// they were last alerted on
+	Seen map[string]time.Time `json:"seen,omitempty"`
+
+	// Failures is the number of consecutive runs on which the rule
+	// failed
+	Failures int `json:"failures,omitempty"`
+
+	// Partial is whether the response to the most recent query
+	// was partial
+	Partial bool `json:"partial,omitempty"`
+}
+
+// held records whether the rule's conditions were met on this run
+// and reports whether they have now held for long enough, per the
+// rule's 'consecutive_runs' and 'for' fields, for an alert to be sent.
+func (q *QueryHandler) held(met bool, now time.Time) bool {
+	if q.minRuns <= 1 && q.minDuration == 0 {
+		return met
+	}
+
+	if !met {
+		q.state.PendingRuns = 0
+		q.state.PendingSince = nil
+		return false
+	}
+
+	q.state.PendingRuns++
+	if q.state.PendingSince == nil {
+		q.state.PendingSince = &now
+	}
+
+	return q.state.PendingRuns >= q.minRuns && now.Sub(*q.state.PendingSince) >= q.minDuration
+}
@@ -0,0 +1,191 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/file"
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/lock"
+)
+
+func TestHeld(t *testing.T) {
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name        string
+		minRuns     int
+		minDuration time.Duration
+		met         []bool
+		expect      []bool
+	}{
+		{
+			name:   "no-requirement",
+			met:    []bool{true, false, true},
+			expect: []bool{true, false, true},
+		},
+		{
+			name:    "consecutive-runs",
+			minRuns: 3,
+			met:     []bool{true, true, false, true, true, true, true},
+			expect:  []bool{false, false, false, false, false, true, true},
+		},
+		{
+			name:        "for",
+			minDuration: 15 * time.Minute,
+			met:         []bool{true, true, true, true, false, true},
+			expect:      []bool{false, false, false, true, false, false},
+		},
+		{
+			name:        "both",
+			minRuns:     2,
+			minDuration: 5 * time.Minute,
+			met:         []bool{true, true, true},
+			expect:      []bool{false, true, true},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			qh := &QueryHandler{
+				minRuns:     tc.minRuns,
+				minDuration: tc.minDuration,
+				state:       new(ruleState),
+			}
+			for i, met := range tc.met {
+				now := start.Add(time.Duration(i) * 5 * time.Minute)
+				if got := qh.held(met, now); got != tc.expect[i] {
+					t.Fatalf("run %d: expected held to return %t, got %t", i+1, tc.expect[i], got)
+				}
+			}
+		})
+	}
+}
+
+// stateServer is a mock Elasticsearch instance that keeps the state
+// documents written to it and returns the latest of them, sorted as
+// Elasticsearch would, when searched.
+type stateServer struct {
+	mutex sync.Mutex
+	docs  []map[string]any
+}
+
+func (s *stateServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost:
+		var doc map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.docs = append(s.docs, doc)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet && r.URL.Path == fmt.Sprintf("/%s-%s/_search", defaultStateIndexAlias, templateVersion):
+		sorted := slices.SortedFunc(slices.Values(s.docs), func(a, b map[string]any) int {
+			ta, _ := time.Parse(time.RFC3339Nano, a["@timestamp"].(string))
+			tb, _ := time.Parse(time.RFC3339Nano, b["@timestamp"].(string))
+			return cmp.Or(cmp.Compare(b["next_query"].(string), a["next_query"].(string)), tb.Compare(ta))
+		})
+		hits := []any{}
+		if len(sorted) > 0 {
+			hits = append(hits, map[string]any{"_source": sorted[0]})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"hits": map[string]any{"hits": hits}})
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func TestLead_StateCarriesOver(t *testing.T) {
+	ts := httptest.NewServer(new(stateServer))
+	defer ts.Close()
+
+	newHandler := func() *QueryHandler {
+		qh, err := NewQueryHandler(&QueryHandlerConfig{
+			Name:            "Test Errors",
+			Logger:          hclog.NewNullLogger(),
+			ESUrl:           ts.URL,
+			QueryIndex:      "test-*",
+			AlertMethods:    []alert.Method{&file.AlertMethod{}},
+			QueryData:       map[string]any{"hello": "world"},
+			Schedule:        "@every 10m",
+			ConsecutiveRuns: 10,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return qh
+	}
+	nodeA, nodeB := newHandler(), newHandler()
+	lockA, lockB := lock.NewLock(), lock.NewLock()
+
+	// Every state document has the same next_query, so only the
+	// tiebreaker decides which is restored
+	next := time.Now().Add(time.Hour)
+
+	// run mimics a run of the rule by the node, during which the
+	// conditions of the rule hold
+	run := func(q *QueryHandler, l *lock.Lock) {
+		if q.lead(t.Context(), l) {
+			q.held(true, time.Now())
+			q.state.Failures++
+		}
+		if q.leader && l.Acquired() {
+			if err := q.setNextQuery(t.Context(), next, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	lockA.Set(true)
+	for range 3 {
+		run(nodeA, lockA)
+		run(nodeB, lockB)
+	}
+
+	// Leadership moves to node B, which must pick up where node A
+	// left off rather than from its own state
+	lockA.Set(false)
+	lockB.Set(true)
+	for range 2 {
+		run(nodeA, lockA)
+		run(nodeB, lockB)
+	}
+	if nodeB.state.PendingRuns != 5 || nodeB.state.Failures != 5 {
+		t.Fatalf("expected node B to carry over the counters of node A, got %+v", nodeB.state)
+	}
+
+	// And back to node A, whose state in memory is now stale
+	lockB.Set(false)
+	lockA.Set(true)
+	run(nodeB, lockB)
+	run(nodeA, lockA)
+	if nodeA.state.PendingRuns != 6 || nodeA.state.Failures != 6 {
+		t.Fatalf("expected node A to carry over the counters of node B, got %+v", nodeA.state)
+	}
+}
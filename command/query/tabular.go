@@ -0,0 +1,128 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+func isTabular(queryType string) bool {
+	return queryType == queryTypeSQL || queryType == queryTypeESQL
+}
+
+// sql executes the rule's statement with the Elasticsearch SQL API
+// and converts the tabular response with toRows. If the rule has a
+// timeout, Elasticsearch stops running the statement once it passes.
+func (q *QueryHandler) sql(ctx context.Context) (map[string]any, error) {
+	body := map[string]any{"query": q.statement}
+	if q.timeout > 0 {
+		body["request_timeout"] = q.timeoutParam()
+		body["page_timeout"] = q.timeoutParam()
+	}
+
+	data, err := q.post(ctx, http.MethodPost, fmt.Sprintf("%s/_sql?format=json", q.esURL), body)
+	if err != nil {
+		return nil, err
+	}
+	return toRows(data, "rows")
+}
+
+// esql executes the rule's statement with the ES|QL API and
+// converts the tabular response with toRows. If the rule has a
+// timeout, the statement is run asynchronously and is canceled if
+// it has not completed once the timeout passes.
+func (q *QueryHandler) esql(ctx context.Context) (map[string]any, error) {
+	if q.timeout <= 0 {
+		data, err := q.post(ctx, http.MethodPost, fmt.Sprintf("%s/_query", q.esURL),
+			map[string]any{"query": q.statement})
+		if err != nil {
+			return nil, err
+		}
+		return toRows(data, "values")
+	}
+
+	data, err := q.post(ctx, http.MethodPost, fmt.Sprintf("%s/_query/async", q.esURL), map[string]any{
+		"query":                       q.statement,
+		"wait_for_completion_timeout": q.timeoutParam(),
+		"keep_on_completion":          false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if running, _ := data["is_running"].(bool); running {
+		id, _ := data["id"].(string)
+		// Delete the query even if ctx was canceled so that it
+		// stops running
+		if err := q.deleteESQL(context.WithoutCancel(ctx), id); err != nil {
+			q.logger.Warn(fmt.Sprintf("[Rule: %q] error canceling ES|QL query", q.name), "error", err)
+		}
+		return nil, xerrors.Errorf("ES|QL query did not complete within %s", q.timeout)
+	}
+	return toRows(data, "values")
+}
+
+func (q *QueryHandler) deleteESQL(ctx context.Context, id string) error {
+	u := fmt.Sprintf("%s/_query/async/%s", q.esURL, url.PathEscape(id))
+	req, err := q.newRequest(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return xerrors.Errorf("error creating new request: %v", err)
+	}
+	_, err = q.do(req)
+	return err
+}
+
+// toRows converts a tabular response, whose 'columns' field lists
+// the columns and whose valuesField field holds an array of rows,
+// into a response whose 'rows' field holds an array of objects
+// mapping the names of the columns to their values. The number of
+// rows is also given as 'row_count' for use in conditions.
+func toRows(data map[string]any, valuesField string) (map[string]any, error) {
+	rawColumns, _ := data["columns"].([]any)
+	columns := make([]string, 0, len(rawColumns))
+	for _, raw := range rawColumns {
+		column, ok := raw.(map[string]any)
+		if !ok {
+			return nil, xerrors.New("unexpected column in tabular response")
+		}
+		name, _ := column["name"].(string)
+		columns = append(columns, name)
+	}
+
+	rawRows, _ := data[valuesField].([]any)
+	rows := make([]any, 0, len(rawRows))
+	for _, raw := range rawRows {
+		values, ok := raw.([]any)
+		if !ok || len(values) != len(columns) {
+			return nil, xerrors.New("unexpected row in tabular response")
+		}
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		rows = append(rows, row)
+	}
+
+	return map[string]any{
+		"rows":      rows,
+		"row_count": json.Number(strconv.Itoa(len(rows))),
+	}, nil
+}
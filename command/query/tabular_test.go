@@ -0,0 +1,205 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert/file"
+	"github.com/morningconsult/go-elasticsearch-alerts/config"
+)
+
+func TestQuery_Tabular(t *testing.T) {
+	cases := []struct {
+		name      string
+		queryType string
+		path      string
+		response  string
+		err       bool
+	}{
+		{
+			name:      "sql",
+			queryType: config.QueryTypeSQL,
+			path:      "/_sql",
+			response:  `{"columns":[{"name":"key","type":"keyword"},{"name":"doc_count","type":"long"}],"rows":[["web-1",25],["web-2",30]]}`,
+		},
+		{
+			name:      "esql",
+			queryType: config.QueryTypeESQL,
+			path:      "/_query",
+			response:  `{"columns":[{"name":"key","type":"keyword"},{"name":"doc_count","type":"long"}],"values":[["web-1",25],["web-2",30]]}`,
+		},
+		{
+			name:      "mismatched-row",
+			queryType: config.QueryTypeSQL,
+			path:      "/_sql",
+			response:  `{"columns":[{"name":"key","type":"keyword"}],"rows":[["web-1",25]]}`,
+			err:       true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if r.URL.Path != tc.path || !strings.Contains(string(body), "FROM logs") {
+					http.Error(w, "unexpected request", http.StatusBadRequest)
+					return
+				}
+				fmt.Fprint(w, tc.response)
+			}))
+			defer ts.Close()
+
+			qh, err := NewQueryHandler(&QueryHandlerConfig{
+				Name:         "Test Tabular",
+				ESUrl:        ts.URL,
+				QueryType:    tc.queryType,
+				Statement:    "SELECT host AS key, COUNT(*) AS doc_count FROM logs GROUP BY host",
+				AlertMethods: []alert.Method{&file.AlertMethod{}},
+				Filters:      []string{"rows"},
+				Schedule:     "@every 10m",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := qh.query(t.Context())
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if data["row_count"] != json.Number("2") {
+				t.Errorf("unexpected row count: %v", data["row_count"])
+			}
+
+			res, err := qh.process(data, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := []*alert.Field{
+				{Key: "web-1", Count: 25},
+				{Key: "web-2", Count: 30},
+			}
+			if len(res.records) != 2 || !cmp.Equal(res.records[0].Fields, expected) {
+				t.Fatalf("unexpected records: %v", cmp.Diff(expected, res.records[0].Fields))
+			}
+			if !res.records[1].BodyField || !strings.Contains(res.records[1].Text, "web-2") {
+				t.Errorf("unexpected body field record: %+v", res.records[1])
+			}
+		})
+	}
+}
+
+func TestQuery_TabularTimeout(t *testing.T) {
+	cases := []struct {
+		name      string
+		queryType string
+		path      string
+		params    []string
+		response  string
+		deleted   bool
+		err       bool
+	}{
+		{
+			name:      "sql",
+			queryType: config.QueryTypeSQL,
+			path:      "/_sql",
+			params:    []string{`"request_timeout":"30000ms"`, `"page_timeout":"30000ms"`},
+			response:  `{"columns":[{"name":"key","type":"keyword"}],"rows":[["web-1"]]}`,
+		},
+		{
+			name:      "esql-completed",
+			queryType: config.QueryTypeESQL,
+			path:      "/_query/async",
+			params:    []string{`"wait_for_completion_timeout":"30000ms"`, `"keep_on_completion":false`},
+			response:  `{"is_running":false,"columns":[{"name":"key","type":"keyword"}],"values":[["web-1"]]}`,
+		},
+		{
+			name:      "esql-running",
+			queryType: config.QueryTypeESQL,
+			path:      "/_query/async",
+			params:    []string{`"wait_for_completion_timeout":"30000ms"`},
+			response:  `{"id":"query-1","is_running":true}`,
+			deleted:   true,
+			err:       true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var deleted bool
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodDelete && r.URL.Path == "/_query/async/query-1" {
+					deleted = true
+					fmt.Fprint(w, `{"acknowledged":true}`)
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				if r.URL.Path != tc.path {
+					http.Error(w, "unexpected request", http.StatusBadRequest)
+					return
+				}
+				for _, param := range tc.params {
+					if !strings.Contains(string(body), param) {
+						http.Error(w, "missing "+param, http.StatusBadRequest)
+						return
+					}
+				}
+				fmt.Fprint(w, tc.response)
+			}))
+			defer ts.Close()
+
+			qh, err := NewQueryHandler(&QueryHandlerConfig{
+				Name:         "Test Tabular",
+				ESUrl:        ts.URL,
+				QueryType:    tc.queryType,
+				Statement:    "FROM logs | KEEP host",
+				AlertMethods: []alert.Method{&file.AlertMethod{}},
+				Timeout:      30 * time.Second,
+				Schedule:     "@every 10m",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := qh.query(t.Context())
+			if tc.err != (err != nil) {
+				t.Fatalf("expected an error? %t (got %v)", tc.err, err)
+			}
+			if deleted != tc.deleted {
+				t.Errorf("expected the query to be deleted? %t", tc.deleted)
+			}
+			if !tc.err && data["row_count"] != json.Number("1") {
+				t.Errorf("unexpected row count: %v", data["row_count"])
+			}
+		})
+	}
+}
@@ -15,7 +15,10 @@ package query
 
 import (
 	"encoding/json"
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 
@@ -26,31 +29,89 @@ import (
 
 const hitsDelimiter = "\n----------------------------------------\n"
 
+// result is the outcome of processing a response from Elasticsearch.
+type result struct {
+	// records are the alert records to be sent to the outputs
+	records []*alert.Record
+
+	// hits are the response fields grouped by the body field
+	hits []map[string]any
+
+	// groups are the names of the condition groups that fired
+	groups []string
+
+	// severity is the severity of the highest condition level
+	// that matched, if the rule has condition levels
+	severity string
+
+	// keys identify the hits in the body field record so that
+	// they can be excluded from later alerts if the rule
+	// deduplicates hits
+	keys []string
+}
+
 // process converts the raw response returned from Elasticsearch into a
 // []*github.com/morningconsult/go-elasticsearch-alerts/command/alert.Record
-// array and returns that array, the response fields grouped by
-// *QueryHandler.bodyField (if any), and an error if there was an error.
-// If process returns a non-nil error, the other returned values will
-// be nil.
+// array and returns a *result holding that array, the response fields
+// grouped by *QueryHandler.bodyField (if any), and the condition groups
+// and level that matched. Comparison conditions are evaluated against
+// ref, which may be nil. Filters with per-bucket conditions only report
+// the buckets satisfying those conditions. If the response does not meet
+// the rule's conditions, the returned *result will have no records. If process
+// returns a non-nil error, the returned *result will be nil.
 //
 //nolint:gocognit
-func (q *QueryHandler) process(
-	respData map[string]any,
-) ([]*alert.Record, []map[string]any, error) {
-	if len(q.conditions) != 0 && !config.ConditionsMet(q.logger.Named("conditions"), respData, q.conditions) {
-		return nil, nil, nil
+func (q *QueryHandler) process(respData map[string]any, ref *config.Reference) (*result, error) {
+	logger := q.logger.Named("conditions")
+	if len(q.conditions) != 0 && !config.ConditionsMetWithReference(logger, respData, ref, q.conditions) {
+		return &result{}, nil
+	}
+
+	groups, groupConditions, ok := q.firedGroups(respData, ref)
+	if !ok {
+		return &result{}, nil
+	}
+
+	severity, levelConditions, ok := q.matchedLevel(respData, ref)
+	if !ok {
+		return &result{}, nil
 	}
 
-	records := make([]*alert.Record, 0)
+	// The buckets must satisfy the rule's conditions, those of the
+	// matched level and those of any one of the fired groups
+	conditions := slices.Concat(q.conditions, levelConditions)
+	sets := [][]config.Condition{conditions}
+	if len(groupConditions) > 0 {
+		sets = make([][]config.Condition, 0, len(groupConditions))
+		for _, group := range groupConditions {
+			sets = append(sets, slices.Concat(conditions, group))
+		}
+	}
+
+	buckets := config.MatchingBucketsAny(logger, respData, sets)
+	for _, matching := range buckets {
+		if len(matching) == 0 {
+			return &result{}, nil
+		}
+	}
+
+	res := &result{
+		records:  make([]*alert.Record, 0),
+		groups:   groups,
+		severity: severity,
+	}
 	for _, filter := range q.filters {
-		elems := jsonpath.GetAll(respData, filter)
+		elems, ok := buckets[filter]
+		if !ok {
+			elems = jsonpath.GetAll(respData, filter)
+		}
 		if len(elems) < 1 {
 			continue
 		}
 
 		fields, err := q.gatherFields(elems)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 
 		if len(fields) < 1 {
@@ -62,19 +123,29 @@ func (q *QueryHandler) process(
 			Fields: fields,
 		}
 
-		records = append(records, record)
+		res.records = append(res.records, record)
+	}
+
+	if q.queryType == queryTypeEQL {
+		sequences, err := q.sequenceRecords(respData)
+		if err != nil {
+			return nil, err
+		}
+		res.records = append(res.records, sequences...)
 	}
 
 	// Get the body field
-	body := jsonpath.GetAll(respData, q.bodyField)
+	body, keys := q.bodyElements(respData)
 	if body == nil {
-		return records, nil, nil
+		return res, nil
 	}
+	body, res.keys = q.unseen(body, keys, time.Now())
 
 	stringifiedHits, hits, err := q.gatherHits(body)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	res.hits = hits
 
 	if len(stringifiedHits) > 0 {
 		record := &alert.Record{
@@ -82,10 +153,64 @@ func (q *QueryHandler) process(
 			Text:      strings.Join(stringifiedHits, hitsDelimiter),
 			BodyField: true,
 		}
-		records = append(records, record)
+		if q.collect != nil && len(stringifiedHits) > q.collect.SummaryHits {
+			record.Summary = fmt.Sprintf("%s\n\n(%d of %d hits shown)",
+				strings.Join(stringifiedHits[:q.collect.SummaryHits], hitsDelimiter),
+				q.collect.SummaryHits, len(stringifiedHits))
+		}
+		res.records = append(res.records, record)
+	}
+
+	return res, nil
+}
+
+// firedGroups returns the names and the conditions of the condition
+// groups whose conditions are all met by the response. It returns
+// false if the rule has condition groups but none of them fired, in
+// which case no alert should be sent.
+func (q *QueryHandler) firedGroups(
+	respData map[string]any,
+	ref *config.Reference,
+) ([]string, [][]config.Condition, bool) {
+	if len(q.groups) == 0 {
+		return nil, nil, true
+	}
+
+	logger := q.logger.Named("conditions")
+
+	var (
+		fired      []string
+		conditions [][]config.Condition
+	)
+	for _, group := range q.groups {
+		if config.ConditionsMetWithReference(logger, respData, ref, group.Conditions) {
+			fired = append(fired, group.Name)
+			conditions = append(conditions, group.Conditions)
+		}
 	}
+	return fired, conditions, len(fired) > 0
+}
 
-	return records, hits, nil
+// matchedLevel returns the severity and the conditions of the last
+// (i.e. highest) condition level whose conditions are all met by the
+// response. It returns false if the rule has condition levels but
+// none of them matched, in which case no alert should be sent.
+func (q *QueryHandler) matchedLevel(
+	respData map[string]any,
+	ref *config.Reference,
+) (string, []config.Condition, bool) {
+	if len(q.levels) == 0 {
+		return "", nil, true
+	}
+
+	logger := q.logger.Named("conditions")
+
+	for i := len(q.levels) - 1; i >= 0; i-- {
+		if config.ConditionsMetWithReference(logger, respData, ref, q.levels[i].Conditions) {
+			return q.levels[i].Severity, q.levels[i].Conditions, true
+		}
+	}
+	return "", nil, false
 }
 
 func (q *QueryHandler) gatherHits(body []any) ([]string, []map[string]any, error) {
@@ -479,6 +479,96 @@ func TestProcess(t *testing.T) {
 			hits: 0,
 			err:  false,
 		},
+		{
+			name: "bucket-conditions-met",
+			input: map[string]any{
+				"aggregations": map[string]any{
+					"hostname": map[string]any{
+						"buckets": []any{
+							map[string]any{
+								"key":       "foo",
+								"doc_count": 2,
+								"queue_size": map[string]any{
+									"value": json.Number("10"),
+								},
+							},
+							map[string]any{
+								"key":       "bar",
+								"doc_count": 3,
+								"queue_size": map[string]any{
+									"value": json.Number("20"),
+								},
+							},
+						},
+					},
+				},
+			},
+			filters: []string{"aggregations.hostname.buckets"},
+			conditions: []config.Condition{
+				{
+					"buckets":    "aggregations.hostname.buckets",
+					"field":      "queue_size.value",
+					"quantifier": "any",
+					"gt":         json.Number("15"),
+				},
+			},
+			output: []*alert.Record{
+				{
+					Filter: "aggregations.hostname.buckets",
+					Fields: []*alert.Field{
+						{
+							Key:   "bar",
+							Count: 3,
+						},
+					},
+				},
+			},
+			hits: 0,
+			err:  false,
+		},
+		{
+			name: "bucket-conditions-not-met",
+			input: map[string]any{
+				"aggregations": map[string]any{
+					"hostname": map[string]any{
+						"buckets": []any{
+							map[string]any{
+								"key":       "foo",
+								"doc_count": 2,
+								"queue_size": map[string]any{
+									"value": json.Number("10"),
+								},
+							},
+							map[string]any{
+								"key":       "bar",
+								"doc_count": 3,
+								"queue_size": map[string]any{
+									"value": json.Number("20"),
+								},
+							},
+						},
+					},
+				},
+			},
+			filters: []string{"aggregations.hostname.buckets"},
+			conditions: []config.Condition{
+				{
+					"buckets":    "aggregations.hostname.buckets",
+					"field":      "queue_size.value",
+					"quantifier": "any",
+					"gt":         json.Number("15"),
+				},
+				{
+					"buckets":    "aggregations.hostname.buckets",
+					"field":      "key",
+					"quantifier": "any",
+					"eq":         "foo",
+				},
+			},
+			output: nil,
+			hits:   0,
+			err:    false,
+		},
 	}
 
 	logger := hclog.NewNullLogger()
@@ -491,18 +581,261 @@ func TestProcess(t *testing.T) {
 				bodyField:  defaultBodyField,
 				conditions: tc.conditions,
 			}
-			records, hits, err := qh.process(tc.input)
-			if tc.hits != len(hits) {
-				t.Fatalf("Got %d hits, expected %d", len(hits), tc.hits)
-			}
+			res, err := qh.process(tc.input, nil)
 			if !tc.err && err != nil {
 				t.Fatal(err)
 			}
-			if tc.err && err == nil {
-				t.Fatal("expected an error but did not receive one")
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error but did not receive one")
+				}
+				return
+			}
+			if tc.hits != len(res.hits) {
+				t.Fatalf("Got %d hits, expected %d", len(res.hits), tc.hits)
+			}
+			if !cmp.Equal(tc.output, res.records) {
+				t.Errorf("Results differ:\n%v", cmp.Diff(tc.output, res.records))
+			}
+		})
+	}
+}
+
+func TestFiredGroups(t *testing.T) {
+	resp := map[string]any{
+		"hits": map[string]any{
+			"total": map[string]any{
+				"value": json.Number("120"),
+			},
+		},
+	}
+
+	group := func(name, gt string) config.ConditionGroup {
+		return config.ConditionGroup{
+			Name: name,
+			Conditions: []config.Condition{
+				{"field": "hits.total.value", "quantifier": "any", "gt": json.Number(gt)},
+			},
+		}
+	}
+
+	cases := []struct {
+		name     string
+		groups   []config.ConditionGroup
+		expected []string
+		ok       bool
+	}{
+		{
+			"no-groups",
+			nil,
+			nil,
+			true,
+		},
+		{
+			"some-fired",
+			[]config.ConditionGroup{group("warning", "50"), group("critical", "500")},
+			[]string{"warning"},
+			true,
+		},
+		{
+			"none-fired",
+			[]config.ConditionGroup{group("critical", "500")},
+			nil,
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			qh := &QueryHandler{
+				logger: hclog.NewNullLogger(),
+				groups: tc.groups,
+			}
+			fired, _, ok := qh.firedGroups(resp, nil)
+			if ok != tc.ok {
+				t.Fatalf("got %t, expected %t", ok, tc.ok)
+			}
+			if !cmp.Equal(tc.expected, fired) {
+				t.Errorf("Fired groups differ:\n%v", cmp.Diff(tc.expected, fired))
+			}
+		})
+	}
+}
+
+func TestMatchedLevel(t *testing.T) {
+	level := func(severity, gt string) config.ConditionLevel {
+		return config.ConditionLevel{
+			Severity: severity,
+			Conditions: []config.Condition{
+				{"field": "hits.total.value", "quantifier": "any", "gt": json.Number(gt)},
+			},
+		}
+	}
+
+	levels := []config.ConditionLevel{level("warning", "50"), level("critical", "500")}
+
+	cases := []struct {
+		name     string
+		total    string
+		levels   []config.ConditionLevel
+		expected string
+		ok       bool
+	}{
+		{
+			"no-levels",
+			"10",
+			nil,
+			"",
+			true,
+		},
+		{
+			"below-all-levels",
+			"10",
+			levels,
+			"",
+			false,
+		},
+		{
+			"warning",
+			"120",
+			levels,
+			"warning",
+			true,
+		},
+		{
+			"highest-level-wins",
+			"1200",
+			levels,
+			"critical",
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			qh := &QueryHandler{
+				logger:    hclog.NewNullLogger(),
+				levels:    tc.levels,
+				bodyField: defaultBodyField,
+			}
+			resp := map[string]any{
+				"hits": map[string]any{
+					"total": map[string]any{
+						"value": json.Number(tc.total),
+					},
+					"hits": []any{
+						map[string]any{"_source": map[string]any{"hello": "world"}},
+					},
+				},
+			}
+
+			severity, _, ok := qh.matchedLevel(resp, nil)
+			if ok != tc.ok {
+				t.Fatalf("got %t, expected %t", ok, tc.ok)
+			}
+			if severity != tc.expected {
+				t.Fatalf("got severity %q, expected %q", severity, tc.expected)
+			}
+
+			res, err := qh.process(resp, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.severity != tc.expected {
+				t.Fatalf("got result severity %q, expected %q", res.severity, tc.expected)
+			}
+			if (len(res.records) > 0) != tc.ok {
+				t.Fatalf("expected records only when a level matches (got %d records)", len(res.records))
+			}
+		})
+	}
+}
+
+func TestProcess_GroupAndLevelBuckets(t *testing.T) {
+	bucketsOver := func(count string) config.Condition {
+		return config.Condition{
+			"buckets":    "aggregations.hostname.buckets",
+			"field":      "doc_count",
+			"quantifier": "any",
+			"gt":         json.Number(count),
+		}
+	}
+	keyIs := func(key string) config.Condition {
+		return config.Condition{
+			"buckets":    "aggregations.hostname.buckets",
+			"field":      "key",
+			"quantifier": "any",
+			"eq":         key,
+		}
+	}
+
+	resp := map[string]any{
+		"aggregations": map[string]any{
+			"hostname": map[string]any{
+				"buckets": []any{
+					map[string]any{"key": "foo", "doc_count": json.Number("5")},
+					map[string]any{"key": "bar", "doc_count": json.Number("50")},
+					map[string]any{"key": "baz", "doc_count": json.Number("500")},
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		name     string
+		groups   []config.ConditionGroup
+		levels   []config.ConditionLevel
+		expected []string
+	}{
+		{
+			name: "level",
+			levels: []config.ConditionLevel{
+				{Severity: "warning", Conditions: []config.Condition{bucketsOver("10")}},
+				{Severity: "critical", Conditions: []config.Condition{bucketsOver("100")}},
+			},
+			expected: []string{"baz"},
+		},
+		{
+			name: "one-group-fired",
+			groups: []config.ConditionGroup{
+				{Name: "busy", Conditions: []config.Condition{bucketsOver("10")}},
+				{Name: "qux", Conditions: []config.Condition{keyIs("qux")}},
+			},
+			expected: []string{"bar", "baz"},
+		},
+		{
+			name: "several-groups-fired",
+			groups: []config.ConditionGroup{
+				{Name: "very-busy", Conditions: []config.Condition{bucketsOver("100")}},
+				{Name: "foo", Conditions: []config.Condition{keyIs("foo")}},
+			},
+			expected: []string{"foo", "baz"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			qh := &QueryHandler{
+				logger:    hclog.NewNullLogger(),
+				filters:   []string{"aggregations.hostname.buckets"},
+				bodyField: defaultBodyField,
+				groups:    tc.groups,
+				levels:    tc.levels,
+			}
+			res, err := qh.process(resp, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res.records) != 1 {
+				t.Fatalf("expected 1 record, got %d", len(res.records))
+			}
+
+			var keys []string
+			for _, field := range res.records[0].Fields {
+				keys = append(keys, field.Key)
 			}
-			if !cmp.Equal(tc.output, records) {
-				t.Errorf("Results differ:\n%v", cmp.Diff(tc.output, records))
+			if !cmp.Equal(tc.expected, keys) {
+				t.Errorf("Buckets differ:\n%v", cmp.Diff(tc.expected, keys))
 			}
 		})
 	}
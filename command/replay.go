@@ -0,0 +1,149 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package command
+
+import (
+	"context"
+	"fmt"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/command/alert"
+	"github.com/morningconsult/go-elasticsearch-alerts/config"
+)
+
+// Replay sends the alerts kept by the dead letter store through
+// the outputs to which they could not be sent. The dead letters
+// of the alerts that are sent are removed from the store. This
+// function should be called directly within os.Exit() in your
+// main.main() function.
+func Replay() int {
+	logger := hclog.Default()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shutdownCh := makeShutdownCh()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-shutdownCh:
+			cancel()
+		}
+	}()
+
+	cfg, err := config.ParseConfig()
+	if err != nil {
+		logger.Error("Error loading main configuration file", "error", err)
+		return 1
+	}
+
+	esClient, err := cfg.NewESClient()
+	if err != nil {
+		logger.Error("Error creating new Elasticsearch HTTP client", "error", err)
+		return 1
+	}
+
+	store, err := buildDeadLetterStore(cfg, esClient)
+	if err != nil {
+		logger.Error("Error creating dead letter store", "error", err)
+		return 1
+	}
+	if store == nil {
+		logger.Error("No 'dead_letter' field found in main configuration file")
+		return 1
+	}
+
+	letters, err := store.Load(ctx)
+	if err != nil {
+		logger.Error("Error loading dead letters", "error", err)
+		return 1
+	}
+	logger.Info(fmt.Sprintf("Replaying %d dead letters", len(letters)))
+
+	var replayed []string
+	for _, d := range letters {
+		if err := replayDeadLetter(ctx, cfg, d); err != nil {
+			logger.Error(fmt.Sprintf("Error replaying alert from rule %q", d.Alert.QualifiedName()),
+				"dead_letter", d.ID, "error", err)
+			continue
+		}
+		replayed = append(replayed, d.ID)
+	}
+
+	if err := store.Remove(ctx, replayed); err != nil {
+		logger.Error("Error removing replayed dead letters", "error", err)
+		return 1
+	}
+
+	logger.Info(fmt.Sprintf("Replayed %d of %d dead letters", len(replayed), len(letters)))
+	if len(replayed) < len(letters) {
+		return 1
+	}
+	return 0
+}
+
+// replayDeadLetter sends the alert of the dead letter through the
+// output, as currently configured, to which it could not be sent.
+func replayDeadLetter(ctx context.Context, cfg *config.Config, d *alert.DeadLetter) error {
+	if d.Output == nil {
+		return xerrors.New("the output to which the alert could not be sent is unknown")
+	}
+
+	method, err := resolveOutput(cfg, d.Alert, d.Output)
+	if err != nil {
+		return err
+	}
+	return method.Write(ctx, d.Alert)
+}
+
+// resolveOutput builds the Method from the output, as currently
+// configured, from which a Method the alert was to be sent with
+// was built.
+func resolveOutput(cfg *config.Config, a *alert.Alert, output *alert.Output) (alert.Method, error) {
+	var outputs []config.OutputConfig
+	switch output.Field {
+	case fieldErrorOutputs:
+		outputs = cfg.ErrorOutputs
+	case fieldOutputs, fieldShardFailureOutputs:
+		for _, rule := range cfg.Rules {
+			if rule.Name != a.RuleName || rule.Namespace != a.Namespace {
+				continue
+			}
+			outputs = rule.Outputs
+			if output.Field == fieldShardFailureOutputs {
+				outputs = rule.ShardFailureOutputs
+			}
+		}
+	case fieldReportOutputs:
+		for _, report := range cfg.Reports {
+			if report.Name == a.RuleName {
+				outputs = report.Outputs
+			}
+		}
+	default:
+		return nil, xerrors.Errorf("unknown output field %q", output.Field)
+	}
+
+	if output.Index < 0 || output.Index >= len(outputs) ||
+		outputs[output.Index].Type != output.Type {
+		return nil, xerrors.Errorf("%s output %d of field %q no longer exists", output.Type, output.Index, output.Field)
+	}
+
+	method, err := buildOutputMethod(outputs[output.Index])
+	if err != nil {
+		return nil, xerrors.Errorf("error creating alert.AlertMethod: %v", err)
+	}
+	return method, nil
+}
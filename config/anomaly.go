@@ -0,0 +1,243 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"golang.org/x/xerrors"
+
+	"github.com/morningconsult/go-elasticsearch-alerts/internal/jsonpath"
+)
+
+const (
+	keyAnomaly   = "anomaly"
+	keyThreshold = "threshold"
+	keyLower     = "lower"
+	keyUpper     = "upper"
+	keyHistory   = "history"
+	keyWarmup    = "warmup"
+	keyDirection = "direction"
+
+	anomalyStdDev     = "stddev"
+	anomalyPercentile = "percentile"
+
+	directionBoth  = "both"
+	directionAbove = "above"
+	directionBelow = "below"
+
+	defaultThreshold = 3
+	defaultLower     = 5
+	defaultUpper     = 95
+	defaultHistory   = 100
+	defaultWarmup    = 10
+)
+
+func (c Condition) anomaly() string {
+	v, _ := c[keyAnomaly].(string)
+	return v
+}
+
+func (c Condition) number(key string) float64 {
+	n, _ := c[key].(json.Number)
+	f, _ := n.Float64()
+	return f
+}
+
+func (c Condition) history() int {
+	return int(c.number(keyHistory))
+}
+
+func (c Condition) validateAnomaly() []error { //nolint:gocyclo
+	raw, ok := c[keyAnomaly]
+	if !ok {
+		return nil
+	}
+
+	var errs []error
+	switch v, _ := raw.(string); v {
+	case anomalyStdDev:
+		errs = append(errs, c.defaultNumber(keyThreshold, defaultThreshold, 0, math.Inf(1))...)
+	case anomalyPercentile:
+		errs = append(errs, c.defaultNumber(keyLower, defaultLower, 0, 100)...)
+		errs = append(errs, c.defaultNumber(keyUpper, defaultUpper, 0, 100)...)
+		if len(errs) == 0 && c.number(keyLower) >= c.number(keyUpper) {
+			errs = append(errs, errors.New("field 'lower' of condition must be less than field 'upper'"))
+		}
+	default:
+		errs = append(errs, errors.New("field 'anomaly' of condition must either be 'stddev' or 'percentile'"))
+	}
+
+	errs = append(errs, c.defaultNumber(keyHistory, defaultHistory, 1, math.Inf(1))...)
+	errs = append(errs, c.defaultNumber(keyWarmup, defaultWarmup, 1, math.Inf(1))...)
+	if len(errs) == 0 && c.number(keyWarmup) > c.number(keyHistory) {
+		errs = append(errs, errors.New("field 'warmup' of condition must not be greater than field 'history'"))
+	}
+
+	switch v := c[keyDirection].(type) {
+	case nil:
+		c[keyDirection] = directionBoth
+	case string:
+		if v != directionBoth && v != directionAbove && v != directionBelow {
+			errs = append(errs, errors.New("field 'direction' of condition must either be 'both', 'above', or 'below'"))
+		}
+	default:
+		errs = append(errs, errors.New("field 'direction' of condition must be a string"))
+	}
+
+	if _, ok := c[keyCompareTo]; ok {
+		errs = append(errs, errors.New("field 'compare_to' of condition cannot be used with field 'anomaly'"))
+	}
+
+	for _, operator := range append(slices.Clone(strOrNumOperators),
+		operatorLessThan, operatorLessThanOrEqualTo, operatorGreaterThan, operatorGreaterThanOrEqualTo) {
+		if _, ok := c[operator]; ok {
+			errs = append(errs, xerrors.Errorf("operator '%s' cannot be used with field 'anomaly'", operator))
+		}
+	}
+
+	return errs
+}
+
+// defaultNumber sets the value of key to def if it is not set and
+// otherwise ensures it is a number in the range [lower, upper].
+func (c Condition) defaultNumber(key string, def, lower, upper float64) []error {
+	raw, ok := c[key]
+	if !ok {
+		c[key] = json.Number(strconv.FormatFloat(def, 'f', -1, 64))
+		return nil
+	}
+
+	v, ok := raw.(json.Number)
+	if !ok {
+		return []error{xerrors.Errorf("field '%s' of condition should be a number", key)}
+	}
+
+	f, err := v.Float64()
+	if err != nil || f < lower || f > upper {
+		return []error{xerrors.Errorf("field '%s' of condition is out of range", key)}
+	}
+	return nil
+}
+
+// UpdateHistory appends the current values of the fields of the
+// anomaly conditions to their histories, dropping the oldest values
+// once a history has more values than the condition keeps. It returns
+// the updated histories, which should be provided as Reference.History
+// when evaluating the next response.
+func UpdateHistory(
+	history map[string][]json.Number,
+	resp map[string]any,
+	conditions []Condition,
+) map[string][]json.Number {
+	limits := make(map[string]int)
+	for _, condition := range conditions {
+		if condition.anomaly() == "" {
+			continue
+		}
+		limits[condition.field()] = max(limits[condition.field()], condition.history())
+	}
+
+	updated := make(map[string][]json.Number, len(limits))
+	for field, limit := range limits {
+		values := slices.Clone(history[field])
+		if v, ok := firstNumber(jsonpath.GetAll(resp, field)); ok {
+			values = append(values, json.Number(v.String()))
+		}
+		if len(values) > limit {
+			values = values[len(values)-limit:]
+		}
+		if len(values) > 0 {
+			updated[field] = values
+		}
+	}
+
+	if len(updated) == 0 {
+		return nil
+	}
+	return updated
+}
+
+func anomalySatisfied(logger hclog.Logger, resp map[string]any, ref *Reference, condition Condition) bool {
+	current, ok := firstNumber(jsonpath.GetAll(resp, condition.field()))
+	if !ok {
+		logger.Debug("No numeric value found for anomaly condition", "field", condition.field())
+		return false
+	}
+	x := current.InexactFloat64()
+
+	var history []float64
+	if ref != nil {
+		for _, n := range ref.History[condition.field()] {
+			if f, err := n.Float64(); err == nil {
+				history = append(history, f)
+			}
+		}
+	}
+
+	if len(history) < int(condition.number(keyWarmup)) {
+		logger.Debug("Anomaly condition is warming up", "field", condition.field(),
+			"samples", len(history), "warmup", condition.number(keyWarmup))
+		return false
+	}
+
+	var lower, upper float64
+	switch condition.anomaly() {
+	case anomalyPercentile:
+		slices.Sort(history)
+		lower = percentile(history, condition.number(keyLower))
+		upper = percentile(history, condition.number(keyUpper))
+	default:
+		mean, stddev := meanStdDev(history)
+		lower = mean - condition.number(keyThreshold)*stddev
+		upper = mean + condition.number(keyThreshold)*stddev
+	}
+
+	switch condition[keyDirection] {
+	case directionAbove:
+		return x > upper
+	case directionBelow:
+		return x < lower
+	default:
+		return x > upper || x < lower
+	}
+}
+
+func meanStdDev(values []float64) (float64, float64) {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	mean := sum / float64(len(values))
+
+	var variance float64
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+// percentile returns the p-th percentile of the sorted values
+// using linear interpolation between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
@@ -0,0 +1,232 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+)
+
+func TestCondition_validateAnomaly(t *testing.T) {
+	cases := []struct {
+		name      string
+		condition Condition
+		expectErr string
+	}{
+		{
+			name:      "stddev-defaults",
+			condition: Condition{"field": "hits.total.value", "anomaly": "stddev"},
+		},
+		{
+			name: "percentile",
+			condition: Condition{
+				"field":     "hits.total.value",
+				"anomaly":   "percentile",
+				"lower":     json.Number("1"),
+				"upper":     json.Number("99"),
+				"history":   json.Number("50"),
+				"warmup":    json.Number("5"),
+				"direction": "above",
+			},
+		},
+		{
+			name:      "invalid-method",
+			condition: Condition{"field": "hits.total.value", "anomaly": "zscore"},
+			expectErr: "field 'anomaly' of condition must either be 'stddev' or 'percentile'",
+		},
+		{
+			name: "inverted-band",
+			condition: Condition{
+				"field":   "hits.total.value",
+				"anomaly": "percentile",
+				"lower":   json.Number("90"),
+				"upper":   json.Number("10"),
+			},
+			expectErr: "field 'lower' of condition must be less than field 'upper'",
+		},
+		{
+			name: "warmup-exceeds-history",
+			condition: Condition{
+				"field":   "hits.total.value",
+				"anomaly": "stddev",
+				"history": json.Number("5"),
+				"warmup":  json.Number("10"),
+			},
+			expectErr: "field 'warmup' of condition must not be greater than field 'history'",
+		},
+		{
+			name: "operator",
+			condition: Condition{
+				"field":   "hits.total.value",
+				"anomaly": "stddev",
+				"gt":      json.Number("10"),
+			},
+			expectErr: "operator 'gt' cannot be used with field 'anomaly'",
+		},
+		{
+			name: "bad-direction",
+			condition: Condition{
+				"field":     "hits.total.value",
+				"anomaly":   "stddev",
+				"direction": "sideways",
+			},
+			expectErr: "field 'direction' of condition must either be 'both', 'above', or 'below'",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.condition.validate()
+			if tc.expectErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+				t.Fatalf("Expected error to contain %q, got: %v", tc.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestConditionsMetAnomaly(t *testing.T) {
+	history := make([]json.Number, 0, 10)
+	for _, v := range []string{"98", "102", "100", "99", "101", "100", "97", "103", "100", "100"} {
+		history = append(history, json.Number(v))
+	}
+	ref := &Reference{History: map[string][]json.Number{"hits.total.value": history}}
+
+	resp := func(value string) map[string]any {
+		return map[string]any{
+			"hits": map[string]any{
+				"total": map[string]any{
+					"value": json.Number(value),
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name      string
+		resp      map[string]any
+		ref       *Reference
+		condition Condition
+		expectRes bool
+	}{
+		{
+			"stddev-spike",
+			resp("150"),
+			ref,
+			Condition{"field": "hits.total.value", "anomaly": "stddev"},
+			true,
+		},
+		{
+			"stddev-normal",
+			resp("101"),
+			ref,
+			Condition{"field": "hits.total.value", "anomaly": "stddev"},
+			false,
+		},
+		{
+			"stddev-drop-direction-above",
+			resp("10"),
+			ref,
+			Condition{"field": "hits.total.value", "anomaly": "stddev", "direction": "above"},
+			false,
+		},
+		{
+			"stddev-drop-direction-below",
+			resp("10"),
+			ref,
+			Condition{"field": "hits.total.value", "anomaly": "stddev", "direction": "below"},
+			true,
+		},
+		{
+			"percentile-outside-band",
+			resp("104"),
+			ref,
+			Condition{"field": "hits.total.value", "anomaly": "percentile"},
+			true,
+		},
+		{
+			"percentile-inside-band",
+			resp("100"),
+			ref,
+			Condition{"field": "hits.total.value", "anomaly": "percentile"},
+			false,
+		},
+		{
+			"warming-up",
+			resp("1000"),
+			ref,
+			Condition{"field": "hits.total.value", "anomaly": "stddev", "warmup": json.Number("20"), "history": json.Number("20")},
+			false,
+		},
+		{
+			"no-history",
+			resp("1000"),
+			nil,
+			Condition{"field": "hits.total.value", "anomaly": "stddev"},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.condition.validate(); err != nil {
+				t.Fatal(err)
+			}
+			got := ConditionsMetWithReference(hclog.NewNullLogger(), tc.resp, tc.ref, []Condition{tc.condition})
+			if got != tc.expectRes {
+				t.Errorf("Expected conditions to be met? %t\nWere conditions met? %t", tc.expectRes, got)
+			}
+		})
+	}
+}
+
+func TestUpdateHistory(t *testing.T) {
+	conditions := []Condition{
+		{"field": "hits.total.value", "anomaly": "stddev", "history": json.Number("3")},
+		{"field": "hits.total.value", "anomaly": "percentile", "history": json.Number("2")},
+		{"field": "hits.max_score", "anomaly": "stddev", "history": json.Number("3")},
+		{"field": "hits.total.value", "compare_to": "previous"},
+	}
+	resp := map[string]any{
+		"hits": map[string]any{
+			"total": map[string]any{
+				"value": json.Number("4"),
+			},
+		},
+	}
+
+	history := map[string][]json.Number{
+		"hits.total.value": {"1", "2", "3"},
+	}
+
+	got := UpdateHistory(history, resp, conditions)
+	if len(got) != 1 {
+		t.Fatalf("unexpected histories: %v", got)
+	}
+	values := got["hits.total.value"]
+	if len(values) != 3 || values[0] != "2" || values[2] != "4" {
+		t.Fatalf("unexpected history: %v", values)
+	}
+	if len(history["hits.total.value"]) != 3 || history["hits.total.value"][2] != "3" {
+		t.Fatalf("UpdateHistory modified the given history: %v", history)
+	}
+}
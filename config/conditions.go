@@ -28,6 +28,16 @@ import (
 const (
 	keyField      = "field"
 	keyQuantifier = "quantifier"
+	keyCompareTo  = "compare_to"
+	keyChange     = "change"
+	keyBuckets    = "buckets"
+
+	compareToPrevious = "previous"
+	compareToBaseline = "baseline"
+
+	changeDelta   = "delta"
+	changePercent = "percent"
+	changeRatio   = "ratio"
 
 	quantifierAny  = "any"
 	quantifierAll  = "all"
@@ -45,6 +55,21 @@ const (
 // when alerts are triggered.
 type Condition map[string]any
 
+// Reference holds the values against which comparison conditions
+// (i.e. conditions with a 'compare_to' field) are evaluated.
+type Reference struct {
+	// Previous maps the fields of comparison conditions to
+	// their values as of the previous run of the rule
+	Previous map[string]any
+
+	// Baseline is the response to the rule's baseline query
+	Baseline map[string]any
+
+	// History maps the fields of anomaly conditions to their
+	// values as of the most recent runs of the rule, oldest first
+	History map[string][]json.Number
+}
+
 func (c Condition) field() string {
 	return c[keyField].(string)
 }
@@ -53,6 +78,28 @@ func (c Condition) quantifier() string {
 	return c[keyQuantifier].(string)
 }
 
+func (c Condition) compareTo() string {
+	v, _ := c[keyCompareTo].(string)
+	return v
+}
+
+// Buckets returns the path of the buckets the condition is evaluated
+// against, or an empty string if it is evaluated against the response.
+func (c Condition) Buckets() string {
+	v, _ := c[keyBuckets].(string)
+	return v
+}
+
+func (c Condition) change() string {
+	return c[keyChange].(string)
+}
+
+// ComparesToBaseline returns true if the condition compares the
+// response with the response to the rule's baseline query.
+func (c Condition) ComparesToBaseline() bool {
+	return c.compareTo() == compareToBaseline
+}
+
 func (c Condition) validate() error {
 	var allErrors *multierror.Error
 
@@ -72,9 +119,77 @@ func (c Condition) validate() error {
 		allErrors = multierror.Append(allErrors, errs...)
 	}
 
+	if errs := c.validateComparison(); len(errs) != 0 {
+		allErrors = multierror.Append(allErrors, errs...)
+	}
+
+	if errs := c.validateAnomaly(); len(errs) != 0 {
+		allErrors = multierror.Append(allErrors, errs...)
+	}
+
+	if errs := c.validateBuckets(); len(errs) != 0 {
+		allErrors = multierror.Append(allErrors, errs...)
+	}
+
 	return allErrors.ErrorOrNil()
 }
 
+func (c Condition) validateComparison() []error {
+	raw, ok := c[keyCompareTo]
+	if !ok {
+		if _, ok := c[keyChange]; ok {
+			return []error{errors.New("field 'change' of condition requires the field 'compare_to'")}
+		}
+		return nil
+	}
+
+	var errs []error
+	if v, ok := raw.(string); !ok || (v != compareToPrevious && v != compareToBaseline) {
+		errs = append(errs, errors.New("field 'compare_to' of condition must either be 'previous' or 'baseline'"))
+	}
+
+	switch v := c[keyChange].(type) {
+	case nil:
+		c[keyChange] = changeDelta
+	case string:
+		if v != changeDelta && v != changePercent && v != changeRatio {
+			errs = append(errs, errors.New("field 'change' of condition must either be 'delta', 'percent', or 'ratio'"))
+		}
+	default:
+		errs = append(errs, errors.New("field 'change' of condition must be a string"))
+	}
+
+	for _, operator := range strOrNumOperators {
+		if _, ok := c[operator].(string); ok {
+			errs = append(errs, xerrors.Errorf("value of operator '%s' should be a number when using 'compare_to'", operator))
+		}
+	}
+
+	return errs
+}
+
+func (c Condition) validateBuckets() []error {
+	raw, ok := c[keyBuckets]
+	if !ok {
+		return nil
+	}
+
+	var errs []error
+	if v, ok := raw.(string); !ok || v == "" {
+		errs = append(errs, errors.New("field 'buckets' of condition must not be empty"))
+	}
+
+	if _, ok := c[keyCompareTo]; ok {
+		errs = append(errs, errors.New("field 'compare_to' of condition cannot be used with field 'buckets'"))
+	}
+
+	if _, ok := c[keyAnomaly]; ok {
+		errs = append(errs, errors.New("field 'anomaly' of condition cannot be used with field 'buckets'"))
+	}
+
+	return errs
+}
+
 func (c Condition) validateField() error {
 	raw, ok := c[keyField]
 	if !ok {
@@ -169,22 +284,46 @@ func assertOperator(raw any, operator string) error {
 }
 
 // ConditionsMet returns true if the response JSON meets the given conditions.
+// Comparison conditions are never met since there is nothing to compare to.
 func ConditionsMet(logger hclog.Logger, resp map[string]any, conditions []Condition) bool {
+	return ConditionsMetWithReference(logger, resp, nil, conditions)
+}
+
+// ConditionsMetWithReference returns true if the response JSON meets the
+// given conditions. Comparison conditions compare the value of their field
+// in the response with its value in ref and anomaly conditions compare it
+// with its history in ref. If ref has no such value (e.g. on the first run
+// of a rule) or the history is shorter than the condition's warm-up
+// period, the condition is not met.
+func ConditionsMetWithReference(
+	logger hclog.Logger,
+	resp map[string]any,
+	ref *Reference,
+	conditions []Condition,
+) bool {
 	for _, condition := range conditions {
-		matches := jsonpath.GetAll(resp, condition.field())
+		if condition.anomaly() != "" {
+			if !anomalySatisfied(logger, resp, ref, condition) {
+				return false
+			}
+			continue
+		}
 
-		res := false
+		if condition.compareTo() != "" {
+			if !comparisonSatisfied(logger, resp, ref, condition) {
+				return false
+			}
+			continue
+		}
 
-		switch condition.quantifier() {
-		case quantifierAll:
-			res = allSatisfied(logger, matches, condition)
-		case quantifierAny:
-			res = anySatisfied(logger, matches, condition)
-		case quantifierNone:
-			res = noneSatisfied(logger, matches, condition)
+		if condition.Buckets() != "" {
+			if len(bucketsSatisfying(logger, resp, condition.Buckets(), []Condition{condition})) == 0 {
+				return false
+			}
+			continue
 		}
 
-		if !res {
+		if !valueSatisfied(logger, resp, condition) {
 			return false
 		}
 	}
@@ -192,6 +331,94 @@ func ConditionsMet(logger hclog.Logger, resp map[string]any, conditions []Condit
 	return true
 }
 
+// MatchingBuckets evaluates the per-bucket conditions (i.e. conditions
+// with a 'buckets' field) against the buckets of the response. It returns
+// a map of the path of each set of buckets to the buckets satisfying all
+// of the conditions on that path. Paths with no satisfying buckets map
+// to an empty slice.
+func MatchingBuckets(logger hclog.Logger, resp map[string]any, conditions []Condition) map[string][]any {
+	return MatchingBucketsAny(logger, resp, [][]Condition{conditions})
+}
+
+// MatchingBucketsAny is like MatchingBuckets, except that the buckets
+// are evaluated against several sets of conditions (e.g. those of each
+// condition group that fired) and a bucket matches if it satisfies all
+// of the conditions on its path of any one of the sets. A set with no
+// conditions on a path is satisfied by all of its buckets.
+func MatchingBucketsAny(logger hclog.Logger, resp map[string]any, sets [][]Condition) map[string][]any {
+	byPath := make(map[string][][]Condition)
+	for i, conditions := range sets {
+		for _, condition := range conditions {
+			path := condition.Buckets()
+			if path == "" {
+				continue
+			}
+			if byPath[path] == nil {
+				byPath[path] = make([][]Condition, len(sets))
+			}
+			byPath[path][i] = append(byPath[path][i], condition)
+		}
+	}
+
+	if len(byPath) == 0 {
+		return nil
+	}
+
+	matching := make(map[string][]any, len(byPath))
+	for path, pathSets := range byPath {
+		matching[path] = make([]any, 0)
+		for _, bucket := range jsonpath.GetAll(resp, path) {
+			for _, conditions := range pathSets {
+				if bucketSatisfies(logger, bucket, conditions) {
+					matching[path] = append(matching[path], bucket)
+					break
+				}
+			}
+		}
+	}
+	return matching
+}
+
+func bucketsSatisfying(logger hclog.Logger, resp map[string]any, path string, conditions []Condition) []any {
+	buckets := make([]any, 0)
+	for _, elem := range jsonpath.GetAll(resp, path) {
+		if bucketSatisfies(logger, elem, conditions) {
+			buckets = append(buckets, elem)
+		}
+	}
+	return buckets
+}
+
+// bucketSatisfies returns true if elem is a bucket satisfying all of
+// the conditions.
+func bucketSatisfies(logger hclog.Logger, elem any, conditions []Condition) bool {
+	bucket, ok := elem.(map[string]any)
+	if !ok {
+		return false
+	}
+
+	for _, condition := range conditions {
+		if !valueSatisfied(logger, bucket, condition) {
+			return false
+		}
+	}
+	return true
+}
+
+func valueSatisfied(logger hclog.Logger, resp map[string]any, condition Condition) bool {
+	matches := jsonpath.GetAll(resp, condition.field())
+
+	switch condition.quantifier() {
+	case quantifierAll:
+		return allSatisfied(logger, matches, condition)
+	case quantifierAny:
+		return anySatisfied(logger, matches, condition)
+	case quantifierNone:
+		return noneSatisfied(logger, matches, condition)
+	}
+	return false
+}
+
 func allSatisfied(logger hclog.Logger, matches []any, condition Condition) bool {
 	for _, match := range matches {
 		sat := satisfied(logger, match, condition)
@@ -312,3 +539,81 @@ func boolSatisfied(b bool, condition Condition) bool {
 
 	return sat
 }
+
+// ComparisonValues returns the values of the fields of the conditions
+// that compare to the previous run, keyed by field. These should be
+// provided as Reference.Previous when evaluating the next response.
+func ComparisonValues(resp map[string]any, conditions []Condition) map[string]any {
+	var values map[string]any
+	for _, condition := range conditions {
+		if condition.compareTo() != compareToPrevious {
+			continue
+		}
+		v, ok := firstNumber(jsonpath.GetAll(resp, condition.field()))
+		if !ok {
+			continue
+		}
+		if values == nil {
+			values = make(map[string]any)
+		}
+		values[condition.field()] = json.Number(v.String())
+	}
+	return values
+}
+
+func comparisonSatisfied(logger hclog.Logger, resp map[string]any, ref *Reference, condition Condition) bool {
+	current, ok := firstNumber(jsonpath.GetAll(resp, condition.field()))
+	if !ok {
+		logger.Debug("No numeric value found for comparison condition", "field", condition.field())
+		return false
+	}
+
+	var reference decimal.Decimal
+	switch {
+	case ref == nil:
+		ok = false
+	case condition.compareTo() == compareToPrevious:
+		reference, ok = firstNumber([]any{ref.Previous[condition.field()]})
+	default:
+		reference, ok = firstNumber(jsonpath.GetAll(ref.Baseline, condition.field()))
+	}
+	if !ok {
+		logger.Debug("No reference value found for comparison condition",
+			"field", condition.field(), "compare_to", condition.compareTo())
+		return false
+	}
+
+	var change decimal.Decimal
+	switch condition.change() {
+	case changePercent:
+		if reference.IsZero() {
+			return false
+		}
+		change = current.Sub(reference).Div(reference.Abs()).Mul(decimal.NewFromInt(100))
+	case changeRatio:
+		if reference.IsZero() {
+			return false
+		}
+		change = current.Div(reference)
+	default:
+		change = current.Sub(reference)
+	}
+
+	return numberSatisfied(json.Number(change.String()), condition)
+}
+
+// firstNumber returns the first of the values that is a number.
+func firstNumber(values []any) (decimal.Decimal, bool) {
+	for _, v := range values {
+		n, ok := v.(json.Number)
+		if !ok {
+			continue
+		}
+		d, err := decimal.NewFromString(n.String())
+		if err != nil {
+			continue
+		}
+		return d, true
+	}
+	return decimal.Decimal{}, false
+}
@@ -121,6 +121,64 @@ func TestCondition_validate(t *testing.T) {
 	* value of operator 'eq' should either be a number or a string
 	* value of operator 'ne' should either be a number or a string
 
+`,
+		},
+		{
+			name: "success-comparison",
+			condition: Condition{
+				"field":      "hits.total.value",
+				"compare_to": "baseline",
+				"change":     "ratio",
+				"ge":         json.Number("3"),
+			},
+			expectErr: "",
+		},
+		{
+			name: "comparison-errors",
+			condition: Condition{
+				"field":      "hits.total.value",
+				"quantifier": "any",
+				"compare_to": "yesterday",
+				"change":     "double",
+				"eq":         "foo",
+			},
+			expectErr: `3 errors occurred:
+	* field 'compare_to' of condition must either be 'previous' or 'baseline'
+	* field 'change' of condition must either be 'delta', 'percent', or 'ratio'
+	* value of operator 'eq' should be a number when using 'compare_to'
+
+`,
+		},
+		{
+			name: "change-without-compare-to",
+			condition: Condition{
+				"field":      "hits.total.value",
+				"quantifier": "any",
+				"change":     "ratio",
+			},
+			expectErr: "1 error occurred:\n\t* field 'change' of condition requires the field 'compare_to'\n\n",
+		},
+		{
+			name: "success-buckets",
+			condition: Condition{
+				"buckets": "aggregations.hosts.buckets",
+				"field":   "doc_count",
+				"gt":      json.Number("20"),
+			},
+			expectErr: "",
+		},
+		{
+			name: "buckets-errors",
+			condition: Condition{
+				"buckets":    "",
+				"field":      "doc_count",
+				"compare_to": "previous",
+				"gt":         json.Number("20"),
+			},
+			expectErr: `2 errors occurred:
+	* field 'buckets' of condition must not be empty
+	* field 'compare_to' of condition cannot be used with field 'buckets'
+
 `,
 		},
 	}
@@ -377,3 +435,184 @@ func TestConditionsMet(t *testing.T) {
 		})
 	}
 }
+
+func TestConditionsMetWithReference(t *testing.T) {
+	resp := map[string]any{
+		"hits": map[string]any{
+			"total": map[string]any{
+				"value": json.Number("300"),
+			},
+		},
+	}
+	ref := &Reference{
+		Previous: map[string]any{
+			"hits.total.value": json.Number("200"),
+		},
+		Baseline: map[string]any{
+			"hits": map[string]any{
+				"total": map[string]any{
+					"value": json.Number("100"),
+				},
+			},
+		},
+	}
+
+	cases := []struct {
+		name      string
+		ref       *Reference
+		condition Condition
+		expectRes bool
+	}{
+		{
+			"previous-delta-met",
+			ref,
+			Condition{"field": "hits.total.value", "compare_to": "previous", "change": "delta", "ge": json.Number("100")},
+			true,
+		},
+		{
+			"previous-delta-not-met",
+			ref,
+			Condition{"field": "hits.total.value", "compare_to": "previous", "change": "delta", "gt": json.Number("100")},
+			false,
+		},
+		{
+			"previous-percent-met",
+			ref,
+			Condition{"field": "hits.total.value", "compare_to": "previous", "change": "percent", "eq": json.Number("50")},
+			true,
+		},
+		{
+			"baseline-ratio-met",
+			ref,
+			Condition{"field": "hits.total.value", "compare_to": "baseline", "change": "ratio", "ge": json.Number("3")},
+			true,
+		},
+		{
+			"baseline-ratio-not-met",
+			ref,
+			Condition{"field": "hits.total.value", "compare_to": "baseline", "change": "ratio", "gt": json.Number("3")},
+			false,
+		},
+		{
+			"no-reference",
+			nil,
+			Condition{"field": "hits.total.value", "compare_to": "previous", "change": "delta", "ge": json.Number("0")},
+			false,
+		},
+		{
+			"zero-reference",
+			&Reference{Previous: map[string]any{"hits.total.value": json.Number("0")}},
+			Condition{"field": "hits.total.value", "compare_to": "previous", "change": "percent", "ge": json.Number("0")},
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.condition.validate(); err != nil {
+				t.Fatal(err)
+			}
+			got := ConditionsMetWithReference(hclog.NewNullLogger(), resp, tc.ref, []Condition{tc.condition})
+			if got != tc.expectRes {
+				t.Errorf("Expected conditions to be met? %t\nWere conditions met? %t", tc.expectRes, got)
+			}
+		})
+	}
+}
+
+func TestComparisonValues(t *testing.T) {
+	resp := map[string]any{
+		"hits": map[string]any{
+			"total": map[string]any{
+				"value": json.Number("300"),
+			},
+		},
+	}
+	conditions := []Condition{
+		{"field": "hits.total.value", "compare_to": "previous"},
+		{"field": "hits.max_score", "compare_to": "previous"},
+		{"field": "aggregations.errors.value", "compare_to": "baseline"},
+		{"field": "hits.total.relation", "eq": "eq"},
+	}
+
+	got := ComparisonValues(resp, conditions)
+	if len(got) != 1 || got["hits.total.value"] != json.Number("300") {
+		t.Fatalf("unexpected comparison values: %v", got)
+	}
+}
+
+func TestMatchingBuckets(t *testing.T) {
+	resp := map[string]any{
+		"aggregations": map[string]any{
+			"hosts": map[string]any{
+				"buckets": []any{
+					map[string]any{"key": "foo", "doc_count": json.Number("10")},
+					map[string]any{"key": "bar", "doc_count": json.Number("25")},
+					map[string]any{"key": "baz", "doc_count": json.Number("30")},
+				},
+			},
+			"services": map[string]any{
+				"buckets": []any{
+					map[string]any{"key": "api", "doc_count": json.Number("5")},
+				},
+			},
+		},
+	}
+	conditions := []Condition{
+		{"buckets": "aggregations.hosts.buckets", "field": "doc_count", "quantifier": "any", "gt": json.Number("20")},
+		{"buckets": "aggregations.hosts.buckets", "field": "key", "quantifier": "any", "ne": "baz"},
+		{"buckets": "aggregations.services.buckets", "field": "doc_count", "quantifier": "any", "gt": json.Number("20")},
+		{"field": "hits.total.value", "quantifier": "any", "gt": json.Number("0")},
+	}
+
+	got := MatchingBuckets(hclog.NewNullLogger(), resp, conditions)
+	if len(got) != 2 {
+		t.Fatalf("unexpected bucket paths: %v", got)
+	}
+
+	hosts := got["aggregations.hosts.buckets"]
+	if len(hosts) != 1 || hosts[0].(map[string]any)["key"] != "bar" {
+		t.Errorf("unexpected matching hosts: %v", hosts)
+	}
+
+	if services := got["aggregations.services.buckets"]; len(services) != 0 {
+		t.Errorf("unexpected matching services: %v", services)
+	}
+
+	if !ConditionsMet(hclog.NewNullLogger(), resp, conditions[:2]) {
+		t.Error("Expected per-bucket conditions to be met")
+	}
+	if ConditionsMet(hclog.NewNullLogger(), resp, conditions[2:3]) {
+		t.Error("Expected per-bucket conditions not to be met")
+	}
+}
+
+func TestMatchingBucketsAny(t *testing.T) {
+	resp := map[string]any{
+		"aggregations": map[string]any{
+			"hosts": map[string]any{
+				"buckets": []any{
+					map[string]any{"key": "foo", "doc_count": json.Number("10")},
+					map[string]any{"key": "bar", "doc_count": json.Number("25")},
+					map[string]any{"key": "baz", "doc_count": json.Number("30")},
+				},
+			},
+		},
+	}
+	sets := [][]Condition{
+		{{"buckets": "aggregations.hosts.buckets", "field": "doc_count", "quantifier": "any", "gt": json.Number("28")}},
+		{{"buckets": "aggregations.hosts.buckets", "field": "key", "quantifier": "any", "eq": "foo"}},
+	}
+
+	got := MatchingBucketsAny(hclog.NewNullLogger(), resp, sets)
+	hosts := got["aggregations.hosts.buckets"]
+	if len(hosts) != 2 || hosts[0].(map[string]any)["key"] != "foo" || hosts[1].(map[string]any)["key"] != "baz" {
+		t.Errorf("unexpected matching hosts: %v", hosts)
+	}
+
+	// A set without conditions on the path is satisfied by all of its buckets
+	got = MatchingBucketsAny(hclog.NewNullLogger(), resp, append(sets, nil))
+	if hosts = got["aggregations.hosts.buckets"]; len(hosts) != 3 {
+		t.Errorf("unexpected matching hosts: %v", hosts)
+	}
+}
@@ -18,8 +18,13 @@ import (
 	"cmp"
 	"encoding/json"
 	"errors"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"golang.org/x/xerrors"
@@ -32,6 +37,42 @@ const (
 	defaultRulesDir   string = "/etc/go-elasticsearch-alerts/rules"
 )
 
+const (
+	// PartialResultsIgnore processes partial responses as if
+	// they were complete
+	PartialResultsIgnore = "ignore"
+
+	// PartialResultsWarn logs a warning and sends an alert to the
+	// rule's shard failure outputs before processing partial
+	// responses
+	PartialResultsWarn = "warn"
+
+	// PartialResultsFail treats partial responses as errors
+	PartialResultsFail = "fail"
+)
+
+const (
+	// QueryTypeSearch executes the rule's query with the _search API
+	QueryTypeSearch = "search"
+
+	// QueryTypeCount executes the rule's query with the _count API
+	QueryTypeCount = "count"
+
+	// QueryTypeMSearch executes the rule's named searches with the
+	// _msearch API
+	QueryTypeMSearch = "msearch"
+
+	// QueryTypeSQL executes the rule's SQL statement with the _sql API
+	QueryTypeSQL = "sql"
+
+	// QueryTypeESQL executes the rule's ES|QL statement with the
+	// _query API
+	QueryTypeESQL = "esql"
+
+	// QueryTypeEQL executes the rule's query with the EQL search API
+	QueryTypeEQL = "eql"
+)
+
 // OutputConfig maps to each element of 'output' field of
 // a rule configuration file.
 type OutputConfig struct {
@@ -45,6 +86,25 @@ type OutputConfig struct {
 	// Please refer to the README for more detailed information
 	// on this field
 	Config map[string]any `json:"config"`
+
+	// Route limits which alerts are sent to this output. If
+	// nil, every alert generated by the rule is sent to this
+	// output
+	Route *RouteConfig `json:"route"`
+
+	// Retry configures how alerts that could not be sent to this
+	// output are retried. If nil, they are retried per the
+	// default policy
+	Retry *RetryConfig `json:"retry"`
+
+	// RateLimit limits how many alerts are sent to this output.
+	// If nil, there is no limit
+	RateLimit *RateLimitConfig `json:"rate_limit"`
+
+	// Group batches the alerts sent to this output so that alerts
+	// from several rules are sent together. If nil, each alert is
+	// sent on its own
+	Group *GroupConfig `json:"group"`
 }
 
 func (o OutputConfig) validate() error {
@@ -54,6 +114,250 @@ func (o OutputConfig) validate() error {
 	if len(o.Config) < 1 {
 		return errors.New("all outputs must have a config field ('output.config')")
 	}
+	if o.Retry != nil {
+		if err := o.Retry.validate(); err != nil {
+			return err
+		}
+	}
+	if o.RateLimit != nil {
+		if err := o.RateLimit.validate(); err != nil {
+			return err
+		}
+	}
+	if o.Group != nil {
+		return o.Group.validate()
+	}
+	return nil
+}
+
+const defaultGroupWait = 30 * time.Second
+
+// GroupConfig maps to the 'group' field of an output.
+type GroupConfig struct {
+	// By are the labels whose values the alerts sent together
+	// have in common. If empty, all alerts sent to the output
+	// during the wait are sent together
+	By []string `json:"by"`
+
+	// WaitRaw is how long to wait for more alerts after the
+	// first alert of a group, as a Go duration string. It
+	// defaults to "30s"
+	WaitRaw string `json:"wait"`
+
+	// Wait is the parsed value of WaitRaw
+	Wait time.Duration `json:"-"`
+}
+
+func (g *GroupConfig) validate() error {
+	for _, label := range g.By {
+		if label == "" {
+			return errors.New("field 'group.by' must not contain empty labels")
+		}
+	}
+
+	var err error
+	g.Wait, err = parseDuration("group.wait", g.WaitRaw, defaultGroupWait)
+	return err
+}
+
+const defaultRateLimitPeriod = time.Minute
+
+// RateLimitConfig maps to the 'rate_limit' field of an output.
+// Alerts beyond the limit are combined into a single digest.
+type RateLimitConfig struct {
+	// Limit is the number of alerts that may be sent to the
+	// output per Period
+	Limit int `json:"limit"`
+
+	// PeriodRaw is the period over which Limit alerts may be
+	// sent, as a Go duration string. It defaults to "1m"
+	PeriodRaw string `json:"period"`
+
+	// Period is the parsed value of PeriodRaw
+	Period time.Duration `json:"-"`
+
+	// Burst is the number of alerts that may be sent at once
+	// after a quiet spell. It defaults to Limit
+	Burst int `json:"burst"`
+}
+
+func (r *RateLimitConfig) validate() error {
+	if r.Limit < 1 {
+		return errors.New("field 'rate_limit.limit' must be a positive integer")
+	}
+	if r.Burst < 0 {
+		return errors.New("field 'rate_limit.burst' must not be negative")
+	}
+	r.Burst = cmp.Or(r.Burst, r.Limit)
+
+	var err error
+	r.Period, err = parseDuration("rate_limit.period", r.PeriodRaw, defaultRateLimitPeriod)
+	return err
+}
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 2 * time.Second
+	defaultRetryMaxBackoff     = time.Minute
+	defaultRetryMultiplier     = 1.0
+	defaultRetryJitter         = 0.5
+)
+
+// RetryConfig maps to the 'retry' field of an output.
+type RetryConfig struct {
+	// MaxAttempts is the largest number of times an alert is
+	// sent to the output. It defaults to 3
+	MaxAttempts int `json:"max_attempts"`
+
+	// InitialBackoffRaw is how long to wait after the first
+	// failed attempt, as a Go duration string. It defaults to
+	// "2s"
+	InitialBackoffRaw string `json:"initial_backoff"`
+
+	// InitialBackoff is the parsed value of InitialBackoffRaw
+	InitialBackoff time.Duration `json:"-"`
+
+	// MaxBackoffRaw is the longest to wait between attempts, as
+	// a Go duration string. It defaults to "1m"
+	MaxBackoffRaw string `json:"max_backoff"`
+
+	// MaxBackoff is the parsed value of MaxBackoffRaw
+	MaxBackoff time.Duration `json:"-"`
+
+	// Multiplier is by how much the backoff grows after each
+	// failed attempt. It defaults to 1 (i.e. constant backoff)
+	Multiplier float64 `json:"multiplier"`
+
+	// Jitter is the fraction of the backoff that is randomly
+	// added to or subtracted from it. It defaults to 0.5
+	Jitter *float64 `json:"jitter"`
+
+	// DeadlineRaw is how long after the first attempt no further
+	// attempts are made, as a Go duration string. If empty, there
+	// is no deadline
+	DeadlineRaw string `json:"deadline"`
+
+	// Deadline is the parsed value of DeadlineRaw
+	Deadline time.Duration `json:"-"`
+}
+
+func (r *RetryConfig) validate() error {
+	if r.MaxAttempts < 0 {
+		return errors.New("field 'retry.max_attempts' must not be negative")
+	}
+	r.MaxAttempts = cmp.Or(r.MaxAttempts, defaultRetryMaxAttempts)
+
+	if r.Multiplier < 0 || (r.Multiplier > 0 && r.Multiplier < 1) {
+		return xerrors.Errorf("field 'retry.multiplier' must be at least 1, got %v", r.Multiplier)
+	}
+	r.Multiplier = cmp.Or(r.Multiplier, defaultRetryMultiplier)
+
+	if r.Jitter == nil {
+		jitter := defaultRetryJitter
+		r.Jitter = &jitter
+	}
+	if *r.Jitter < 0 || *r.Jitter > 1 {
+		return xerrors.Errorf("field 'retry.jitter' must be between 0 and 1, got %v", *r.Jitter)
+	}
+
+	var err error
+	r.InitialBackoff, err = parseDuration("retry.initial_backoff", r.InitialBackoffRaw, defaultRetryInitialBackoff)
+	if err != nil {
+		return err
+	}
+	r.MaxBackoff, err = parseDuration("retry.max_backoff", r.MaxBackoffRaw, defaultRetryMaxBackoff)
+	if err != nil {
+		return err
+	}
+	if r.MaxBackoff < r.InitialBackoff {
+		return errors.New("field 'retry.max_backoff' must not be less than 'retry.initial_backoff'")
+	}
+	if r.Deadline, err = parseDuration("retry.deadline", r.DeadlineRaw, 0); err != nil {
+		return err
+	}
+	return nil
+}
+
+func parseDuration(field, raw string, def time.Duration) (time.Duration, error) {
+	if raw == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(raw)
+	if err != nil || d <= 0 {
+		return 0, xerrors.Errorf("field '%s' must be a positive duration (e.g. '30s'), got %q", field, raw)
+	}
+	return d, nil
+}
+
+// RouteConfig maps to the 'route' field of an output. An alert
+// is sent to the output only if it matches every non-empty
+// field of the route.
+type RouteConfig struct {
+	// Severities are the alert severities that match this
+	// route (e.g. ["critical"])
+	Severities []string `json:"severity"`
+
+	// Labels are the labels that an alert must have, with
+	// the same values, to match this route
+	Labels map[string]string `json:"labels"`
+
+	// ConditionGroups are the names of the condition groups
+	// of which at least one must have fired for an alert to
+	// match this route
+	ConditionGroups []string `json:"condition_groups"`
+}
+
+// ConditionGroup maps to each element of the 'condition_groups'
+// field of a rule configuration file. A group fires when all of
+// its conditions are met.
+type ConditionGroup struct {
+	// Name identifies the group in output routes
+	Name string `json:"name"`
+
+	// Conditions must all be met for the group to fire
+	Conditions []Condition `json:"conditions"`
+}
+
+// ConditionLevel maps to each element of the 'levels' field of a
+// rule configuration file. A level matches when all of its
+// conditions are met.
+type ConditionLevel struct {
+	// Severity is attached to alerts when this is the highest
+	// level that matched (e.g. "warning" or "critical")
+	Severity string `json:"severity"`
+
+	// Conditions must all be met for the level to match
+	Conditions []Condition `json:"conditions"`
+}
+
+func (l ConditionLevel) validate() error {
+	if l.Severity == "" {
+		return errors.New("all levels must have a severity ('levels.severity')")
+	}
+	if len(l.Conditions) < 1 {
+		return xerrors.Errorf("level %q must have at least one condition", l.Severity)
+	}
+	for i, condition := range l.Conditions {
+		if err := condition.validate(); err != nil {
+			return xerrors.Errorf("error in condition %d of level %q: %v", i+1, l.Severity, err)
+		}
+	}
+	return nil
+}
+
+func (g ConditionGroup) validate() error {
+	if g.Name == "" {
+		return errors.New("all condition groups must have a name ('condition_groups.name')")
+	}
+	if len(g.Conditions) < 1 {
+		return xerrors.Errorf("condition group %q must have at least one condition", g.Name)
+	}
+	for i, condition := range g.Conditions {
+		if err := condition.validate(); err != nil {
+			return xerrors.Errorf("error in condition %d of condition group %q: %v", i+1, g.Name, err)
+		}
+	}
 	return nil
 }
 
@@ -80,6 +384,99 @@ type RuleConfig struct {
 	// from the 'name' field of the rule configuration file
 	Name string `json:"name"`
 
+	// Namespace groups rules by the team that owns them. This
+	// value comes from the 'namespace' field of the rule
+	// configuration file if set; otherwise, it is the path of
+	// the directory containing the rule file relative to the
+	// rules directory in which it was found (e.g. "team-a/web").
+	// Rules at the top level of a rules directory have no
+	// namespace
+	Namespace string `json:"namespace"`
+
+	// Enabled is whether the rule should be run. Disabled rules
+	// are validated but not loaded. This value should come from
+	// the 'enabled' field of the rule configuration file and
+	// defaults to true
+	Enabled *bool `json:"enabled"`
+
+	// Description is a human-readable explanation of what the
+	// rule detects. This value should come from the 'description'
+	// field of the rule configuration file
+	Description string `json:"description"`
+
+	// Owner is the person or team responsible for responding
+	// to alerts generated by this rule. This value should come
+	// from the 'owner' field of the rule configuration file
+	Owner string `json:"owner"`
+
+	// RunbookURL is a link to instructions on how to respond to
+	// alerts generated by this rule. This value should come from
+	// the 'runbook_url' field of the rule configuration file
+	RunbookURL string `json:"runbook_url"`
+
+	// Severity is how urgent alerts generated by this rule are
+	// (e.g. "warning" or "critical"). This value should come from
+	// the 'severity' field of the rule configuration file
+	Severity string `json:"severity"`
+
+	// Labels are free-form key/value pairs attached to every
+	// alert generated by this rule. This value should come from
+	// the 'labels' field of the rule configuration file
+	Labels map[string]string `json:"labels"`
+
+	// QueryType is how the rule queries Elasticsearch: "search"
+	// (the default), "count", "msearch", "sql", "esql" or "eql". This value should come
+	// from the 'query_type' field of the rule configuration file
+	QueryType string `json:"query_type"`
+
+	// Searches are the named searches executed in a single request
+	// when QueryType is "msearch". This value should come from the
+	// 'searches' field of the rule configuration file
+	Searches []SearchConfig `json:"searches"`
+
+	// CollectAll makes the rule page through every hit matching its
+	// query rather than only those in a single response. This value
+	// should come from the 'collect_all' field of the rule
+	// configuration file
+	CollectAll *CollectAllConfig `json:"collect_all"`
+
+	// TimeoutRaw is how long the rule's query may take, as a Go
+	// duration (e.g. "30s"). It is sent to Elasticsearch and also
+	// enforced by the client. This value should come from the
+	// 'timeout' field of the rule configuration file
+	TimeoutRaw string `json:"timeout"`
+
+	// Timeout is the parsed value of TimeoutRaw
+	Timeout time.Duration `json:"-"`
+
+	// PartialResults is what to do when the response to the rule's
+	// query is partial because the query timed out or some shards
+	// failed: "ignore", "warn" (the default) or "fail". This value
+	// should come from the 'partial_results' field of the rule
+	// configuration file
+	PartialResults string `json:"partial_results"`
+
+	// ShardFailureOutputs are the methods by which alerts about
+	// partial responses should be sent. This value should come
+	// from the 'shard_failure_outputs' field of the rule
+	// configuration file
+	ShardFailureOutputs []OutputConfig `json:"shard_failure_outputs"`
+
+	// Dedup makes the rule exclude hits it has already alerted on
+	// from the body field. This value should come from the 'dedup'
+	// field of the rule configuration file
+	Dedup *DedupConfig `json:"dedup"`
+
+	// SQL is an Elasticsearch SQL statement executed instead of
+	// the query in 'body'. This value should come from the 'sql'
+	// field of the rule configuration file
+	SQL string `json:"sql"`
+
+	// ESQL is an ES|QL statement executed instead of the query
+	// in 'body'. This value should come from the 'esql' field
+	// of the rule configuration file
+	ESQL string `json:"esql"`
+
 	// ElasticsearchIndex is the index that this rule should
 	// query. This value should come from the 'index' field
 	// of the rule configuration file
@@ -119,6 +516,342 @@ type RuleConfig struct {
 	// Conditions are optional parameters that can be used to
 	// limit when alerts are triggered
 	Conditions []Condition
+
+	// ConditionGroups are optional named sets of conditions. If
+	// any are defined, alerts are only triggered when at least
+	// one group fires. Outputs may be routed by which groups
+	// fired. This value should come from the 'condition_groups'
+	// field of the rule configuration file
+	ConditionGroups []ConditionGroup `json:"condition_groups"`
+
+	// ConditionLevels are optional sets of conditions ordered from
+	// least to most severe. If any are defined, alerts are only
+	// triggered when at least one level matches and take the
+	// severity of the highest level that matched. This value
+	// should come from the 'levels' field of the rule
+	// configuration file
+	ConditionLevels []ConditionLevel `json:"levels"`
+
+	// Baseline configures the query whose response conditions
+	// with 'compare_to' set to 'baseline' compare against. This
+	// value should come from the 'baseline' field of the rule
+	// configuration file
+	Baseline *BaselineConfig `json:"baseline"`
+
+	// NoData makes the rule also alert when its query returns no
+	// data for a number of consecutive runs. This value should
+	// come from the 'no_data' field of the rule configuration file
+	NoData *NoDataConfig `json:"no_data"`
+
+	// ConsecutiveRuns is the number of consecutive runs on which
+	// the rule's conditions must hold before an alert is sent.
+	// This value should come from the 'consecutive_runs' field
+	// of the rule configuration file
+	ConsecutiveRuns int `json:"consecutive_runs"`
+
+	// ForRaw is how long the rule's conditions must have held
+	// before an alert is sent, as a Go duration (e.g. "15m").
+	// This value should come from the 'for' field of the rule
+	// configuration file
+	ForRaw string `json:"for"`
+
+	// For is the parsed value of ForRaw
+	For time.Duration `json:"-"`
+}
+
+// NoDataConfig maps to the 'no_data' field of a rule
+// configuration file.
+type NoDataConfig struct {
+	// Field is the field of the response that is expected to be
+	// present. If it is empty, the response is instead expected
+	// to have at least one hit
+	Field string `json:"field"`
+
+	// ConsecutiveRuns is the number of consecutive runs without
+	// data after which an alert is sent. It defaults to 1
+	ConsecutiveRuns int `json:"consecutive_runs"`
+}
+
+func (n *NoDataConfig) validate() error {
+	if n.ConsecutiveRuns < 0 {
+		return errors.New("field 'no_data.consecutive_runs' must not be negative")
+	}
+	if n.ConsecutiveRuns == 0 {
+		n.ConsecutiveRuns = 1
+	}
+	return nil
+}
+
+// CollectAllConfig maps to the 'collect_all' field of a rule
+// configuration file.
+type CollectAllConfig struct {
+	// MaxHits is the maximum number of hits collected. It
+	// defaults to 10000
+	MaxHits int `json:"max_hits"`
+
+	// PageSize is the number of hits requested per page. It
+	// defaults to 1000
+	PageSize int `json:"page_size"`
+
+	// KeepAlive is how long Elasticsearch should keep the point
+	// in time open between pages, as an Elasticsearch time unit.
+	// It defaults to "1m"
+	KeepAlive string `json:"keep_alive"`
+
+	// SummaryHits is the number of hits included in outputs that
+	// only get a summary of the collected hits (e.g. Slack). It
+	// defaults to 10
+	SummaryHits int `json:"summary_hits"`
+}
+
+const (
+	defaultCollectMaxHits     = 10000
+	defaultCollectPageSize    = 1000
+	defaultCollectKeepAlive   = "1m"
+	defaultCollectSummaryHits = 10
+)
+
+func (c *CollectAllConfig) validate() error {
+	if c.MaxHits < 0 || c.PageSize < 0 || c.SummaryHits < 0 {
+		return errors.New("fields 'collect_all.max_hits', 'collect_all.page_size' and 'collect_all.summary_hits' " +
+			"must not be negative")
+	}
+	if c.KeepAlive != "" && !offsetRegexp.MatchString(c.KeepAlive) {
+		return xerrors.Errorf("field 'collect_all.keep_alive' must be an Elasticsearch time unit (e.g. '1m'), got %q",
+			c.KeepAlive)
+	}
+
+	c.MaxHits = cmp.Or(c.MaxHits, defaultCollectMaxHits)
+	c.PageSize = cmp.Or(c.PageSize, defaultCollectPageSize)
+	c.KeepAlive = cmp.Or(c.KeepAlive, defaultCollectKeepAlive)
+	c.SummaryHits = cmp.Or(c.SummaryHits, defaultCollectSummaryHits)
+	return nil
+}
+
+// DedupConfig maps to the 'dedup' field of a rule configuration
+// file.
+type DedupConfig struct {
+	// Key is the field identifying a hit. If the rule's body field
+	// ends with '._source', it is relative to the hit (e.g. "_id"
+	// or "_source.event.id"); otherwise it is relative to the
+	// elements of the body field. It defaults to "_id"
+	Key string `json:"key"`
+
+	// TTLRaw is how long a hit is remembered after it was alerted
+	// on, as a Go duration (e.g. "24h"). It defaults to "24h"
+	TTLRaw string `json:"ttl"`
+
+	// TTL is the parsed value of TTLRaw
+	TTL time.Duration `json:"-"`
+
+	// MaxKeys is the maximum number of hits remembered. Once it is
+	// reached, the hits alerted on longest ago are forgotten first.
+	// It defaults to 10000
+	MaxKeys int `json:"max_keys"`
+}
+
+const (
+	defaultDedupKey     = "_id"
+	defaultDedupTTL     = 24 * time.Hour
+	defaultDedupMaxKeys = 10000
+)
+
+func (d *DedupConfig) validate() error {
+	d.Key = cmp.Or(d.Key, defaultDedupKey)
+	if d.MaxKeys < 0 {
+		return xerrors.New("field 'dedup.max_keys' must not be negative")
+	}
+	d.MaxKeys = cmp.Or(d.MaxKeys, defaultDedupMaxKeys)
+	if d.TTLRaw == "" {
+		d.TTL = defaultDedupTTL
+		return nil
+	}
+
+	ttl, err := time.ParseDuration(d.TTLRaw)
+	if err != nil || ttl <= 0 {
+		return xerrors.Errorf("field 'dedup.ttl' must be a positive duration (e.g. '24h'), got %q", d.TTLRaw)
+	}
+	d.TTL = ttl
+	return nil
+}
+
+// SearchConfig maps to an element of the 'searches' field of a
+// rule configuration file.
+type SearchConfig struct {
+	// Name identifies the search. Its response is available to
+	// conditions and filters under 'responses.<name>'
+	Name string `json:"name"`
+
+	// Index is the index that the search should query. It
+	// defaults to the rule's index
+	Index string `json:"index"`
+
+	// BodyRaw is the untyped search. This value should come
+	// from the 'body' field of the search
+	BodyRaw any `json:"body"`
+
+	// Body is the typed search
+	Body map[string]any `json:"-"`
+}
+
+// BaselineConfig maps to the 'baseline' field of a rule
+// configuration file.
+type BaselineConfig struct {
+	// Offset is how far in the past the baseline query looks
+	// relative to the rule's query, as an Elasticsearch time
+	// unit (e.g. "1d"). If BodyRaw is not set, the baseline query
+	// is the rule's query with every date math expression
+	// relative to "now" shifted back by this offset
+	Offset string `json:"offset"`
+
+	// Index is the index that the baseline query should query.
+	// It defaults to the rule's index
+	Index string `json:"index"`
+
+	// BodyRaw is the untyped baseline query. This value should
+	// come from the 'baseline.body' field of the rule
+	// configuration file
+	BodyRaw any `json:"body"`
+
+	// Body is the typed baseline query
+	Body map[string]any `json:"-"`
+}
+
+var offsetRegexp = regexp.MustCompile(`^[0-9]+[yMwdhHms]$`)
+
+func (b *BaselineConfig) validate() error {
+	if b.Offset == "" && b.BodyRaw == nil {
+		return errors.New("field 'baseline' must have either an 'offset' or a 'body'")
+	}
+	if b.Offset != "" && !offsetRegexp.MatchString(b.Offset) {
+		return xerrors.Errorf("field 'baseline.offset' must be an Elasticsearch time unit (e.g. '1d'), got %q", b.Offset)
+	}
+	return nil
+}
+
+func (rule *RuleConfig) validateQueryType() error { //nolint:gocyclo,gocognit
+	switch {
+	case rule.SQL != "" && rule.ESQL != "":
+		return errors.New("only one of the fields 'sql' and 'esql' may be set")
+	case rule.SQL != "":
+		rule.QueryType = cmp.Or(rule.QueryType, QueryTypeSQL)
+	case rule.ESQL != "":
+		rule.QueryType = cmp.Or(rule.QueryType, QueryTypeESQL)
+	}
+
+	switch rule.QueryType {
+	case "":
+		rule.QueryType = QueryTypeSearch
+	case QueryTypeSearch, QueryTypeCount, QueryTypeMSearch, QueryTypeSQL, QueryTypeESQL, QueryTypeEQL:
+	default:
+		return xerrors.Errorf(
+			"field 'query_type' must either be 'search', 'count', 'msearch', 'sql', 'esql', or 'eql', got %q",
+			rule.QueryType)
+	}
+
+	if (rule.QueryType == QueryTypeSQL && rule.SQL == "") || (rule.QueryType == QueryTypeESQL && rule.ESQL == "") {
+		return xerrors.Errorf("field '%s' is required when 'query_type' is '%s'", rule.QueryType, rule.QueryType)
+	}
+
+	if rule.isTabular() {
+		if rule.QueryType != QueryTypeSQL && rule.QueryType != QueryTypeESQL {
+			return xerrors.Errorf("fields 'sql' and 'esql' cannot be used when 'query_type' is '%s'", rule.QueryType)
+		}
+		if rule.ElasticsearchBodyRaw != nil {
+			return xerrors.Errorf("field 'body' cannot be used with field '%s'", rule.QueryType)
+		}
+		if rule.Baseline != nil {
+			return xerrors.Errorf("field 'baseline' cannot be used with field '%s'", rule.QueryType)
+		}
+	}
+
+	if rule.QueryType != QueryTypeMSearch {
+		if len(rule.Searches) > 0 {
+			return errors.New("field 'searches' requires 'query_type' to be 'msearch'")
+		}
+		return nil
+	}
+
+	if len(rule.Searches) < 1 {
+		return errors.New("at least one search must be specified ('searches') when 'query_type' is 'msearch'")
+	}
+	if rule.ElasticsearchBodyRaw != nil {
+		return errors.New("field 'body' cannot be used when 'query_type' is 'msearch'")
+	}
+	if rule.Baseline != nil {
+		return errors.New("field 'baseline' cannot be used when 'query_type' is 'msearch'")
+	}
+
+	names := make(map[string]bool, len(rule.Searches))
+	for i, search := range rule.Searches {
+		if search.Name == "" {
+			return xerrors.Errorf("search %d has no 'name' field", i+1)
+		}
+		if names[search.Name] {
+			return xerrors.Errorf("search %q is defined more than once", search.Name)
+		}
+		names[search.Name] = true
+	}
+	return nil
+}
+
+func (rule *RuleConfig) validatePartialResults() error {
+	if rule.TimeoutRaw != "" {
+		timeout, err := time.ParseDuration(rule.TimeoutRaw)
+		if err != nil || timeout <= 0 {
+			return xerrors.Errorf("field 'timeout' must be a positive duration (e.g. '30s'), got %q", rule.TimeoutRaw)
+		}
+		rule.Timeout = timeout
+	}
+
+	switch rule.PartialResults {
+	case "":
+		rule.PartialResults = PartialResultsWarn
+	case PartialResultsIgnore, PartialResultsWarn, PartialResultsFail:
+	default:
+		return xerrors.Errorf("field 'partial_results' must either be 'ignore', 'warn', or 'fail', got %q",
+			rule.PartialResults)
+	}
+
+	for i, output := range rule.ShardFailureOutputs {
+		if err := output.validate(); err != nil {
+			return xerrors.Errorf("error in shard failure output %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// isTabular returns true if the rule queries Elasticsearch with
+// an SQL or ES|QL statement rather than a query in 'body'.
+func (rule *RuleConfig) isTabular() bool {
+	return rule.SQL != "" || rule.ESQL != ""
+}
+
+// usesBody returns true if the rule's query is in its 'body' field.
+func (rule *RuleConfig) usesBody() bool {
+	switch rule.QueryType {
+	case QueryTypeMSearch, QueryTypeSQL, QueryTypeESQL:
+		return false
+	}
+	return !rule.isTabular()
+}
+
+// AllConditions returns every condition of the rule, including
+// those of its condition groups and levels.
+func (rule *RuleConfig) AllConditions() []Condition {
+	conditions := slices.Clone(rule.Conditions)
+	for _, group := range rule.ConditionGroups {
+		conditions = append(conditions, group.Conditions...)
+	}
+	for _, level := range rule.ConditionLevels {
+		conditions = append(conditions, level.Conditions...)
+	}
+	return conditions
+}
+
+// IsEnabled returns whether the rule should be run.
+func (rule *RuleConfig) IsEnabled() bool {
+	return rule.Enabled == nil || *rule.Enabled
 }
 
 func (rule *RuleConfig) validate() error { //nolint:gocyclo,gocognit
@@ -126,7 +859,7 @@ func (rule *RuleConfig) validate() error { //nolint:gocyclo,gocognit
 		return errors.New("no 'name' field found")
 	}
 
-	if rule.ElasticsearchIndex == "" {
+	if rule.ElasticsearchIndex == "" && !rule.isTabular() {
 		return errors.New("no 'index' field found")
 	}
 
@@ -138,6 +871,10 @@ func (rule *RuleConfig) validate() error { //nolint:gocyclo,gocognit
 		rule.Filters = []string{}
 	}
 
+	if err := rule.validateQueryType(); err != nil {
+		return xerrors.Errorf("error in rule %s: %v", rule.Name, err)
+	}
+
 	if rule.Outputs == nil {
 		return errors.New("no 'output' field found")
 	}
@@ -158,6 +895,85 @@ func (rule *RuleConfig) validate() error { //nolint:gocyclo,gocognit
 		}
 	}
 
+	groups := make(map[string]bool, len(rule.ConditionGroups))
+	for _, group := range rule.ConditionGroups {
+		if err := group.validate(); err != nil {
+			return xerrors.Errorf("error in rule %s: %v", rule.Name, err)
+		}
+		if groups[group.Name] {
+			return xerrors.Errorf("error in rule %s: condition group %q is defined more than once", rule.Name, group.Name)
+		}
+		groups[group.Name] = true
+	}
+
+	severities := make(map[string]bool, len(rule.ConditionLevels))
+	for _, level := range rule.ConditionLevels {
+		if err := level.validate(); err != nil {
+			return xerrors.Errorf("error in rule %s: %v", rule.Name, err)
+		}
+		if severities[level.Severity] {
+			return xerrors.Errorf("error in rule %s: level %q is defined more than once", rule.Name, level.Severity)
+		}
+		severities[level.Severity] = true
+	}
+
+	if rule.Baseline != nil {
+		if err := rule.Baseline.validate(); err != nil {
+			return xerrors.Errorf("error in rule %s: %v", rule.Name, err)
+		}
+	} else if slices.ContainsFunc(rule.AllConditions(), Condition.ComparesToBaseline) {
+		return xerrors.Errorf("error in rule %s: conditions comparing to 'baseline' require the field 'baseline'", rule.Name)
+	}
+
+	if rule.NoData != nil {
+		if err := rule.NoData.validate(); err != nil {
+			return xerrors.Errorf("error in rule %s: %v", rule.Name, err)
+		}
+	}
+
+	if rule.CollectAll != nil {
+		if rule.QueryType != QueryTypeSearch {
+			return xerrors.Errorf("error in rule %s: field 'collect_all' requires 'query_type' to be 'search'", rule.Name)
+		}
+		if err := rule.CollectAll.validate(); err != nil {
+			return xerrors.Errorf("error in rule %s: %v", rule.Name, err)
+		}
+	}
+
+	if err := rule.validatePartialResults(); err != nil {
+		return xerrors.Errorf("error in rule %s: %v", rule.Name, err)
+	}
+
+	if rule.Dedup != nil {
+		if err := rule.Dedup.validate(); err != nil {
+			return xerrors.Errorf("error in rule %s: %v", rule.Name, err)
+		}
+	}
+
+	if rule.ConsecutiveRuns < 0 {
+		return xerrors.Errorf("error in rule %s: field 'consecutive_runs' must not be negative", rule.Name)
+	}
+
+	if rule.ForRaw != "" {
+		d, err := time.ParseDuration(rule.ForRaw)
+		if err != nil || d < 0 {
+			return xerrors.Errorf("error in rule %s: field 'for' must be a duration (e.g. '15m'), got %q", rule.Name, rule.ForRaw)
+		}
+		rule.For = d
+	}
+
+	for i, output := range rule.Outputs {
+		if output.Route == nil {
+			continue
+		}
+		for _, name := range output.Route.ConditionGroups {
+			if !groups[name] {
+				return xerrors.Errorf("error in output %d of rule %s: route refers to undefined condition group %q",
+					i+1, rule.Name, name)
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -221,6 +1037,46 @@ type Config struct {
 	// 'consul' field of the main configuration file
 	Consul ConsulConfig `json:"consul"`
 
+	// ErrorOutputs are the methods by which alerts about rules
+	// that repeatedly fail to run should be sent. This value
+	// should come from the 'error_outputs' field of the main
+	// configuration file
+	ErrorOutputs []OutputConfig `json:"error_outputs"`
+
+	// ErrorThreshold is the number of consecutive failed runs of
+	// a rule after which an alert is sent to the ErrorOutputs. This
+	// value should come from the 'error_threshold' field of the
+	// main configuration file and defaults to 3
+	ErrorThreshold int `json:"error_threshold"`
+
+	// DeadLetter configures where alerts that could not be sent
+	// to their outputs are kept until they are replayed. This
+	// value should come from the 'dead_letter' field of the main
+	// configuration file
+	DeadLetter *DeadLetterConfig `json:"dead_letter"`
+
+	// History configures the Elasticsearch indices in which the
+	// history of every alert sent is kept. If nil, it is not kept.
+	// This value should come from the 'history' field of the main
+	// configuration file
+	History *HistoryConfig `json:"history"`
+
+	// DataDir is the directory in which alerts are queued on disk
+	// until they have been sent so that they survive restarts. If
+	// empty, alerts are only queued in memory. This value should
+	// come from the 'data_dir' field of the main configuration file
+	DataDir string `json:"data_dir"`
+
+	// Reports are summaries of the alerts sent by the rules that
+	// are sent on their own schedules. This value should come
+	// from the 'reports' field of the main configuration file
+	Reports []ReportConfig `json:"reports"`
+
+	// Delivery configures how alerts are sent to their outputs.
+	// This value should come from the 'delivery' field of the
+	// main configuration file
+	Delivery *DeliveryConfig `json:"delivery"`
+
 	// Rules are the definitions of the alerts
 	Rules []RuleConfig `json:"-"`
 }
@@ -242,6 +1098,218 @@ func decodeConfigFile(f string) (*Config, error) {
 	return cfg, err
 }
 
+const defaultErrorThreshold = 3
+
+const (
+	// DeadLetterFile keeps dead letters in a file
+	DeadLetterFile = "file"
+
+	// DeadLetterElasticsearch keeps dead letters in an
+	// Elasticsearch index
+	DeadLetterElasticsearch = "elasticsearch"
+
+	defaultDeadLetterIndex = "go-es-alerts-dead-letters"
+)
+
+// DeadLetterConfig maps to the 'dead_letter' field of the main
+// configuration file.
+type DeadLetterConfig struct {
+	// Type is where the dead letters are kept (either "file"
+	// or "elasticsearch")
+	Type string `json:"type"`
+
+	// File is the file in which the dead letters are kept, one
+	// JSON object per line, when Type is "file"
+	File string `json:"file"`
+
+	// Index is the Elasticsearch index in which the dead letters
+	// are kept when Type is "elasticsearch". It defaults to
+	// "go-es-alerts-dead-letters"
+	Index string `json:"index"`
+}
+
+func (d *DeadLetterConfig) validate() error {
+	switch d.Type {
+	case DeadLetterFile:
+		if d.File == "" {
+			return errors.New("field 'dead_letter.file' is required when 'dead_letter.type' is \"file\"")
+		}
+	case DeadLetterElasticsearch:
+		d.Index = cmp.Or(d.Index, defaultDeadLetterIndex)
+	default:
+		return xerrors.Errorf("field 'dead_letter.type' must be %q or %q", DeadLetterFile, DeadLetterElasticsearch)
+	}
+	return nil
+}
+
+const defaultHistoryIndex = "go-es-alerts-history"
+
+// HistoryConfig maps to the 'history' field of the main
+// configuration file.
+type HistoryConfig struct {
+	// Index is the name of the index template and of the alias of
+	// the daily indices in which the history of the alerts is
+	// kept. It defaults to "go-es-alerts-history"
+	Index string `json:"index"`
+
+	// ILMPolicyName is the name of an Elasticsearch ILM policy to
+	// be applied to the history indices. It must already exist in
+	// Elasticsearch and is not created by this application. It is
+	// optional
+	ILMPolicyName string `json:"ilm_policy_name"`
+}
+
+func (h *HistoryConfig) validate() {
+	h.Index = cmp.Or(h.Index, defaultHistoryIndex)
+}
+
+const (
+	defaultDeliveryWorkers      = 1
+	defaultDeliveryQueueSize    = 100
+	defaultDeliveryQueueTimeout = 5 * time.Second
+	defaultDeliveryDrainTimeout = 10 * time.Second
+)
+
+// DeliveryConfig maps to the 'delivery' field of the main
+// configuration file.
+type DeliveryConfig struct {
+	// Workers is the number of alerts that may be sent to each
+	// output at the same time. It defaults to 1
+	Workers int `json:"workers"`
+
+	// QueueSize is the number of alerts that may be waiting to
+	// be sent to each output. It defaults to 100
+	QueueSize int `json:"queue_size"`
+
+	// QueueTimeoutRaw is how long an alert waits for room in the
+	// queue of an output before it is given up on (e.g. "30s"). It
+	// defaults to "5s"
+	QueueTimeoutRaw string `json:"queue_timeout"`
+
+	// QueueTimeout is the parsed value of QueueTimeoutRaw
+	QueueTimeout time.Duration `json:"-"`
+
+	// DrainTimeoutRaw is how long to wait for the alerts that are
+	// being sent when the process shuts down (e.g. "30s"). It
+	// defaults to "10s"
+	DrainTimeoutRaw string `json:"drain_timeout"`
+
+	// DrainTimeout is the parsed value of DrainTimeoutRaw
+	DrainTimeout time.Duration `json:"-"`
+}
+
+func (d *DeliveryConfig) validate() error {
+	if d.Workers < 0 {
+		return errors.New("field 'delivery.workers' must not be negative")
+	}
+	if d.QueueSize < 0 {
+		return errors.New("field 'delivery.queue_size' must not be negative")
+	}
+	d.Workers = cmp.Or(d.Workers, defaultDeliveryWorkers)
+	d.QueueSize = cmp.Or(d.QueueSize, defaultDeliveryQueueSize)
+
+	var err error
+	d.QueueTimeout, err = parseDuration("delivery.queue_timeout", d.QueueTimeoutRaw, defaultDeliveryQueueTimeout)
+	if err != nil {
+		return err
+	}
+	d.DrainTimeout, err = parseDuration("delivery.drain_timeout", d.DrainTimeoutRaw, defaultDeliveryDrainTimeout)
+	return err
+}
+
+const (
+	defaultReportPeriod  = 24 * time.Hour
+	defaultReportTopKeys = 5
+)
+
+// ReportConfig maps to each element of the 'reports' field of
+// the main configuration file.
+type ReportConfig struct {
+	// Name is the name of the report. It is the title of the
+	// alerts with which the report is sent
+	Name string `json:"name"`
+
+	// Schedule is when the report is sent (in cron syntax)
+	Schedule string `json:"schedule"`
+
+	// PeriodRaw is how far back the report looks for alerts, as
+	// a Go duration string. It defaults to "24h"
+	PeriodRaw string `json:"period"`
+
+	// Period is the parsed value of PeriodRaw
+	Period time.Duration `json:"-"`
+
+	// Rules limits the report to the alerts of these rules (e.g.
+	// "team-a/Errors"). If empty, the alerts of every rule are
+	// included
+	Rules []string `json:"rules"`
+
+	// TopKeys is the number of record keys (e.g. hostnames) with
+	// the highest counts listed for each rule. It defaults to 5
+	TopKeys int `json:"top_keys"`
+
+	// Outputs are the methods by which the report is sent
+	Outputs []OutputConfig `json:"outputs"`
+}
+
+func (r *ReportConfig) validate() error {
+	if r.Schedule == "" {
+		return errors.New("no 'schedule' field found")
+	}
+	if len(r.Outputs) < 1 {
+		return errors.New("at least one output must be specified")
+	}
+	if r.TopKeys < 0 {
+		return errors.New("field 'top_keys' must not be negative")
+	}
+	r.TopKeys = cmp.Or(r.TopKeys, defaultReportTopKeys)
+
+	var err error
+	if r.Period, err = parseDuration("period", r.PeriodRaw, defaultReportPeriod); err != nil {
+		return err
+	}
+
+	for i, output := range r.Outputs {
+		if err := output.validate(); err != nil {
+			return xerrors.Errorf("error in output %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) validateReports() error {
+	names := make(map[string]bool, len(cfg.Reports))
+	for i := range cfg.Reports {
+		report := &cfg.Reports[i]
+		if report.Name == "" {
+			return xerrors.Errorf("no 'name' field found in report %d", i+1)
+		}
+		if names[report.Name] {
+			return xerrors.Errorf("report %q is defined more than once", report.Name)
+		}
+		names[report.Name] = true
+
+		if err := report.validate(); err != nil {
+			return xerrors.Errorf("error in report %s: %v", report.Name, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) validateErrorOutputs() error {
+	if cfg.ErrorThreshold < 0 {
+		return errors.New("field 'error_threshold' must not be negative")
+	}
+	cfg.ErrorThreshold = cmp.Or(cfg.ErrorThreshold, defaultErrorThreshold)
+
+	for i, output := range cfg.ErrorOutputs {
+		if err := output.validate(); err != nil {
+			return xerrors.Errorf("error in error output %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
 // ParseConfig parses the main configuration file and returns a
 // *Config instance or a non-nil error if there was an error.
 func ParseConfig() (*Config, error) {
@@ -266,6 +1334,26 @@ func ParseConfig() (*Config, error) {
 			return nil, xerrors.Errorf("error in main configuration file %s: %v", configFile, err)
 		}
 	}
+	if err = cfg.validateErrorOutputs(); err != nil {
+		return nil, xerrors.Errorf("error in main configuration file %s: %v", configFile, err)
+	}
+	if cfg.DeadLetter != nil {
+		if err = cfg.DeadLetter.validate(); err != nil {
+			return nil, xerrors.Errorf("error in main configuration file %s: %v", configFile, err)
+		}
+	}
+	if cfg.History != nil {
+		cfg.History.validate()
+	}
+	if err = cfg.validateReports(); err != nil {
+		return nil, xerrors.Errorf("error in main configuration file %s: %v", configFile, err)
+	}
+	if cfg.Delivery == nil {
+		cfg.Delivery = new(DeliveryConfig)
+	}
+	if err = cfg.Delivery.validate(); err != nil {
+		return nil, xerrors.Errorf("error in main configuration file %s: %v", configFile, err)
+	}
 	rules, err := ParseRules()
 	if err != nil {
 		return nil, err
@@ -279,34 +1367,107 @@ func ParseConfig() (*Config, error) {
 
 // ParseRules parses the rule configuration files and returns an
 // array of *RuleConfig or a non-nil error if there was an error.
+// Rule files are discovered recursively in each of the rules
+// directories, which may be given as a list separated by
+// os.PathListSeparator. Disabled rules are not returned.
 func ParseRules() ([]RuleConfig, error) {
-	rulesDir := defaultRulesDir
-	if v := os.Getenv(envRulesDir); v != "" {
-		d, err := homedir.Expand(v)
+	rulesDirs, err := rulesDirectories()
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []RuleConfig
+	for _, rulesDir := range rulesDirs {
+		ruleFiles, err := findRuleFiles(rulesDir)
 		if err != nil {
-			return nil, xerrors.Errorf("error expanding rules directory: %v", err)
+			return nil, err
+		}
+
+		for _, ruleFile := range ruleFiles {
+			rule, ok, err := parseRuleFile(ruleFile)
+			if err != nil {
+				return nil, err
+			}
+			if !ok || !rule.IsEnabled() {
+				continue
+			}
+
+			if rule.Namespace == "" {
+				rule.Namespace = namespaceOf(rulesDir, ruleFile)
+			}
+
+			rules = append(rules, rule)
 		}
-		rulesDir = d
 	}
+	return rules, nil
+}
 
-	ruleFiles, err := filepath.Glob(filepath.Join(rulesDir, "*.json"))
-	if err != nil {
-		return nil, xerrors.Errorf("error globbing rules dir: %v", err)
+// QualifiedName returns the name of the rule prefixed by its
+// namespace, if any (e.g. "team-a/Filebeat Errors").
+func (rule *RuleConfig) QualifiedName() string {
+	if rule.Namespace == "" {
+		return rule.Name
 	}
+	return rule.Namespace + "/" + rule.Name
+}
 
-	rules := make([]RuleConfig, 0, len(ruleFiles))
-	for _, ruleFile := range ruleFiles {
-		rule, ok, err := parseRuleFile(ruleFile)
+func rulesDirectories() ([]string, error) {
+	v := os.Getenv(envRulesDir)
+	if v == "" {
+		return []string{defaultRulesDir}, nil
+	}
+
+	var dirs []string
+	for _, dir := range filepath.SplitList(v) {
+		if dir == "" {
+			continue
+		}
+		d, err := homedir.Expand(dir)
 		if err != nil {
-			return nil, err
+			return nil, xerrors.Errorf("error expanding rules directory: %v", err)
 		}
-		if !ok {
-			continue
+		dirs = append(dirs, d)
+	}
+	return dirs, nil
+}
+
+// findRuleFiles returns the paths of all JSON files within
+// rulesDir and its subdirectories in lexical order. A rules
+// directory that does not exist contains no rule files.
+func findRuleFiles(rulesDir string) ([]string, error) {
+	var ruleFiles []string
+	err := filepath.WalkDir(rulesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == rulesDir && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
 		}
+		if d.IsDir() {
+			if path != rulesDir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) == ".json" {
+			ruleFiles = append(ruleFiles, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("error walking rules dir %s: %v", rulesDir, err)
+	}
+	return ruleFiles, nil
+}
 
-		rules = append(rules, rule)
+// namespaceOf returns the directory of ruleFile relative to
+// rulesDir using forward slashes as the separator.
+func namespaceOf(rulesDir, ruleFile string) string {
+	rel, err := filepath.Rel(rulesDir, filepath.Dir(ruleFile))
+	if err != nil || rel == "." {
+		return ""
 	}
-	return rules, nil
+	return filepath.ToSlash(rel)
 }
 
 func parseRuleFile(ruleFile string) (RuleConfig, bool, error) {
@@ -329,19 +1490,100 @@ func parseRuleFile(ruleFile string) (RuleConfig, bool, error) {
 		return out, false, xerrors.Errorf("error JSON-decoding rule file %s: %v", file.Name(), err)
 	}
 
-	rule.ElasticsearchBody, err = parseBody(rule.ElasticsearchBodyRaw)
-	if err != nil {
-		return out, false, xerrors.Errorf("error in rule file %s: %v", file.Name(), err)
+	if rule.usesBody() {
+		rule.ElasticsearchBody, err = parseBody(rule.ElasticsearchBodyRaw)
+		if err != nil {
+			return out, false, xerrors.Errorf("error in rule file %s: %v", file.Name(), err)
+		}
+		rule.ElasticsearchBodyRaw = nil
 	}
-	rule.ElasticsearchBodyRaw = nil
 
 	if err := rule.validate(); err != nil {
 		return out, false, xerrors.Errorf("error in rule file %s: %v", file.Name(), err)
 	}
 
+	if err := rule.parseSearches(); err != nil {
+		return out, false, xerrors.Errorf("error in rule file %s: %v", file.Name(), err)
+	}
+
+	if err := rule.parseBaseline(); err != nil {
+		return out, false, xerrors.Errorf("error in rule file %s: %v", file.Name(), err)
+	}
+
 	return rule, true, nil
 }
 
+func (rule *RuleConfig) parseSearches() error {
+	for i := range rule.Searches {
+		search := &rule.Searches[i]
+		if search.Index == "" {
+			search.Index = rule.ElasticsearchIndex
+		}
+
+		body, err := parseBody(search.BodyRaw)
+		if err != nil {
+			return xerrors.Errorf("error in search %q: %v", search.Name, err)
+		}
+		search.Body = body
+		search.BodyRaw = nil
+	}
+	return nil
+}
+
+func (rule *RuleConfig) parseBaseline() error {
+	if rule.Baseline == nil {
+		return nil
+	}
+
+	if rule.Baseline.Index == "" {
+		rule.Baseline.Index = rule.ElasticsearchIndex
+	}
+
+	if rule.Baseline.BodyRaw == nil {
+		rule.Baseline.Body = offsetDateMath(rule.ElasticsearchBody, rule.Baseline.Offset).(map[string]any)
+		return nil
+	}
+
+	body, err := parseBody(rule.Baseline.BodyRaw)
+	if err != nil {
+		return xerrors.Errorf("error in field 'baseline': %v", err)
+	}
+	rule.Baseline.Body = body
+	rule.Baseline.BodyRaw = nil
+	return nil
+}
+
+// offsetDateMath returns a deep copy of v in which every string that
+// is an Elasticsearch date math expression anchored at "now" (e.g.
+// "now-15m/m") is shifted back by offset (e.g. "now-1d-15m/m").
+func offsetDateMath(v any, offset string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(t))
+		for k, elem := range t {
+			out[k] = offsetDateMath(elem, offset)
+		}
+		return out
+	case []any:
+		out := make([]any, len(t))
+		for i, elem := range t {
+			out[i] = offsetDateMath(elem, offset)
+		}
+		return out
+	case string:
+		if offset == "" || !strings.HasPrefix(t, "now") {
+			return t
+		}
+		rest := strings.TrimPrefix(t, "now")
+		if rest != "" && !strings.ContainsAny(rest[:1], "+-/") {
+			return t
+		}
+		return "now-" + offset + rest
+	default:
+		return v
+	}
+}
+
 func parseBody(v any) (map[string]any, error) {
 	switch b := v.(type) {
 	case map[string]any:
@@ -15,10 +15,13 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseConfig_MainConfig(t *testing.T) {
@@ -44,7 +47,38 @@ func TestParseConfig_MainConfig(t *testing.T) {
   "consul": {
     "consul_http_addr": "http://127.0.0.1:8500",
     "consul_lock_key": "go-elasticsearch-alerts/leader"
-  }
+  },
+  "error_outputs": [
+    {
+      "type": "file",
+      "config": {
+        "file": "/tmp/errors.log"
+      }
+    }
+  ],
+  "dead_letter": {
+    "type": "elasticsearch"
+  },
+  "history": {
+    "ilm_policy_name": "alert-history"
+  },
+  "delivery": {
+    "workers": 2
+  },
+  "reports": [
+    {
+      "name": "Daily Summary",
+      "schedule": "0 0 8 * * *",
+      "outputs": [
+        {
+          "type": "file",
+          "config": {
+            "file": "/tmp/reports.log"
+          }
+        }
+      ]
+    }
+  ]
 }`,
 			false,
 		},
@@ -122,6 +156,66 @@ func TestParseConfig_MainConfig(t *testing.T) {
 }`,
 			true,
 		},
+		{
+			"negative-error-threshold",
+			"testdata/config.json",
+			`{"elasticsearch":{"server":{"url": "http://127.0.0.1:9200"}},"error_threshold": -1}`,
+			true,
+		},
+		{
+			"unknown-dead-letter-type",
+			"testdata/config.json",
+			`{"elasticsearch":{"server":{"url": "http://127.0.0.1:9200"}},"dead_letter": {"type": "s3"}}`,
+			true,
+		},
+		{
+			"dead-letter-file-without-path",
+			"testdata/config.json",
+			`{"elasticsearch":{"server":{"url": "http://127.0.0.1:9200"}},"dead_letter": {"type": "file"}}`,
+			true,
+		},
+		{
+			"error-output-without-config",
+			"testdata/config.json",
+			`{"elasticsearch":{"server":{"url": "http://127.0.0.1:9200"}},"error_outputs": [{"type": "file"}]}`,
+			true,
+		},
+		{
+			"report-without-name",
+			"testdata/config.json",
+			`{"elasticsearch":{"server":{"url": "http://127.0.0.1:9200"}},"reports": [{"schedule": "@daily", "outputs": [{"type": "file", "config": {"file": "test.log"}}]}]}`, //nolint:lll
+			true,
+		},
+		{
+			"report-without-outputs",
+			"testdata/config.json",
+			`{"elasticsearch":{"server":{"url": "http://127.0.0.1:9200"}},"reports": [{"name": "test", "schedule": "@daily"}]}`,
+			true,
+		},
+		{
+			"duplicate-reports",
+			"testdata/config.json",
+			`{"elasticsearch":{"server":{"url": "http://127.0.0.1:9200"}},"reports": [{"name": "test", "schedule": "@daily", "outputs": [{"type": "file", "config": {"file": "test.log"}}]}, {"name": "test", "schedule": "@daily", "outputs": [{"type": "file", "config": {"file": "test.log"}}]}]}`, //nolint:lll
+			true,
+		},
+		{
+			"negative-delivery-workers",
+			"testdata/config.json",
+			`{"elasticsearch":{"server":{"url": "http://127.0.0.1:9200"}},"delivery": {"workers": -1}}`,
+			true,
+		},
+		{
+			"invalid-drain-timeout",
+			"testdata/config.json",
+			`{"elasticsearch":{"server":{"url": "http://127.0.0.1:9200"}},"delivery": {"drain_timeout": "soon"}}`,
+			true,
+		},
+		{
+			"invalid-queue-timeout",
+			"testdata/config.json",
+			`{"elasticsearch":{"server":{"url": "http://127.0.0.1:9200"}},"delivery": {"queue_timeout": "-1s"}}`,
+			true,
+		},
 	}
 
 	for _, tc := range cases {
@@ -174,6 +268,31 @@ func TestParseConfig_MainConfig(t *testing.T) {
 			if l != "go-elasticsearch-alerts/leader" {
 				t.Fatalf("config.Consul[\"consul_lock_key\"] unexpected value (got %q, expected \"go-elasticsearch-alerts/leader\")", l)
 			}
+
+			if len(cfg.ErrorOutputs) != 1 {
+				t.Fatalf("got %d error outputs, expected 1", len(cfg.ErrorOutputs))
+			}
+
+			if cfg.ErrorThreshold != 3 {
+				t.Fatalf("got error threshold %d, expected 3", cfg.ErrorThreshold)
+			}
+
+			if cfg.DeadLetter == nil || cfg.DeadLetter.Index != "go-es-alerts-dead-letters" {
+				t.Fatalf("unexpected dead letter configuration: %+v", cfg.DeadLetter)
+			}
+
+			if cfg.History == nil || cfg.History.Index != "go-es-alerts-history" || cfg.History.ILMPolicyName != "alert-history" {
+				t.Fatalf("unexpected history configuration: %+v", cfg.History)
+			}
+
+			if len(cfg.Reports) != 1 || cfg.Reports[0].Period != 24*time.Hour || cfg.Reports[0].TopKeys != 5 {
+				t.Fatalf("unexpected reports: %+v", cfg.Reports)
+			}
+
+			if cfg.Delivery.Workers != 2 || cfg.Delivery.QueueSize != 100 ||
+				cfg.Delivery.QueueTimeout != 5*time.Second || cfg.Delivery.DrainTimeout != 10*time.Second {
+				t.Fatalf("unexpected delivery configuration: %+v", cfg.Delivery)
+			}
 		})
 	}
 }
@@ -544,108 +663,904 @@ func TestParseConfig_Rules(t *testing.T) {
 			},
 			false,
 		},
-	}
-
-	for _, tc := range cases {
-		t.Run(tc.name, func(t *testing.T) {
-			t.Setenv(envRulesDir, tc.path)
-
-			for _, file := range tc.files {
-				fname := filepath.Join(tc.path, file.filename)
-				if err := os.WriteFile(fname, []byte(file.data), 0o666); err != nil {
-					t.Fatal(err)
-				}
-				defer os.Remove(fname)
-			}
-
-			rules, err := ParseRules()
-			if tc.err {
-				if err == nil {
-					t.Fatal("expected an error but didn't receive one")
-				}
-				return
-			}
-
-			if err != nil {
-				t.Fatal(err)
-			}
-
-			if len(rules) != len(tc.files) {
-				t.Fatalf("ParseRules() should have created one RuleConfig per rule file (got %d, expected %d)",
-					len(rules), len(tc.files))
-			}
-
-			for i, file := range tc.files {
-				var contents map[string]any
-				if err := json.Unmarshal([]byte(file.data), &contents); err != nil {
-					t.Fatal(err)
-				}
-
-				name, ok := contents["name"].(string)
-				if !ok {
-					continue
-				}
-
-				if rules[i].Name != name {
-					t.Fatalf("unexpected rule name (got %q, expected %q)", rules[i].Name, name)
-				}
-
-				index, ok := contents["index"].(string)
-				if !ok {
-					continue
-				}
-
-				if rules[i].ElasticsearchIndex != index {
-					t.Fatalf("unexpected index value (got %q, expected %q)",
-						rules[i].ElasticsearchIndex, index)
-				}
-
-				schedule, ok := contents["schedule"].(string)
-				if !ok {
-					continue
-				}
-
-				if rules[i].CronSchedule != schedule {
-					t.Fatalf("unexpected schedule value (got %q, expected %q)",
-						rules[i].CronSchedule, schedule)
-				}
-
-				filters, ok := contents["filters"].([]string)
-				if !ok {
-					continue
-				}
-
-				if len(rules[i].Filters) != len(filters) {
-					t.Fatalf("returned rule has unexpected number of filters (got %d, expected %d)",
-						len(rules[i].Filters), len(filters))
-				}
-
-				for j, filter := range filters {
-					if filter != rules[i].Filters[j] {
-						t.Fatalf("got unexpected filter (got %q, expected %q)",
-							rules[i].Filters[j], filter)
-					}
-				}
-
-				body, ok := contents["body"].(map[string]any)
-				if !ok {
-					continue
-				}
-
-				if !reflect.DeepEqual(body, rules[i].ElasticsearchBody) {
-					t.Fatalf("rule 'body' is unexpected:\nGot:\n\t%+v\nExpected:\n\t%+v",
-						rules[i].ElasticsearchBody, body)
-				}
-
-				outputs, ok := contents["outputs"].([]any)
-				if !ok {
-					continue
-				}
-				if len(rules[i].Outputs) != len(outputs) {
-					t.Fatalf("rule 'outputs' is an unexpected length (got %d, expected %d)",
-						len(rules[i].Outputs), len(outputs))
-				}
-			}
-		})
+		{
+			"routed-outputs",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "condition_groups": [
+    {
+      "name": "many-errors",
+      "conditions": [{"field": "hits.total.value", "gt": 500}]
+    }
+  ],
+  "outputs": [
+    {
+      "type": "file",
+      "config": {"file": "test.log"},
+      "route": {
+        "severity": ["critical"],
+        "labels": {"team": "a"},
+        "condition_groups": ["many-errors"]
+      }
+    }
+  ]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"route-to-undefined-condition-group",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [
+    {
+      "type": "file",
+      "config": {"file": "test.log"},
+      "route": {"condition_groups": ["many-errors"]}
+    }
+  ]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"baseline-comparison-without-baseline",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "conditions": [{"field": "hits.total.value", "compare_to": "baseline", "change": "ratio", "ge": 3}],
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"baseline-comparison",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"range": {"@timestamp": {"gte": "now-15m"}}}},
+  "baseline": {"offset": "1d"},
+  "conditions": [{"field": "hits.total.value", "compare_to": "baseline", "change": "ratio", "ge": 3}],
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"bad-baseline-offset",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "baseline": {"offset": "yesterday"},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"no-data",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "no_data": {"consecutive_runs": 3},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"negative-no-data-runs",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "no_data": {"consecutive_runs": -1},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"consecutive-runs-and-for",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "consecutive_runs": 3,
+  "for": "15m",
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"bad-for",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "for": "a while",
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"msearch",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "query_type": "msearch",
+  "searches": [
+    {"name": "errors", "body": {"query": {"term": {"level": "error"}}}},
+    {"name": "requests", "index": "requests-*", "body": {"query": {"match_all": {}}}}
+  ],
+  "conditions": [{"field": "responses.errors.hits.total.value", "gt": 10}],
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"msearch-with-body",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "query_type": "msearch",
+  "body": {"query": {"match_all": {}}},
+  "searches": [{"name": "errors", "body": {"query": {"match_all": {}}}}],
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"unknown-query-type",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "query_type": "sql",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"sql",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "schedule": "@every 1m",
+  "sql": "SELECT host AS key, COUNT(*) AS doc_count FROM logs GROUP BY host",
+  "filters": ["rows"],
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"sql-and-esql",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "schedule": "@every 1m",
+  "sql": "SELECT * FROM logs",
+  "esql": "FROM logs",
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"esql-with-body",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "schedule": "@every 1m",
+  "esql": "FROM logs | STATS count = COUNT(*)",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"eql",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "logs-endpoint-*",
+  "schedule": "@every 1m",
+  "query_type": "eql",
+  "body": {"query": "sequence by host.name [process where process.name == \"curl\"] [network where true]"},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"collect-all",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "collect_all": {"max_hits": 5000},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"collect-all-with-count",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "query_type": "count",
+  "body": {"query": {"match_all": {}}},
+  "collect_all": {},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"dedup",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "dedup": {"key": "_source.event.id", "ttl": "6h"},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"bad-dedup-ttl",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "dedup": {"ttl": "forever"},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"negative-dedup-max-keys",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "dedup": {"max_keys": -1},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"timeout-and-partial-results",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "timeout": "30s",
+  "partial_results": "fail",
+  "shard_failure_outputs": [{"type": "file", "config": {"file": "shards.log"}}],
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"bad-partial-results",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "partial_results": "retry",
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"output-retry",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}, "retry": {"max_attempts": 5, "initial_backoff": "1s", "max_backoff": "30s", "multiplier": 2, "jitter": 0, "deadline": "10m"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"output-retry-bad-backoff",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}, "retry": {"initial_backoff": "soon"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"output-retry-max-below-initial",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}, "retry": {"initial_backoff": "1m", "max_backoff": "1s"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"output-retry-bad-jitter",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}, "retry": {"jitter": 2}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"output-rate-limit",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}, "rate_limit": {"limit": 10, "period": "1h"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"output-rate-limit-without-limit",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}, "rate_limit": {"period": "1h"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"output-rate-limit-bad-period",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}, "rate_limit": {"limit": 10, "period": "hourly"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"output-group",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}, "group": {"by": ["team"], "wait": "2m"}}]
+}`,
+				},
+			},
+			false,
+		},
+		{
+			"output-group-empty-label",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}, "group": {"by": [""]}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"output-group-bad-wait",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}, "group": {"wait": "-1m"}}]
+}`,
+				},
+			},
+			true,
+		},
+		{
+			"condition-group-without-conditions",
+			"testdata/rules",
+			[]*ruleFile{
+				{
+					"testrule-1.json",
+					`{
+  "name": "test-rule-1",
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "condition_groups": [{"name": "many-errors"}],
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`,
+				},
+			},
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(envRulesDir, tc.path)
+
+			for _, file := range tc.files {
+				fname := filepath.Join(tc.path, file.filename)
+				if err := os.WriteFile(fname, []byte(file.data), 0o666); err != nil {
+					t.Fatal(err)
+				}
+				defer os.Remove(fname)
+			}
+
+			rules, err := ParseRules()
+			if tc.err {
+				if err == nil {
+					t.Fatal("expected an error but didn't receive one")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(rules) != len(tc.files) {
+				t.Fatalf("ParseRules() should have created one RuleConfig per rule file (got %d, expected %d)",
+					len(rules), len(tc.files))
+			}
+
+			for i, file := range tc.files {
+				var contents map[string]any
+				if err := json.Unmarshal([]byte(file.data), &contents); err != nil {
+					t.Fatal(err)
+				}
+
+				name, ok := contents["name"].(string)
+				if !ok {
+					continue
+				}
+
+				if rules[i].Name != name {
+					t.Fatalf("unexpected rule name (got %q, expected %q)", rules[i].Name, name)
+				}
+
+				index, ok := contents["index"].(string)
+				if !ok {
+					continue
+				}
+
+				if rules[i].ElasticsearchIndex != index {
+					t.Fatalf("unexpected index value (got %q, expected %q)",
+						rules[i].ElasticsearchIndex, index)
+				}
+
+				schedule, ok := contents["schedule"].(string)
+				if !ok {
+					continue
+				}
+
+				if rules[i].CronSchedule != schedule {
+					t.Fatalf("unexpected schedule value (got %q, expected %q)",
+						rules[i].CronSchedule, schedule)
+				}
+
+				filters, ok := contents["filters"].([]string)
+				if !ok {
+					continue
+				}
+
+				if len(rules[i].Filters) != len(filters) {
+					t.Fatalf("returned rule has unexpected number of filters (got %d, expected %d)",
+						len(rules[i].Filters), len(filters))
+				}
+
+				for j, filter := range filters {
+					if filter != rules[i].Filters[j] {
+						t.Fatalf("got unexpected filter (got %q, expected %q)",
+							rules[i].Filters[j], filter)
+					}
+				}
+
+				body, ok := contents["body"].(map[string]any)
+				if !ok {
+					continue
+				}
+
+				if !reflect.DeepEqual(body, rules[i].ElasticsearchBody) {
+					t.Fatalf("rule 'body' is unexpected:\nGot:\n\t%+v\nExpected:\n\t%+v",
+						rules[i].ElasticsearchBody, body)
+				}
+
+				outputs, ok := contents["outputs"].([]any)
+				if !ok {
+					continue
+				}
+				if len(rules[i].Outputs) != len(outputs) {
+					t.Fatalf("rule 'outputs' is an unexpected length (got %d, expected %d)",
+						len(rules[i].Outputs), len(outputs))
+				}
+			}
+		})
+	}
+}
+
+func TestParseRules_Namespaces(t *testing.T) {
+	rule := func(name, namespace string) string {
+		ns := ""
+		if namespace != "" {
+			ns = fmt.Sprintf(`"namespace": %q,`, namespace)
+		}
+		return fmt.Sprintf(`{
+  "name": %q,%s
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`, name, ns)
+	}
+
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+
+	files := map[string]string{
+		filepath.Join(dir1, "top.json"):                rule("top", ""),
+		filepath.Join(dir1, "team-a", "a.json"):        rule("a", ""),
+		filepath.Join(dir1, "team-a", "web", "b.json"): rule("b", ""),
+		filepath.Join(dir1, "team-a", "notes.txt"):     "not a rule",
+		filepath.Join(dir1, ".git", "ignored.json"):    "not a rule",
+		filepath.Join(dir2, "team-b", "c.json"):        rule("c", ""),
+		filepath.Join(dir2, "team-b", "explicit.json"): rule("d", "security"),
+	}
+	for name, data := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	missing := filepath.Join(t.TempDir(), "does-not-exist")
+	t.Setenv(envRulesDir, strings.Join([]string{dir1, dir2, missing}, string(os.PathListSeparator)))
+
+	rules, err := ParseRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		got = append(got, rule.QualifiedName())
+	}
+
+	expected := []string{"team-a/a", "team-a/web/b", "top", "team-b/c", "security/d"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected rules:\nGot:\n\t%v\nExpected:\n\t%v", got, expected)
+	}
+}
+
+func TestParseRules_Disabled(t *testing.T) {
+	dir := t.TempDir()
+
+	for name, enabled := range map[string]string{"enabled": "true", "disabled": "false", "default": ""} {
+		field := ""
+		if enabled != "" {
+			field = fmt.Sprintf(`"enabled": %s,`, enabled)
+		}
+		data := fmt.Sprintf(`{
+  "name": %q,%s
+  "index": "testindex",
+  "schedule": "@every 1m",
+  "body": {"query": {"match_all": {}}},
+  "severity": "warning",
+  "labels": {"team": "a"},
+  "outputs": [{"type": "file", "config": {"file": "test.log"}}]
+}`, name, field)
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv(envRulesDir, dir)
+
+	rules, err := ParseRules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 enabled rules (got %d)", len(rules))
+	}
+
+	for _, rule := range rules {
+		if rule.Name == "disabled" {
+			t.Fatal("disabled rule should not have been returned")
+		}
+		if rule.Severity != "warning" {
+			t.Fatalf("unexpected severity (got %q, expected \"warning\")", rule.Severity)
+		}
+		if rule.Labels["team"] != "a" {
+			t.Fatalf("unexpected labels (got %v)", rule.Labels)
+		}
+	}
+}
+
+func TestOffsetDateMath(t *testing.T) {
+	body := map[string]any{
+		"query": map[string]any{
+			"range": map[string]any{
+				"@timestamp": map[string]any{
+					"gte": "now-15m/m",
+					"lt":  "now",
+				},
+			},
+		},
+		"aggs": []any{"nowhere", "now+1h"},
+	}
+
+	expected := map[string]any{
+		"query": map[string]any{
+			"range": map[string]any{
+				"@timestamp": map[string]any{
+					"gte": "now-1d-15m/m",
+					"lt":  "now-1d",
+				},
+			},
+		},
+		"aggs": []any{"nowhere", "now-1d+1h"},
+	}
+
+	got := offsetDateMath(body, "1d")
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected baseline body:\nGot:\n\t%+v\nExpected:\n\t%+v", got, expected)
+	}
+
+	if body["query"].(map[string]any)["range"].(map[string]any)["@timestamp"].(map[string]any)["lt"] != "now" {
+		t.Fatal("offsetDateMath should not modify its input")
+	}
+}
+
+func TestRetryConfig_Defaults(t *testing.T) {
+	r := &RetryConfig{}
+	if err := r.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if r.MaxAttempts != 3 || r.InitialBackoff != 2*time.Second || r.MaxBackoff != time.Minute ||
+		r.Multiplier != 1 || *r.Jitter != 0.5 || r.Deadline != 0 {
+		t.Errorf("unexpected defaults: %+v", r)
+	}
+}
+
+func TestRateLimitConfig_Defaults(t *testing.T) {
+	r := &RateLimitConfig{Limit: 5}
+	if err := r.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Burst != 5 || r.Period != time.Minute {
+		t.Errorf("unexpected defaults: %+v", r)
+	}
+}
+
+func TestGroupConfig_Defaults(t *testing.T) {
+	g := &GroupConfig{}
+	if err := g.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if g.Wait != 30*time.Second {
+		t.Errorf("unexpected defaults: %+v", g)
 	}
 }
@@ -0,0 +1,166 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package esclient sends requests to the Elasticsearch instance
+// used by this application to query rules and keep its own data.
+package esclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/xerrors"
+)
+
+const (
+	// EnvUsername and EnvPassword are the environment variables
+	// holding the credentials used to authenticate with
+	// Elasticsearch, if any
+	EnvUsername string = "GO_ELASTICSEARCH_ALERTS_ES_USERNAME"
+	EnvPassword string = "GO_ELASTICSEARCH_ALERTS_ES_PASSWORD"
+)
+
+// ErrNotFound is returned by Client.Do when Elasticsearch responds
+// with a 404 status code.
+var ErrNotFound = errors.New("not found")
+
+// StatusError is returned by the methods of Client when Elasticsearch
+// responds with a non-2XX status code other than 404.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("received non-2XX status code %d: %s", e.StatusCode, e.Body)
+}
+
+// Credentials are used to authenticate with Elasticsearch using
+// basic auth if Username is not empty.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialsFromEnv returns the credentials set in the environment.
+// It returns an error if only one of the username and password is set.
+func CredentialsFromEnv() (Credentials, error) {
+	creds := Credentials{
+		Username: os.Getenv(EnvUsername),
+		Password: os.Getenv(EnvPassword),
+	}
+	if (creds.Username != "" || creds.Password != "") && (creds.Username == "" || creds.Password == "") {
+		return Credentials{}, xerrors.Errorf("both %s and %s should be set when using basic auth",
+			EnvUsername, EnvPassword)
+	}
+	return creds, nil
+}
+
+// NewRequest returns a new *http.Request authenticated with the
+// credentials. If data is not nil, it is sent as JSON.
+func NewRequest(ctx context.Context, method, url string, data io.Reader, creds Credentials) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, data)
+	if err != nil {
+		return nil, xerrors.Errorf("error creating new HTTP request instance: %v", err)
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if creds.Username != "" {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	return req, nil
+}
+
+// Client sends requests to an Elasticsearch instance.
+type Client struct {
+	client *http.Client
+	url    string
+	creds  Credentials
+}
+
+// New returns a new *Client that sends requests to the Elasticsearch
+// instance at url with the given *http.Client, or with a default
+// client if it is nil.
+func New(client *http.Client, url string, creds Credentials) *Client {
+	if client == nil {
+		client = cleanhttp.DefaultClient()
+	}
+	return &Client{
+		client: client,
+		url:    strings.TrimRight(url, "/"),
+		creds:  creds,
+	}
+}
+
+// URL returns the URL of the Elasticsearch instance, with no
+// trailing slash.
+func (c *Client) URL() string {
+	return c.url
+}
+
+// Do sends a request to the given path of the Elasticsearch instance
+// with the JSON-encoded body, if any, and returns the body of the
+// response. It returns ErrNotFound if the response status is 404 and
+// a *StatusError if it is otherwise not 2XX.
+func (c *Client) Do(ctx context.Context, method, path string, body []byte) ([]byte, error) {
+	return c.do(ctx, method, path, "", body)
+}
+
+// Bulk sends the newline-delimited JSON body to the _bulk endpoint of
+// the Elasticsearch instance and returns the body of the response. It
+// returns the same errors as Do.
+func (c *Client) Bulk(ctx context.Context, body []byte) ([]byte, error) {
+	return c.do(ctx, http.MethodPost, "/_bulk", "application/x-ndjson", body)
+}
+
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := NewRequest(ctx, method, c.url+path, reader, c.creds)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, xerrors.Errorf("error making HTTP request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, xerrors.Errorf("error reading response body: %v", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	return data, nil
+}
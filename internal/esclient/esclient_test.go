@@ -0,0 +1,106 @@
+// Copyright 2019 The Morning Consult, LLC or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//         https://www.apache.org/licenses/LICENSE-2.0
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package esclient
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCredentialsFromEnv(t *testing.T) {
+	cases := []struct {
+		name     string
+		username string
+		password string
+		err      bool
+	}{
+		{"none", "", "", false},
+		{"both", "elastic", "changeme", false},
+		{"username-only", "elastic", "", true},
+		{"password-only", "", "changeme", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(EnvUsername, tc.username)
+			t.Setenv(EnvPassword, tc.password)
+
+			creds, err := CredentialsFromEnv()
+			if tc.err != (err != nil) {
+				t.Fatalf("expected an error? %t (got %v)", tc.err, err)
+			}
+			if !tc.err && (creds.Username != tc.username || creds.Password != tc.password) {
+				t.Errorf("unexpected credentials: %+v", creds)
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "elastic" || pass != "changeme" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/found":
+			if r.Header.Get("Content-Type") != "application/json" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := io.ReadAll(r.Body)
+			_, _ = w.Write(data)
+		case "/_bulk":
+			_, _ = w.Write([]byte(r.Header.Get("Content-Type")))
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer ts.Close()
+
+	client := New(ts.Client(), ts.URL+"/", Credentials{Username: "elastic", Password: "changeme"})
+	if client.URL() != ts.URL {
+		t.Errorf("expected URL %q, got %q", ts.URL, client.URL())
+	}
+
+	data, err := client.Do(t.Context(), http.MethodPost, "/found", []byte(`{"hello":"world"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"hello":"world"}` {
+		t.Errorf("unexpected response body: %s", data)
+	}
+
+	if _, err = client.Do(t.Context(), http.MethodGet, "/missing", nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	var statusErr *StatusError
+	if _, err = client.Do(t.Context(), http.MethodGet, "/broken", nil); !errors.As(err, &statusErr) ||
+		statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected a *StatusError, got %v", err)
+	}
+
+	data, err = client.Bulk(t.Context(), []byte("{\"index\":{}}\n{}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "application/x-ndjson" {
+		t.Errorf("unexpected Content-Type: %s", data)
+	}
+}
@@ -46,5 +46,9 @@ func main() {
 		os.Exit(0)
 	}
 
+	if flag.Arg(0) == "replay" {
+		os.Exit(command.Replay())
+	}
+
 	os.Exit(command.Run())
 }